@@ -0,0 +1,290 @@
+package assembler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SymbolKind シンボルの種類。
+type SymbolKind int
+
+const (
+	Label    SymbolKind = iota // (Xxx)で定義されたラベル (ROMアドレス)
+	Variable                   // @xxxで自動的に割り当てられた変数 (RAMアドレス)
+	Constant                   // .equで定義した定数
+)
+
+func (k SymbolKind) String() string {
+	switch k {
+	case Label:
+		return "label"
+	case Constant:
+		return "constant"
+	}
+	return "variable"
+}
+
+// MarshalText JSONでは"label"/"variable"として表す。
+func (k SymbolKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (k *SymbolKind) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "label":
+		*k = Label
+	case "variable":
+		*k = Variable
+	case "constant":
+		*k = Constant
+	default:
+		return fmt.Errorf("unknown symbol kind %q", b)
+	}
+	return nil
+}
+
+// Symbol プログラム中で定義されたシンボル。定義済みシンボルは含まない。
+type Symbol struct {
+	Name    string     `json:"name"`
+	Address int        `json:"address"`
+	Kind    SymbolKind `json:"kind"`
+}
+
+// Result アセンブル結果。
+type Result struct {
+	Words     []uint16
+	Positions []Position  // Words[i]の元になったソースの位置
+	Symbols   []Symbol    // 定数, ラベルを定義順に、続けて変数を割り当て順に並べる
+	Relocs    []Reloc     // Options.Relocatableの場合の再配置情報
+	Warnings  Diagnostics // Options.Strictで検出した警告
+	locals    map[string]bool
+	globals   map[string]bool
+	source    []srcLine // マクロ展開後のソースの各行 (リスティング用)
+	wordLines []int     // Words[i]の元になったsourceの行の添字 (リスティング用)
+}
+
+// Options アセンブルの設定。
+type Options struct {
+	Defines map[string]int // .equと同様に扱う定数 (.ifの条件などに使う)
+
+	// Relocatable 再配置可能なオブジェクトとしてアセンブルする。
+	// ラベルの参照はRelocsに記録し、未定義のシンボルは変数にせず外部参照として残す。
+	Relocatable bool
+
+	// Strict 別表記のニーモニック(M+D, DM=... など)を警告する。
+	// 警告だけの場合はアセンブルに成功し、Result.Warningsに入る。
+	Strict bool
+}
+
+// Assemble rのアセンブリを機械語に変換する。
+// 不正な命令があった場合はすべてをDiagnosticsとして返す。
+func Assemble(r io.Reader) ([]uint16, error) {
+	res, err := AssembleSource("", r)
+	if err != nil {
+		return nil, err
+	}
+	return res.Words, nil
+}
+
+// AssembleSource rのアセンブリを機械語に変換し、シンボルテーブルとともに返す。
+// nameはDiagnosticsに表示するファイル名。
+func AssembleSource(name string, r io.Reader) (*Result, error) {
+	return AssembleWith(name, r, Options{})
+}
+
+// AssembleWith optsの設定でアセンブルする。
+// ディレクティブとマクロは2つのパスの前に展開し、エラーの位置は展開元の行と呼び出し元で示す。
+func AssembleWith(name string, r io.Reader, opts Options) (*Result, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lines, constants, locals, globals, ppDiags := preprocess(name, src, opts)
+	expanded := make([]string, len(lines))
+	for i, l := range lines {
+		expanded[i] = l.text
+	}
+	src = []byte(strings.Join(expanded, "\n"))
+
+	code := NewCode()
+	symbolT := NewSymbolTable()
+	res := &Result{source: lines, locals: locals, globals: globals}
+	for _, c := range constants {
+		symbolT.addEntry(c.Name, c.Address)
+	}
+	res.Symbols = append(res.Symbols, constants...)
+
+	// loop1: 目的: 疑似コマンド (Xxx) のシンボルテーブルの作成。
+	// 命令の度に0からインクリメントし(Xxx)の疑似コマンドを見つけたら
+	// そのときの命令番号をSymbolTableに格納する。
+	// 不正なラベル定義はここで収集する。
+	var diags Diagnostics
+	labelLines := make(map[string]int) // ラベル名 → 定義された行番号 (重複定義の検出用)
+	parser1 := NewParser(bytes.NewReader(src))
+	instCount := 0
+	for parser1.hasMoreCommands() {
+		parser1.advance()
+		if parser1.commandType() == L_COMMAND {
+			label := parser1.symbol()
+			msg := checkSymbolName(label)
+			if !parser1.labelBalanced() {
+				msg = "unbalanced parentheses in label"
+			} else if line, ok := labelLines[label]; ok {
+				first := lines[line-1].pos
+				msg = fmt.Sprintf("duplicate label (first defined at %s)", position(first.File, first.Line))
+				if first.File == name {
+					msg = fmt.Sprintf("duplicate label (first defined at line %d)", first.Line)
+				}
+			} else if msg == "" && symbolT.contains(label) {
+				msg = "label redefines predefined symbol"
+				if _, ok := predefinedSymbols[label]; !ok {
+					msg = "label redefines constant"
+				}
+			}
+			if msg != "" {
+				diags = append(diags, Diagnostic{
+					Line: parser1.line(), Column: parser1.symbolColumn(),
+					Mnemonic: label, Message: msg,
+				})
+				continue
+			}
+			labelLines[label] = parser1.line()
+			symbolT.addEntry(label, instCount)
+			res.Symbols = append(res.Symbols, Symbol{Name: label, Address: instCount, Kind: Label})
+			continue
+		}
+		instCount++
+	}
+
+	// loop2: 目的: バイナリ作成。
+	// シンボルテーブルを参照/追加しながら動かす。マシン仕様従って変換する。
+	// 不正なニーモニックは途中で止めずにすべて収集し、最後にまとめて報告する。
+	ramAddrCounter := 16 // 変数対応用のシンボルテーブルへのRAMアドレス格納用
+	// variable シンボルのアドレスを返す。シンボルテーブルに無ければ新規にRAM[16]から順に変数として追加する。
+	variable := func(symbol string) int {
+		if !symbolT.contains(symbol) {
+			symbolT.addEntry(symbol, ramAddrCounter)
+			res.Symbols = append(res.Symbols, Symbol{Name: symbol, Address: ramAddrCounter, Kind: Variable})
+			ramAddrCounter++
+		}
+		return symbolT.getAddress(symbol)
+	}
+	parser2 := NewParser(bytes.NewReader(src))
+	for parser2.hasMoreCommands() {
+		parser2.advance()
+		var (
+			result uint16
+		)
+		switch parser2.commandType() {
+		case A_COMMAND:
+			symbol := parser2.symbol()
+			if isExpression(symbol) {
+				// @LABEL+1 ← 式のパターン → ラベル確定後のシンボルテーブルで評価する。
+				// @ARR+1のように未定義のシンボルは@ARRと同じく変数にする。
+				var v int
+				var err error
+				if opts.Relocatable {
+					v, err = relocateExpr(res, symbol, symbolT, labelLines)
+				} else {
+					v, err = evalExpr(symbol, func(name string) (int, bool) {
+						return variable(name), true
+					})
+				}
+				if err != nil {
+					diags = append(diags, Diagnostic{
+						Line: parser2.line(), Column: parser2.symbolColumn() + exprOffset(err),
+						Mnemonic: symbol, Message: err.Error(),
+					})
+				}
+				result = uint16(v)
+			} else if msg := checkAValue(symbol); msg != "" {
+				diags = append(diags, Diagnostic{
+					Line: parser2.line(), Column: parser2.symbolColumn(),
+					Mnemonic: symbol, Message: msg,
+				})
+			} else if dec, err := strconv.Atoi(symbol); err == nil {
+				// @123 ← symbolが数値のパターン → 対象数値をバイナリにする。
+				result = uint16(dec)
+			} else if opts.Relocatable && !symbolT.contains(symbol) {
+				// 他のオブジェクトのラベルまたは変数 → リンク時に解決する。
+				res.Relocs = append(res.Relocs, Reloc{Index: len(res.Words), Symbol: symbol})
+			} else {
+				if _, ok := labelLines[symbol]; ok && opts.Relocatable {
+					res.Relocs = append(res.Relocs, Reloc{Index: len(res.Words)})
+				}
+				// @R0 ← シンボルテーブルに既にあるパターン → 対象intをバイナリにする。
+				// @i ← シンボルテーブルに存在していないパターン → 新規にRAM[16]へテーブル追加し、アドレスをバイナリにする。
+				result = uint16(variable(symbol))
+			}
+		case L_COMMAND:
+			continue
+		case C_COMMAND:
+			compM := parser2.comp()
+			destM := parser2.dest()
+			jumpM := parser2.jump()
+			destB, ok := code.dest(destM)
+			if !ok {
+				diags = append(diags, Diagnostic{
+					Line: parser2.line(), Column: parser2.destColumn(),
+					Mnemonic: string(destM), Message: "invalid dest mnemonic",
+					Suggestion: suggest(string(destM), mnemonicsOf(destTable)),
+				})
+			}
+			if opts.Strict {
+				// 別表記は受け付けるが、正規の表記を提示する。
+				if c := canonical(destAliases, destM); c != destM {
+					diags = append(diags, Diagnostic{
+						Line: parser2.line(), Column: parser2.destColumn(),
+						Mnemonic: string(destM), Message: "non-canonical dest mnemonic",
+						Suggestion: string(c), Warning: true,
+					})
+				}
+				if c := canonical(compAliases, compM); c != compM {
+					diags = append(diags, Diagnostic{
+						Line: parser2.line(), Column: parser2.compColumn(),
+						Mnemonic: string(compM), Message: "non-canonical comp mnemonic",
+						Suggestion: string(c), Warning: true,
+					})
+				}
+			}
+			compB, ok := code.comp(compM)
+			if !ok {
+				diags = append(diags, Diagnostic{
+					Line: parser2.line(), Column: parser2.compColumn(),
+					Mnemonic: string(compM), Message: "invalid comp mnemonic",
+					Suggestion: suggest(string(compM), mnemonicsOf(compTable)),
+				})
+			}
+			jumpB, ok := code.jump(jumpM)
+			if !ok {
+				diags = append(diags, Diagnostic{
+					Line: parser2.line(), Column: parser2.jumpColumn(),
+					Mnemonic: string(jumpM), Message: "invalid jump mnemonic",
+					Suggestion: suggest(string(jumpM), mnemonicsOf(jumpTable)),
+				})
+			}
+			if bits, err := strconv.ParseUint("111"+compB+destB+jumpB, 2, 16); err == nil {
+				result = uint16(bits)
+			}
+		}
+		res.Words = append(res.Words, result)
+		res.Positions = append(res.Positions, lines[parser2.line()-1].pos)
+		res.wordLines = append(res.wordLines, parser2.line()-1)
+	}
+
+	markJumps(res)
+
+	if len(diags) > 0 || len(ppDiags) > 0 {
+		// 警告とエラーを行順に並べ、エラーがある場合は警告も合わせて返す。
+		diags.locate(lines)
+		if len(ppDiags) > 0 || diags.hasErrors() {
+			return nil, append(ppDiags, diags...)
+		}
+		res.Warnings = diags
+	}
+	return res, nil
+}
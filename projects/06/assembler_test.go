@@ -0,0 +1,116 @@
+package assembler
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/momotaro98/nand2tetris/assembler/cpu"
+)
+
+// testSources 並行アセンブルのテストに使う.asmファイル (6章の例と7章, 8章のVMトランスレータの出力)。
+func testSources(t *testing.T) []string {
+	t.Helper()
+	var paths []string
+	for _, root := range []string{".", "../07", "../08"} {
+		found, err := FindSources(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, found...)
+	}
+	if len(paths) < 15 {
+		t.Fatalf("found only %d sources", len(paths))
+	}
+	return paths
+}
+
+// TestAssembleFilesParallel 並行にアセンブルした結果が1つずつ順にアセンブルした結果と同じことを確かめる。
+// go test -race で共有する状態が無いことも確かめる。
+func TestAssembleFilesParallel(t *testing.T) {
+	paths := testSources(t)
+	// 同じファイルを何度も並べて、同じシンボルを使うアセンブルを同時に走らせる
+	var all []string
+	for i := 0; i < 2; i++ {
+		all = append(all, paths...)
+	}
+
+	want := make([]FileResult, len(all))
+	for i, path := range all {
+		want[i] = assembleFile(path, Options{})
+		if want[i].Err != nil {
+			t.Fatalf("%s: %v", path, want[i].Err)
+		}
+	}
+	for _, workers := range []int{1, 8, 0} {
+		got := AssembleFiles(all, workers, Options{})
+		if len(got) != len(want) {
+			t.Fatalf("workers=%d: got %d results, want %d", workers, len(got), len(want))
+		}
+		for i := range got {
+			if got[i].Path != want[i].Path || got[i].Err != nil {
+				t.Fatalf("workers=%d: result %d is %s (%v), want %s", workers, i, got[i].Path, got[i].Err, want[i].Path)
+			}
+			if !reflect.DeepEqual(got[i].Result.Words, want[i].Result.Words) || !reflect.DeepEqual(got[i].Result.Symbols, want[i].Result.Symbols) {
+				t.Errorf("workers=%d: %s differs from the sequential assembly", workers, got[i].Path)
+			}
+		}
+	}
+}
+
+// TestAssembleExpected 6章の例が本書の.hackと一致することを確かめる。
+func TestAssembleExpected(t *testing.T) {
+	expected, err := filepath.Glob("*/*-expected.hack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expected) == 0 {
+		t.Fatal("no expected .hack files")
+	}
+	for _, exp := range expected {
+		src := strings.TrimSuffix(exp, "-expected.hack") + ".asm"
+		f, err := os.Open(exp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := cpu.ParseHack(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := assembleFile(src, Options{})
+		if res.Err != nil {
+			t.Fatalf("%s: %v", src, res.Err)
+		}
+		if !reflect.DeepEqual(res.Result.Words, want) {
+			t.Errorf("%s does not match %s", src, exp)
+		}
+	}
+}
+
+// TestSymbolTableIsolation 前のアセンブルのラベルや変数が次のアセンブルに残らないことを確かめる。
+func TestSymbolTableIsolation(t *testing.T) {
+	first, err := Assemble(strings.NewReader("@x\nM=0\n(LOOP)\n@LOOP\n0;JMP\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Assemble(strings.NewReader("@y\nM=0\n@LOOP\n0;JMP\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// LOOPは2回目では変数になり、yの次のRAM[17]に割り当てられる
+	if first[0] != 16 || second[0] != 16 || second[2] != 17 {
+		t.Errorf("got %v and %v", first, second)
+	}
+
+	st := NewSymbolTable()
+	st.addEntry("FOO", 100)
+	if NewSymbolTable().contains("FOO") {
+		t.Error("a symbol added to one table appears in a new table")
+	}
+	if addr, _ := Predefined("SCREEN"); addr != 16384 || NewSymbolTable().getAddress("KBD") != 24576 {
+		t.Error("predefined symbols are wrong")
+	}
+}
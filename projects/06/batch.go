@@ -0,0 +1,70 @@
+package assembler
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FileResult 1ファイル分のアセンブル結果。
+type FileResult struct {
+	Path   string
+	Result *Result
+	Err    error
+}
+
+// AssembleFiles pathsのファイルを並行にアセンブルする。
+// 結果は完了順ではなくpathsと同じ順で返すため、出力は実行ごとに変わらない。
+// workersが0以下の場合はCPU数を使う。optsはすべてのファイルで共有する(読み取りのみ)。
+func AssembleFiles(paths []string, workers int, opts Options) []FileResult {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	results := make([]FileResult, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = assembleFile(paths[i], opts)
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+func assembleFile(path string, opts Options) FileResult {
+	f, err := os.Open(path)
+	if err != nil {
+		return FileResult{Path: path, Err: err}
+	}
+	defer f.Close()
+	res, err := AssembleWith(path, f, opts)
+	return FileResult{Path: path, Result: res, Err: err}
+}
+
+// FindSources root以下の.asmファイルをパス順に返す。
+func FindSources(root string) ([]string, error) {
+	var paths []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(path, ".asm") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	sort.Strings(paths)
+	return paths, err
+}
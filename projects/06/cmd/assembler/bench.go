@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/momotaro98/nand2tetris/assembler/cpu"
+)
+
+var benchPath = flag.String("bench", "", "run the given .hack or .asm file for -cycles on each emulator engine and report instructions per second")
+
+// runBenchmark -benchで指定されたプログラムを各エミュレータで-cyclesだけ実行して速さを比べる。
+// エミュレータによって最後の状態やエラーが異なる場合はエラーにする。
+func runBenchmark(path string) error {
+	program, _, err := loadProgram(path)
+	if err != nil {
+		return err
+	}
+	type result struct {
+		name    string
+		cycles  int
+		elapsed time.Duration
+		state   *cpu.State
+		err     error
+	}
+	var results []result
+	for _, name := range cpu.Engines {
+		c, err := cpu.New(program)
+		if err != nil {
+			return err
+		}
+		if err := setRAM(c, *ramSet); err != nil {
+			return err
+		}
+		start := time.Now()
+		engine, err := cpu.NewEngine(c, name)
+		if err != nil {
+			return err
+		}
+		n, err := engine.Run(*cycles)
+		results = append(results, result{name, n, time.Since(start), c.Save(nil), err})
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENGINE\tCYCLES\tTIME\tINST/S\tSPEEDUP")
+	base := results[0].elapsed
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%v\t%.3g\t%.2fx\n", r.name, r.cycles, r.elapsed.Round(time.Microsecond),
+			float64(r.cycles)/r.elapsed.Seconds(), base.Seconds()/r.elapsed.Seconds())
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, r := range results[1:] {
+		if fmt.Sprint(r.err) != fmt.Sprint(results[0].err) {
+			return fmt.Errorf("%s and %s stop with different errors: %v, %v", r.name, results[0].name, r.err, results[0].err)
+		}
+		if diffs := r.state.Diff(results[0].state, maxStateDiffs); len(diffs) > 0 {
+			return fmt.Errorf("%s and %s end in different states:\n  %s", r.name, results[0].name, strings.Join(diffs, "\n  "))
+		}
+	}
+	return results[0].err
+}
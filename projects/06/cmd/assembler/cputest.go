@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/momotaro98/nand2tetris/assembler/tst"
+)
+
+var tstPath = flag.String("tst", "", "run the given CPU emulator test script (.tst) and compare against its .cmp file")
+
+// newCPUSimulator .asm (-O, -Dを適用してアセンブル) または .hackを読み込むCPUエミュレータを返す。
+func newCPUSimulator() *tst.CPUSimulator {
+	return tst.NewCPUSimulator(func(path string) ([]uint16, error) {
+		program, _, err := loadProgram(path)
+		return program, err
+	})
+}
+
+// runTestScript -tstで指定されたスクリプトを実行して結果を表示する。
+func runTestScript(path string) error {
+	if err := tst.Run(path, newCPUSimulator()); err != nil {
+		return err
+	}
+	fmt.Println(path, "End of script - Comparison ended successfully")
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/momotaro98/nand2tetris/assembler"
+	"github.com/momotaro98/nand2tetris/assembler/cpu"
+	"github.com/momotaro98/nand2tetris/assembler/debug"
+)
+
+var debugPath = flag.String("debug", "", "debug the given .asm or .hack file interactively; commands are read from stdin (type help)")
+
+// runDebugger -debugで指定されたプログラムをデバッガで実行する。
+// 標準入力が端末の場合はプロンプトを表示する。
+func runDebugger(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	var (
+		program []uint16
+		res     *assembler.Result
+	)
+	if strings.HasSuffix(path, ".asm") {
+		res, err = assembler.AssembleWith(path, f, options())
+		if res != nil {
+			program = res.Words
+		}
+	} else {
+		program, err = cpu.ParseHack(f)
+	}
+	f.Close()
+	if err != nil {
+		return err
+	}
+	c, err := cpu.New(program)
+	if err != nil {
+		return err
+	}
+	if err := setRAM(c, *ramSet); err != nil {
+		return err
+	}
+	d := debug.New(c, path, res)
+
+	interactive := false
+	if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		interactive = true
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	d.Exec("where", out)
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		if interactive {
+			fmt.Fprint(out, "(hdb) ")
+		}
+		out.Flush()
+		if !scanner.Scan() {
+			break
+		}
+		if err := d.Exec(scanner.Text(), out); err != nil {
+			if errors.Is(err, debug.ErrQuit) {
+				break
+			}
+			fmt.Fprintf(out, "error: %v\n", err)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/momotaro98/nand2tetris/assembler"
+)
+
+var disasmPath = flag.String("d", "", "disassemble the given .hack file (or -format file; \"-\" for stdin) to -o (default stdout); -sym names a symbol map (text or JSON) to recover labels and variables from")
+
+// runDisassembler -dで指定された.hackをアセンブリに戻して書き出す。
+func runDisassembler(path, outPath, symPath string) error {
+	in := os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	words, err := assembler.ReadFormat(in, format)
+	if err != nil {
+		return err
+	}
+
+	var symbols []assembler.Symbol
+	if symPath != "" {
+		f, err := os.Open(symPath)
+		if err != nil {
+			return err
+		}
+		symbols, err = assembler.ReadSymbols(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", symPath, err)
+		}
+	}
+
+	lines, err := assembler.Disassemble(words, symbols)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line + "\n")
+	}
+	if outPath == "" {
+		outPath = "-"
+	}
+	return writeOutput(outPath, buf.Bytes())
+}
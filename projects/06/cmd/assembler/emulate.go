@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/momotaro98/nand2tetris/assembler"
+	"github.com/momotaro98/nand2tetris/assembler/cpu"
+	"github.com/momotaro98/nand2tetris/assembler/trace"
+)
+
+var (
+	runPath     = flag.String("run", "", "run the given .hack or .asm file on the Hack CPU emulator instead of assembling")
+	cycles      = flag.Int("cycles", 1000000, "max cycles to run with -run (stops earlier at the final infinite loop)")
+	ramRange    = flag.String("ram", "0-15", "RAM range to print after -run, e.g. 0-15 or 256")
+	ramSet      = flag.String("set", "", "initial RAM values for -run, e.g. 0=4,1=5")
+	keyTimeline = flag.String("keys", "", "keyboard timeline for -run as CYCLE=KEY entries, e.g. \"1000=right,5000=0\" (key: code, character or name such as left, space, f1); @file reads it from a file")
+	snapCycles  = flag.String("snap", "", "cycles at which -run takes screen snapshots, e.g. 1000,50000 (default: once at the end)")
+	snapOut     = flag.String("snap-out", "", "write -run screen snapshots to this file (.png, .pbm or .txt for ASCII art); %d is replaced by the cycle")
+	showScreen  = flag.String("show", "", "print the screen at each -run snapshot to stdout as ascii or braille art")
+	asciiScale  = flag.Int("ascii-scale", 4, "pixels per character horizontally (twice that vertically) for ASCII art")
+	engineName  = flag.String("engine", "fast", "emulator for -run and -bench: fast (pre-decoded) or interp (one instruction at a time); -trace and -prof always step one instruction at a time")
+)
+
+// runEmulator -runで指定されたプログラムをエミュレータで実行し、
+// 最終的なレジスタとRAMの内容を表示する。
+// -keysの予定どおりにキーを押し、-snapのサイクルでスクリーンを書き出す。
+// -load-state, -save-stateで状態を復元, 保存し、-check-stateで最後の状態を比べる。
+// -prof, -pprofが指定されていれば実行したサイクル数を関数ごとに集計して書き出す。
+func runEmulator(path string) error {
+	program, symbols, err := loadProgram(path)
+	if err != nil {
+		return err
+	}
+	c, err := cpu.New(program)
+	if err != nil {
+		return err
+	}
+	keys, err := loadKeyTimeline(*keyTimeline)
+	if err != nil {
+		return err
+	}
+	var state machineState
+	if keys, err = state.restoreState(c, keys); err != nil {
+		return err
+	}
+	if err := setRAM(c, *ramSet); err != nil {
+		return err
+	}
+	prof, err := newProfiler(c, symbols)
+	if err != nil {
+		return err
+	}
+	limit := c.Cycles + uint64(*cycles)
+	snaps, err := parseCycles(*snapCycles)
+	if err != nil {
+		return err
+	}
+	if len(snaps) == 0 && (*snapOut != "" || *showScreen != "") {
+		snaps = []uint64{limit} // 最後に1回
+	}
+
+	engine, err := cpu.NewEngine(c, *engineName)
+	if err != nil {
+		return err
+	}
+	tr, err := openTrace()
+	if err != nil {
+		return err
+	}
+	for {
+		keys = state.applyKeys(c, keys)
+		for len(snaps) > 0 && snaps[0] <= c.Cycles {
+			if err := snapshot(c, snaps[0]); err != nil {
+				return err
+			}
+			snaps = snaps[1:]
+		}
+		if err := state.save(c, keys); err != nil {
+			return err
+		}
+		if c.Cycles >= limit || c.IsHalted() {
+			break
+		}
+		pc := c.PC
+		if tr == nil && prof == nil {
+			// 次にキー入力, スナップショット, 状態の保存をするサイクルまでまとめて実行する
+			_, err = engine.Run(int(nextEvent(limit, keys, snaps, &state) - c.Cycles))
+		} else if tr == nil || tr.filter.Done(c.Cycles) {
+			err = c.Step()
+		} else {
+			var e trace.Entry
+			if e, err = trace.Step(c); err == nil && tr.filter.Match(e) {
+				err = tr.tracer.Trace(e)
+			}
+		}
+		if err != nil {
+			if tr != nil {
+				tr.close()
+			}
+			return err
+		}
+		if prof != nil {
+			prof.Observe(pc)
+		}
+	}
+	if tr != nil {
+		if err := tr.close(); err != nil {
+			return err
+		}
+	}
+	// 停止ループに入った後の予定は最後の状態を書き出す。
+	for _, cycle := range snaps {
+		if err := snapshot(c, cycle); err != nil {
+			return err
+		}
+	}
+	if err := state.finish(c, keys); err != nil {
+		return err
+	}
+
+	lo, hi, err := parseRange(*ramRange)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("cycles=%d halted=%t\n", c.Cycles, c.IsHalted())
+	fmt.Printf("PC=%d A=%d D=%d\n", c.PC, int16(c.A), int16(c.D))
+	for addr := lo; addr <= hi && addr < cpu.RAMSize; addr++ {
+		fmt.Printf("RAM[%d]=%d\n", addr, int16(c.RAM[addr]))
+	}
+	return writeProfile(prof)
+}
+
+// nextEvent limitまでで、次にキー入力, スナップショット, 状態の保存をするサイクルを返す。
+func nextEvent(limit uint64, keys []cpu.KeyEvent, snaps []uint64, state *machineState) uint64 {
+	next := limit
+	if len(keys) > 0 && keys[0].Cycle < next {
+		next = keys[0].Cycle
+	}
+	if len(snaps) > 0 && snaps[0] < next {
+		next = snaps[0]
+	}
+	if at, ok := state.pendingSave(); ok && at < next {
+		next = at
+	}
+	return next
+}
+
+// loadKeyTimeline -keysの値を読む。"@file"の場合はファイルから読む。
+func loadKeyTimeline(s string) ([]cpu.KeyEvent, error) {
+	if strings.HasPrefix(s, "@") {
+		b, err := os.ReadFile(s[1:])
+		if err != nil {
+			return nil, err
+		}
+		s = string(b)
+	}
+	return cpu.ParseKeyTimeline(s)
+}
+
+// parseCycles "1000,50000"形式のサイクル数の並びを昇順で返す。
+func parseCycles(s string) ([]uint64, error) {
+	var cs []uint64
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' }) {
+		n, err := strconv.ParseUint(strings.TrimSpace(f), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cycle %q", f)
+		}
+		cs = append(cs, n)
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i] < cs[j] })
+	return cs, nil
+}
+
+// snapshot スクリーンを-snap-outに書き出し、-showの形式で表示する。
+func snapshot(c *cpu.CPU, cycle uint64) error {
+	switch *showScreen {
+	case "":
+	case "ascii", "braille":
+		fmt.Printf("-- screen at cycle %d --\n", c.Cycles)
+		if *showScreen == "ascii" {
+			fmt.Print(c.ScreenASCII(*asciiScale))
+		} else {
+			fmt.Print(c.ScreenBraille())
+		}
+	default:
+		return fmt.Errorf("unknown -show format %q (want ascii or braille)", *showScreen)
+	}
+	if *snapOut == "" {
+		return nil
+	}
+	path := *snapOut
+	if strings.Contains(path, "%d") {
+		path = strings.ReplaceAll(path, "%d", strconv.FormatUint(cycle, 10))
+	}
+	var buf bytes.Buffer
+	var err error
+	switch ext := filepath.Ext(path); ext {
+	case ".png":
+		err = c.WritePNG(&buf)
+	case ".pbm":
+		err = c.WritePBM(&buf)
+	case ".txt":
+		_, err = buf.WriteString(c.ScreenASCII(*asciiScale))
+	default:
+		return fmt.Errorf("unknown snapshot format %q (want .png, .pbm or .txt)", ext)
+	}
+	if err != nil {
+		return err
+	}
+	return writeOutput(path, buf.Bytes())
+}
+
+// loadProgram .hackはそのまま、.asmはアセンブルしてから機械語を読み込む。
+// シンボルは.asmではアセンブル結果から、.hackでは-symのファイルがあればそこから読む。
+func loadProgram(path string) ([]uint16, []assembler.Symbol, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	if strings.HasSuffix(path, ".asm") {
+		in, opts, err := optimizeSource(path, f)
+		if err != nil {
+			return nil, nil, err
+		}
+		res, err := assembler.AssembleWith(path, in, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		return res.Words, res.Symbols, nil
+	}
+	program, err := cpu.ParseHack(f)
+	if err != nil || *symPath == "" {
+		return program, nil, err
+	}
+	sf, err := os.Open(*symPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer sf.Close()
+	symbols, err := assembler.ReadSymbols(sf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", *symPath, err)
+	}
+	return program, symbols, nil
+}
+
+// parseRange "lo-hi"または"n"形式のアドレス範囲を解釈する。
+func parseRange(s string) (int, int, error) {
+	loS, hiS, found := strings.Cut(s, "-")
+	lo, err := strconv.Atoi(loS)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid RAM range %q", s)
+	}
+	if !found {
+		return lo, lo, nil
+	}
+	hi, err := strconv.Atoi(hiS)
+	if err != nil || hi < lo {
+		return 0, 0, fmt.Errorf("invalid RAM range %q", s)
+	}
+	return lo, hi, nil
+}
+
+// setRAM "addr=value,..."形式の指定でRAMの初期値を設定する。
+func setRAM(c *cpu.CPU, s string) error {
+	if s == "" {
+		return nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		k, v, found := strings.Cut(kv, "=")
+		addr, err1 := strconv.Atoi(k)
+		val, err2 := strconv.ParseInt(v, 10, 16)
+		if !found || err1 != nil || err2 != nil || addr < 0 || addr >= cpu.RAMSize {
+			return fmt.Errorf("invalid RAM assignment %q", kv)
+		}
+		c.RAM[addr] = uint16(val)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/momotaro98/nand2tetris/assembler/cpu"
+	"github.com/momotaro98/nand2tetris/assembler/hdl"
+	"github.com/momotaro98/nand2tetris/assembler/tst"
+)
+
+var (
+	hwTestPath = flag.String("hwtest", "", "run hardware test scripts: a .tst file or a directory searched recursively for .tst files loading .hdl chips")
+	hdlLib     = flag.String("hdllib", "", "comma separated directories to search for .hdl chips (default: 01, 02, 03/a, 03/b and 05 in the nearest directory above the script that has any of them)")
+)
+
+// hdlSimulator ハードウェアシミュレータ用テストスクリプトの対象。
+type hdlSimulator struct {
+	dir    string // スクリプトのディレクトリ
+	loader *hdl.Loader
+	sim    *hdl.Simulator
+}
+
+// Load implements tst.Simulator
+func (s *hdlSimulator) Load(path string) error {
+	if path == "" {
+		return errors.New("missing chip file")
+	}
+	sim, err := s.loader.BuildFile(path)
+	if err != nil {
+		return err
+	}
+	s.sim = sim
+	return nil
+}
+
+// Set implements tst.Simulator
+func (s *hdlSimulator) Set(name string, value int) error {
+	if s.sim == nil {
+		return errors.New("no chip loaded")
+	}
+	return s.sim.Set(name, value)
+}
+
+// Get implements tst.Simulator
+func (s *hdlSimulator) Get(name string) (string, error) {
+	if s.sim == nil {
+		return "", errors.New("no chip loaded")
+	}
+	if name == "time" {
+		return s.sim.Time(), nil
+	}
+	v, err := s.sim.Get(name)
+	return strconv.Itoa(v), err
+}
+
+// Exec implements tst.Simulator
+func (s *hdlSimulator) Exec(cmd tst.Command) error {
+	if s.sim == nil {
+		return errors.New("no chip loaded")
+	}
+	switch cmd.Name {
+	case "eval":
+		s.sim.Eval()
+	case "tick":
+		s.sim.Tick()
+	case "tock":
+		s.sim.Tock()
+	case "ticktock":
+		s.sim.Tick()
+		s.sim.Tock()
+	case "ROM32K":
+		// ROM32K load Xxx.hack
+		if len(cmd.Args) != 2 || cmd.Args[0] != "load" {
+			return tst.ErrUnsupported
+		}
+		f, err := os.Open(filepath.Join(s.dir, cmd.Args[1]))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		program, err := cpu.ParseHack(f)
+		if err != nil {
+			return err
+		}
+		return s.sim.LoadROM(program)
+	default:
+		return tst.ErrUnsupported
+	}
+	return nil
+}
+
+// partRef "RAM16K[0]", "PC[]" のような組み込み部品の状態の参照
+var partRef = regexp.MustCompile(`\b(ARegister|DRegister|PC|RAM8|RAM64|RAM512|RAM4K|RAM16K|Screen|Keyboard|Register)\[`)
+
+// runHardwareTests -hwtestで指定されたスクリプトをすべて実行し、チップごとの結果を表示する。
+func runHardwareTests(path string) error {
+	scripts, err := findHardwareTests(path)
+	if err != nil {
+		return err
+	}
+	if len(scripts) == 0 {
+		return fmt.Errorf("no hardware test scripts found in %s", path)
+	}
+
+	failed := 0
+	for _, script := range scripts {
+		lib, err := hardwareLibDirs(script)
+		if err != nil {
+			return err
+		}
+		loader := hdl.NewLoader(append([]string{filepath.Dir(script)}, lib...)...)
+		// 部品の内部状態を参照するスクリプトでは、その部品に組み込みチップを使う
+		// (公式のハードウェアシミュレータと同じ扱い)。
+		b, err := os.ReadFile(script)
+		if err != nil {
+			return err
+		}
+		for _, m := range partRef.FindAllStringSubmatch(string(b), -1) {
+			loader.PreferBuiltin[m[1]] = true
+		}
+
+		name := strings.TrimSuffix(script, ".tst")
+		if err := tst.Run(script, &hdlSimulator{dir: filepath.Dir(script), loader: loader}); err != nil {
+			failed++
+			fmt.Printf("FAIL %s\n     %s\n", name, strings.ReplaceAll(err.Error(), "\n", "\n     "))
+			continue
+		}
+		fmt.Printf("ok   %s\n", name)
+	}
+	fmt.Printf("%d passed, %d failed\n", len(scripts)-failed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d hardware test(s) failed", failed)
+	}
+	return nil
+}
+
+// findHardwareTests pathがディレクトリの場合、.hdlを読み込む.tstを再帰的に集める。
+func findHardwareTests(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	var scripts []string
+	err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(p, ".tst") {
+			return err
+		}
+		ok, err := loadsHDL(p)
+		if ok {
+			scripts = append(scripts, p)
+		}
+		return err
+	})
+	sort.Strings(scripts)
+	return scripts, err
+}
+
+// loadsHDL スクリプトが.hdlのチップを読み込むものかを返す。
+func loadsHDL(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "load ") {
+			return strings.Contains(line, ".hdl"), nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// hardwareLibChips -hdllib指定がないときにチップを探す、プロジェクトのルートからのディレクトリ。
+var hardwareLibChips = []string{"01", "02", "03/a", "03/b", "05"}
+
+// hardwareLibDirs チップを探すディレクトリ。-hdllib指定がなければ
+// スクリプトの上位のディレクトリから01〜05のいずれかを含むものを探す。
+func hardwareLibDirs(script string) ([]string, error) {
+	if *hdlLib != "" {
+		return strings.Split(*hdlLib, ","), nil
+	}
+	abs, err := filepath.Abs(script)
+	if err != nil {
+		return nil, err
+	}
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		var lib []string
+		found := false
+		for _, sub := range hardwareLibChips {
+			path := filepath.Join(dir, sub)
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				found = true
+			}
+			lib = append(lib, path)
+		}
+		if found {
+			return lib, nil
+		}
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	return nil, fmt.Errorf("%s: no directory above the script contains the chip directories %s; pass their paths with -hdllib",
+		script, strings.Join(hardwareLibChips, ", "))
+}
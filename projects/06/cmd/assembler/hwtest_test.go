@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/momotaro98/nand2tetris/assembler/hdl"
+	"github.com/momotaro98/nand2tetris/assembler/tst"
+)
+
+// writeFiles filesを一時ディレクトリに書き、そのディレクトリを返す。
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+const xorTst = `load Xor.hdl, output-file Xor.out, compare-to Xor.cmp, output-list a%B3.1.3 b%B3.1.3 out%B3.1.3;
+set a 0, set b 0, eval, output;
+set a 0, set b 1, eval, output;
+set a 1, set b 0, eval, output;
+set a 1, set b 1, eval, output;
+`
+
+const xorCmp = `|   a   |   b   |  out  |
+|   0   |   0   |   0   |
+|   0   |   1   |   1   |
+|   1   |   0   |   1   |
+|   1   |   1   |   0   |
+`
+
+func TestHardwareScript(t *testing.T) {
+	// Xorは01のAnd, Or, Notを使う。01はprojectsの下から探す。
+	dir := writeFiles(t, map[string]string{
+		"projects/01/Not.hdl": "CHIP Not { IN in; OUT out; PARTS: Nand(a=in, b=in, out=out); }",
+		"projects/01/And.hdl": "CHIP And { IN a, b; OUT out; PARTS: Nand(a=a, b=b, out=n); Not(in=n, out=out); }",
+		"projects/01/Or.hdl":  "CHIP Or { IN a, b; OUT out; PARTS: Not(in=a, out=na); Not(in=b, out=nb); Nand(a=na, b=nb, out=out); }",
+		"projects/x/Xor.hdl":  "CHIP Xor { IN a, b; OUT out; PARTS: Or(a=a, b=b, out=o); Nand(a=a, b=b, out=n); And(a=o, b=n, out=out); }",
+		"projects/x/Xor.tst":  xorTst,
+		"projects/x/Xor.cmp":  xorCmp,
+		"projects/x/Bad.hdl":  "CHIP Bad { IN a, b; OUT out; PARTS: And(a=a, b=b, out=out); }",
+		"projects/x/Bad.tst":  strings.ReplaceAll(xorTst, "Xor.", "Bad."),
+		"projects/x/Bad.cmp":  xorCmp,
+		"projects/x/CPU.tst":  "load Add.hack, output-file CPU.out;\n",
+	})
+	script := filepath.Join(dir, "projects/x/Xor.tst")
+	lib, err := hardwareLibDirs(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lib) != 5 || lib[0] != filepath.Join(dir, "projects/01") {
+		t.Fatalf("lib dirs %v", lib)
+	}
+
+	scripts, err := findHardwareTests(filepath.Join(dir, "projects/x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "projects/x/Bad.tst"), script}
+	if !reflect.DeepEqual(scripts, want) {
+		t.Errorf("found %v, want %v (CPU.tst loads no .hdl)", scripts, want)
+	}
+
+	for _, s := range scripts {
+		loader := hdl.NewLoader(append([]string{filepath.Dir(s)}, lib...)...)
+		err := tst.Run(s, &hdlSimulator{dir: filepath.Dir(s), loader: loader})
+		if strings.HasSuffix(s, "Xor.tst") && err != nil {
+			t.Errorf("Xor: %v", err)
+		}
+		if strings.HasSuffix(s, "Bad.tst") && (err == nil || !strings.Contains(err.Error(), "comparison failure at line 3 (out)")) {
+			t.Errorf("Bad: got %v", err)
+		}
+	}
+	if err := runHardwareTests(filepath.Join(dir, "projects/x")); err == nil || err.Error() != "1 hardware test(s) failed" {
+		t.Errorf("runHardwareTests: %v", err)
+	}
+}
+
+func TestHardwareSimulatorWithoutChip(t *testing.T) {
+	s := &hdlSimulator{loader: hdl.NewLoader()}
+	if err := s.Set("a", 1); err == nil {
+		t.Error("Set before load: want an error")
+	}
+	if err := s.Exec(tst.Command{Name: "eval"}); err == nil {
+		t.Error("eval before load: want an error")
+	}
+	if err := s.Load(""); err == nil {
+		t.Error("load without a file: want an error")
+	}
+}
+
+func TestHardwareLibDirs(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"course/01/Not.hdl":     "",
+		"course/03/a/Bit.hdl":   "",
+		"course/03/b/RAM4K.tst": "",
+		"other/x/Xor.tst":       "",
+	})
+	root := filepath.Join(dir, "course")
+	want := []string{
+		filepath.Join(root, "01"), filepath.Join(root, "02"), filepath.Join(root, "03/a"),
+		filepath.Join(root, "03/b"), filepath.Join(root, "05"),
+	}
+	// projectsという名前でないルートも、03/b自身の下から探しても見つける
+	for _, script := range []string{"course/03/b/RAM4K.tst", "course/Xor.tst"} {
+		lib, err := hardwareLibDirs(filepath.Join(dir, script))
+		if err != nil || !reflect.DeepEqual(lib, want) {
+			t.Errorf("%s: lib dirs %v, %v", script, lib, err)
+		}
+	}
+
+	_, err := hardwareLibDirs(filepath.Join(dir, "other/x/Xor.tst"))
+	if err == nil || !strings.Contains(err.Error(), "-hdllib") {
+		t.Errorf("no chip directories: got %v", err)
+	}
+
+	*hdlLib = "a,b"
+	defer func() { *hdlLib = "" }()
+	if lib, err := hardwareLibDirs(filepath.Join(dir, "other/x/Xor.tst")); err != nil || !reflect.DeepEqual(lib, []string{"a", "b"}) {
+		t.Errorf("-hdllib: %v, %v", lib, err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/momotaro98/nand2tetris/assembler"
+)
+
+var (
+	compileOnly = flag.Bool("c", false, "assemble into a relocatable object file (.hobj) instead of a program")
+	linkMode    = flag.Bool("link", false, "link the given object files (or .asm files, assembled as objects) into one program written to -o")
+)
+
+// compileObject inPathを再配置可能なオブジェクトとしてアセンブルして書き出す。
+func compileObject(inPath, outPath string) error {
+	if inPath == "" || inPath == "-" {
+		return fmt.Errorf("-c needs an input .asm file")
+	}
+	obj, err := loadObject(inPath)
+	if err != nil {
+		return err
+	}
+	if outPath == "" {
+		outPath = strings.TrimSuffix(inPath, ".asm") + assembler.ObjectExt
+	}
+	var buf bytes.Buffer
+	if err := assembler.WriteObject(&buf, obj); err != nil {
+		return err
+	}
+	return writeOutput(outPath, buf.Bytes())
+}
+
+// linkObjects pathsのオブジェクトを順に並べてリンクし、outPathに書き出す。
+func linkObjects(paths []string, outPath string) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("no object files to link")
+	}
+	objs := make([]*assembler.Object, len(paths))
+	for i, path := range paths {
+		obj, err := loadObject(path)
+		if err != nil {
+			return err
+		}
+		objs[i] = obj
+	}
+	res, err := assembler.Link(objs)
+	if err != nil {
+		return err
+	}
+	if outPath == "" {
+		outPath = "-"
+	}
+	var out bytes.Buffer
+	if err := assembler.WriteFormat(&out, res.Words, format); err != nil {
+		return err
+	}
+	if err := writeOutput(outPath, out.Bytes()); err != nil {
+		return err
+	}
+	if *symPath == "" {
+		return nil
+	}
+	var sym bytes.Buffer
+	write := assembler.WriteSymbols
+	if *jsonOut {
+		write = assembler.WriteSymbolsJSON
+	}
+	if err := write(&sym, res.Symbols); err != nil {
+		return err
+	}
+	return writeOutput(*symPath, sym.Bytes())
+}
+
+// loadObject .hobjを読み込む。.asmの場合はオブジェクトとしてアセンブルする。
+func loadObject(path string) (*assembler.Object, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if strings.HasSuffix(path, ".asm") {
+		obj, err := assembler.AssembleObject(path, f, options())
+		if err == nil {
+			printWarnings(obj.Warnings)
+		}
+		return obj, err
+	}
+	obj, err := assembler.ReadObject(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return obj, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/momotaro98/nand2tetris/assembler"
+)
+
+var lintPath = flag.String("lint", "", "check the given .asm file for likely mistakes (unused labels, single-use variables, jump hazards, unreachable code, ...) and report them as warnings")
+
+// runLint -lintで指定された.asmを検査し、警告があれば一覧を表示してエラーを返す。
+func runLint(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	warnings, err := assembler.Lint(path, f, options())
+	if err != nil {
+		return err
+	}
+	if len(warnings) == 0 {
+		return nil
+	}
+	fmt.Println(warnings.Error())
+	return fmt.Errorf("%d warning(s)", len(warnings))
+}
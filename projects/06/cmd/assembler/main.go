@@ -0,0 +1,324 @@
+// Command assembler はHackアセンブリを機械語に変換する。
+//
+//	assembler [-o out.hack] [-format hack] [-sym out.sym] [-list out.lst] [-json] [file.asm]
+//	assembler -batch dir
+//	assembler -c [-o file.hobj] file.asm
+//	assembler -link [-o out.hack] a.hobj b.hobj ...
+//	assembler -d file.hack [-sym file.sym] [-o out.asm]
+//
+// 入力ファイルを省略するか "-" を指定すると標準入力から読み込み、
+// 結果を標準出力に書き出す。ファイルを指定した場合は既定で同じ場所に .hack を作る。
+// -formatで生バイナリ, Intel HEX, Verilog, MIFの形式を選べる(拡張子も形式に合わせる)。
+// -batchはdir以下のすべての.asmを並行にアセンブルし、それぞれの隣に .hack を作る。
+// -cは再配置可能なオブジェクトを作り、-linkはオブジェクトを1つのプログラムにまとめる。
+// -dは.hack(-formatの形式)をアセンブリに戻す(逆アセンブル)。
+// -run, -tst, -hwtest を指定すると、エミュレータやテストスクリプトの実行モードになる。
+// 動作モードのフラグ (modeFlags) は1つだけ指定でき、2つ以上指定するとエラーになる。
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/momotaro98/nand2tetris/assembler"
+)
+
+var (
+	outPath    = flag.String("o", "", "output file (\"-\" for stdout; default: input with the extension of -format, or stdout when reading stdin)")
+	formatName = flag.String("format", "hack", "machine code format: hack, bin-le, bin-be, ihex, readmemb, readmemh or mif")
+	symPath    = flag.String("sym", "", "write the symbol map (labels with ROM addresses, variables with RAM addresses) to this file (\"-\" for stdout)")
+	listPath   = flag.String("list", "", "write a listing (ROM address, binary, hex, source line) to this file (\"-\" for stdout)")
+	jsonOut    = flag.Bool("json", false, "write -sym and -list in JSON instead of text")
+	batch      = flag.String("batch", "", "assemble every .asm file under this directory concurrently")
+	defines    = make(defineFlag)
+	strict     = flag.Bool("strict", false, "warn about non-canonical mnemonic spellings such as M+D or DM=")
+	jobs       = flag.Int("j", 0, "number of files assembled in parallel in -batch mode (default: number of CPUs)")
+)
+
+func init() {
+	flag.Var(defines, "D", "define a constant for .if/.ifdef and @NAME, as NAME or NAME=value (repeatable)")
+}
+
+// defineFlag -D NAME=value の集まり。値を省略すると1になる。
+type defineFlag map[string]int
+
+func (d defineFlag) String() string {
+	names := make([]string, 0, len(d))
+	for k, v := range d {
+		names = append(names, fmt.Sprintf("%s=%d", k, v))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func (d defineFlag) Set(s string) error {
+	name, value, found := strings.Cut(s, "=")
+	v := 1
+	if found {
+		var err error
+		if v, err = strconv.Atoi(value); err != nil {
+			return fmt.Errorf("invalid value in %q", s)
+		}
+	}
+	d[name] = v
+	return nil
+}
+
+// options -D, -strictから組み立てたアセンブルの設定。
+func options() assembler.Options {
+	return assembler.Options{Defines: defines, Strict: *strict}
+}
+
+// printWarnings 警告を標準エラー出力に表示する。
+func printWarnings(warnings assembler.Diagnostics) {
+	if len(warnings) > 0 {
+		fmt.Fprintln(os.Stderr, warnings.Error())
+	}
+}
+
+// format -formatで選んだ機械語の形式。
+var format assembler.Format
+
+// modeFlags 互いに排他的な動作モードのフラグ。どれも無い場合はアセンブルする。
+var modeFlags = []string{"hwtest", "tst", "debug", "bench", "run", "d", "lint", "batch", "link", "c"}
+
+// checkModes 指定されたフラグ名setのうち、動作モードのフラグが2つ以上あればエラーを返す。
+func checkModes(set []string) error {
+	var modes []string
+	for _, name := range set {
+		for _, m := range modeFlags {
+			if name == m {
+				modes = append(modes, "-"+name)
+			}
+		}
+	}
+	if len(modes) > 1 {
+		return fmt.Errorf("conflicting mode flags %s: use only one of -%s", strings.Join(modes, ", "), strings.Join(modeFlags, ", -"))
+	}
+	return nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [file.asm]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	f, err := assembler.ParseFormat(*formatName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	format = f
+	var set []string
+	flag.Visit(func(f *flag.Flag) { set = append(set, f.Name) })
+	if err := checkModes(set); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if *hwTestPath != "" {
+		if err := runHardwareTests(*hwTestPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *tstPath != "" {
+		if err := runTestScript(*tstPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *debugPath != "" {
+		if err := runDebugger(*debugPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *benchPath != "" {
+		if err := runBenchmark(*benchPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *runPath != "" {
+		if err := runEmulator(*runPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *disasmPath != "" {
+		if err := runDisassembler(*disasmPath, *outPath, *symPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *lintPath != "" {
+		if err := runLint(*lintPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *batch != "" {
+		if err := assembleBatch(*batch, *jobs); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *linkMode {
+		if err := linkObjects(flag.Args(), *outPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	assemble := assembleFile
+	if *compileOnly {
+		assemble = compileObject
+	}
+	if err := assemble(flag.Arg(0), *outPath); err != nil {
+		if diags, ok := err.(assembler.Diagnostics); ok {
+			// 不正な.hackを出力しないよう、エラーがあればファイルを作らずに終了する。
+			fmt.Fprintln(os.Stderr, diags.Error())
+			errors := 0
+			for _, d := range diags {
+				if !d.Warning {
+					errors++
+				}
+			}
+			fmt.Fprintf(os.Stderr, "%d error(s)\n", errors)
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
+
+// assembleFile inPathをアセンブルしてoutPathに書き出す。
+// パスが空または"-"の入力は標準入力、"-"の出力は標準出力を表す。
+// -sym, -listが指定されていればシンボルマップとリスティングも書き出す。
+func assembleFile(inPath, outPath string) error {
+	var (
+		in   io.Reader = os.Stdin
+		name           = "<stdin>"
+	)
+	if inPath != "" && inPath != "-" {
+		f, err := os.Open(inPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in, name = f, inPath
+		if outPath == "" {
+			outPath = strings.TrimSuffix(inPath, ".asm") + format.Ext()
+		}
+	}
+	if outPath == "" {
+		outPath = "-"
+	}
+
+	in, opts, err := optimizeSource(name, in)
+	if err != nil {
+		return err
+	}
+	res, err := assembler.AssembleWith(name, in, opts)
+	if err != nil {
+		return err
+	}
+	printWarnings(res.Warnings)
+	var out bytes.Buffer
+	if err := assembler.WriteFormat(&out, res.Words, format); err != nil {
+		return err
+	}
+	if err := writeOutput(outPath, out.Bytes()); err != nil {
+		return err
+	}
+	if *symPath != "" {
+		write := assembler.WriteSymbols
+		if *jsonOut {
+			write = assembler.WriteSymbolsJSON
+		}
+		var sym bytes.Buffer
+		if err := write(&sym, res.Symbols); err != nil {
+			return err
+		}
+		if err := writeOutput(*symPath, sym.Bytes()); err != nil {
+			return err
+		}
+	}
+	if *listPath != "" {
+		write := assembler.WriteListing
+		if *jsonOut {
+			write = assembler.WriteListingJSON
+		}
+		var list bytes.Buffer
+		if err := write(&list, res); err != nil {
+			return err
+		}
+		if err := writeOutput(*listPath, list.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeOutput pathに書き出す。"-"の場合は標準出力に書く。
+func writeOutput(path string, b []byte) error {
+	if path == "-" {
+		_, err := os.Stdout.Write(b)
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// assembleBatch root以下の.asmをすべてアセンブルし、パス順に結果を表示する。
+func assembleBatch(root string, workers int) error {
+	paths, err := assembler.FindSources(root)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range assembler.AssembleFiles(paths, workers, options()) {
+		err := r.Err
+		if err == nil {
+			var out bytes.Buffer
+			if err = assembler.WriteFormat(&out, r.Result.Words, format); err == nil {
+				err = writeOutput(strings.TrimSuffix(r.Path, ".asm")+format.Ext(), out.Bytes())
+			}
+		}
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL %s\n%s\n", r.Path, err)
+			continue
+		}
+		fmt.Printf("ok   %s\n", r.Path)
+		if len(r.Result.Warnings) > 0 {
+			fmt.Println(r.Result.Warnings.Error())
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d file(s) failed", failed, len(paths))
+	}
+	return nil
+}
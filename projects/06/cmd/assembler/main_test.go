@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckModes(t *testing.T) {
+	tests := []struct {
+		set  []string
+		want string // 空ならエラーなし
+	}{
+		{nil, ""},
+		{[]string{"o", "format", "sym"}, ""},
+		{[]string{"run", "cycles", "trace", "O"}, ""},
+		{[]string{"tst", "O"}, ""},
+		{[]string{"c", "o"}, ""},
+		{[]string{"run", "tst"}, "conflicting mode flags -run, -tst"},
+		{[]string{"hwtest", "debug", "bench"}, "conflicting mode flags -hwtest, -debug, -bench"},
+		{[]string{"c", "link"}, "conflicting mode flags -c, -link"},
+		{[]string{"d", "o", "lint"}, "conflicting mode flags -d, -lint"},
+		{[]string{"batch", "j", "link"}, "conflicting mode flags -batch, -link"},
+	}
+	for _, tt := range tests {
+		err := checkModes(tt.set)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%v: unexpected error %v", tt.set, err)
+		case tt.want != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.want+":")):
+			t.Errorf("%v: got %v, want %q", tt.set, err, tt.want)
+		}
+	}
+}
+
+// TestMain ASSEMBLER_TEST_MAINが設定されていれば、テストの代わりにコマンドとして実行する。
+func TestMain(m *testing.M) {
+	if os.Getenv("ASSEMBLER_TEST_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain argsを引数としてコマンドを別のプロセスで実行し、終了コードと標準エラー出力を返す。
+func runMain(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "ASSEMBLER_TEST_MAIN=1")
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if err != nil && !errors.As(err, &exit) {
+		t.Fatal(err)
+	}
+	return cmd.ProcessState.ExitCode(), stderr.String()
+}
+
+func TestAssembleErrorsExit(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"Bad.asm":  "@2\nD=M+2\n0;JMPP\n",
+		"Good.asm": "@2\nD=M+1\n",
+	})
+	code, stderr := runMain(t, filepath.Join(dir, "Bad.asm"))
+	if code != 1 || !strings.Contains(stderr, `Bad.asm:2:3: invalid comp mnemonic "M+2" (did you mean "M+1"?)`) ||
+		!strings.HasSuffix(stderr, "2 error(s)\n") {
+		t.Errorf("exit %d, stderr:\n%s", code, stderr)
+	}
+	// エラーがあれば.hackを作らない
+	if _, err := os.Stat(filepath.Join(dir, "Bad.hack")); !os.IsNotExist(err) {
+		t.Errorf("Bad.hack was written: %v", err)
+	}
+
+	if code, stderr := runMain(t, filepath.Join(dir, "Good.asm")); code != 0 || stderr != "" {
+		t.Errorf("good program: exit %d, stderr %q", code, stderr)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "Good.hack")); err != nil || string(b) != "0000000000000010\n1111110111010000\n" {
+		t.Errorf("Good.hack: %q, %v", b, err)
+	}
+}
+
+func TestOptimizeStrict(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"Alias.asm": "@1\nDM=M+D\n(END)\n@END\n0;JMP\n"})
+	path := filepath.Join(dir, "Alias.asm")
+	for _, args := range [][]string{{"-strict", path}, {"-O", "-strict", path}} {
+		code, stderr := runMain(t, args...)
+		if code != 0 || !strings.Contains(stderr, `Alias.asm:2:1: warning: non-canonical dest mnemonic "DM" (canonical spelling is "MD")`) ||
+			!strings.Contains(stderr, `Alias.asm:2:4: warning: non-canonical comp mnemonic "M+D"`) {
+			t.Errorf("%v: exit %d, stderr:\n%s", args, code, stderr)
+		}
+	}
+}
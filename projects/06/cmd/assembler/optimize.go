@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+
+	"github.com/momotaro98/nand2tetris/assembler"
+)
+
+var (
+	optimize      = flag.Bool("O", false, "apply peephole optimizations before assembling (also for -run and -tst)")
+	optReportPath = flag.String("opt-report", "", "write the -O report (instructions saved per rule) to this file (\"-\" for stdout)")
+)
+
+// optimizeSource -Oが指定されていればinを最適化したアセンブリを返す。
+// 最適化後のアセンブリは定数とマクロを展開済みなので、-Dは再度適用しない。
+// 正規の表記に書き換わるので、-strictの警告は最適化前のソースについてここで表示する。
+func optimizeSource(name string, in io.Reader) (io.Reader, assembler.Options, error) {
+	if !*optimize {
+		return in, options(), nil
+	}
+	src, report, err := assembler.Optimize(name, in, options())
+	if err != nil {
+		return nil, assembler.Options{}, err
+	}
+	printWarnings(report.Warnings)
+	if *optReportPath != "" {
+		write := assembler.WriteOptReport
+		if *jsonOut {
+			write = assembler.WriteOptReportJSON
+		}
+		var buf bytes.Buffer
+		if err := write(&buf, report); err != nil {
+			return nil, assembler.Options{}, err
+		}
+		if err := writeOutput(*optReportPath, buf.Bytes()); err != nil {
+			return nil, assembler.Options{}, err
+		}
+	}
+	return bytes.NewReader(src), assembler.Options{Strict: *strict}, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/momotaro98/nand2tetris/assembler"
+	"github.com/momotaro98/nand2tetris/assembler/cpu"
+	"github.com/momotaro98/nand2tetris/assembler/profile"
+)
+
+var (
+	profMode  = flag.String("prof", "", "print a cycle profile after -run: flat (by function), labels or tree (call graph); .hack files need -sym for the labels")
+	profMin   = flag.Float64("prof-min", 0.5, "omit call-graph branches below this percentage of cycles with -prof tree")
+	pprofPath = flag.String("pprof", "", "write the -run cycle profile in pprof format to this file (view with go tool pprof)")
+)
+
+// newProfiler -prof または -pprof が指定されていればProfilerを返す。指定がなければnilを返す。
+func newProfiler(c *cpu.CPU, symbols []assembler.Symbol) (*profile.Profiler, error) {
+	switch *profMode {
+	case "", "flat", "labels", "tree":
+	default:
+		return nil, fmt.Errorf("unknown -prof format %q (want flat, labels or tree)", *profMode)
+	}
+	if *profMode == "" && *pprofPath == "" {
+		return nil, nil
+	}
+	return profile.New(c, symbols), nil
+}
+
+// writeProfile -profの形式で標準出力に表示し、-pprofのファイルに書き出す。
+func writeProfile(p *profile.Profiler) error {
+	if p == nil {
+		return nil
+	}
+	var err error
+	switch *profMode {
+	case "":
+	case "flat":
+		err = p.WriteFlat(os.Stdout)
+	case "labels":
+		err = p.WriteLabels(os.Stdout)
+	case "tree":
+		err = p.WriteTree(os.Stdout, *profMin)
+	}
+	if err != nil || *pprofPath == "" {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := p.WritePprof(&buf); err != nil {
+		return err
+	}
+	return writeOutput(*pprofPath, buf.Bytes())
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/momotaro98/nand2tetris/assembler/cpu"
+)
+
+var (
+	loadStatePath  = flag.String("load-state", "", "restore the machine state saved by -save-state before -run; -cycles then counts from the restored cycle")
+	saveStatePath  = flag.String("save-state", "", "save the machine state (ROM hash, registers, RAM, cycle count, pending keys) to this file during -run")
+	saveAt         = flag.Uint64("save-at", 0, "cycle at which -save-state saves the state (default: at the end of -run)")
+	recordKeysPath = flag.String("record-keys", "", "write the key events applied during -run to this file; replay them with -keys @file")
+	checkStatePath = flag.String("check-state", "", "fail if the machine state at the end of -run differs from this state file")
+)
+
+// maxStateDiffs -check-stateで表示する違いの数。
+const maxStateDiffs = 10
+
+// machineState -runの状態の保存, 復元とキー入力の記録。
+type machineState struct {
+	saved    bool
+	recorded []cpu.KeyEvent
+}
+
+// restoreState -load-stateの状態に戻し、キー入力の予定を返す。
+// -keysの指定があれば状態に保存された予定の代わりにそれを使い、復元したサイクルより前のものは反映済みとして除く。
+func (m *machineState) restoreState(c *cpu.CPU, keys []cpu.KeyEvent) ([]cpu.KeyEvent, error) {
+	if *loadStatePath == "" {
+		return keys, nil
+	}
+	s, err := readState(*loadStatePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Restore(s); err != nil {
+		return nil, fmt.Errorf("%s: %w", *loadStatePath, err)
+	}
+	if *keyTimeline == "" {
+		return s.Keys, nil
+	}
+	for len(keys) > 0 && keys[0].Cycle < c.Cycles {
+		keys = keys[1:]
+	}
+	return keys, nil
+}
+
+// applyKeys 予定どおりにキーを押し、-record-keysのために反映した入力を記録する。
+func (m *machineState) applyKeys(c *cpu.CPU, keys []cpu.KeyEvent) []cpu.KeyEvent {
+	rest := c.ApplyKeys(keys)
+	if *recordKeysPath != "" {
+		m.recorded = append(m.recorded, keys[:len(keys)-len(rest)]...)
+	}
+	return rest
+}
+
+// save -save-atのサイクルになったら状態を保存する。
+func (m *machineState) save(c *cpu.CPU, keys []cpu.KeyEvent) error {
+	if *saveStatePath == "" || m.saved || *saveAt == 0 || c.Cycles < *saveAt {
+		return nil
+	}
+	m.saved = true
+	return writeState(*saveStatePath, c.Save(keys))
+}
+
+// pendingSave -save-atで保存するサイクルを返す。保存しない場合や保存済みの場合はfalseを返す。
+func (m *machineState) pendingSave() (uint64, bool) {
+	return *saveAt, *saveStatePath != "" && !m.saved && *saveAt != 0
+}
+
+// finish 実行の終了時に、まだ保存していない状態とキー入力の記録を書き出し、-check-stateと比べる。
+func (m *machineState) finish(c *cpu.CPU, keys []cpu.KeyEvent) error {
+	if *saveStatePath != "" && !m.saved {
+		m.saved = true
+		if err := writeState(*saveStatePath, c.Save(keys)); err != nil {
+			return err
+		}
+	}
+	if *recordKeysPath != "" {
+		if err := writeOutput(*recordKeysPath, []byte(cpu.FormatKeyTimeline(m.recorded))); err != nil {
+			return err
+		}
+	}
+	if *checkStatePath == "" {
+		return nil
+	}
+	want, err := readState(*checkStatePath)
+	if err != nil {
+		return err
+	}
+	if diffs := c.Save(nil).Diff(want, maxStateDiffs); len(diffs) > 0 {
+		return fmt.Errorf("state differs from %s (got != want):\n  %s", *checkStatePath, strings.Join(diffs, "\n  "))
+	}
+	return nil
+}
+
+func readState(path string) (*cpu.State, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := cpu.ReadState(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+func writeState(path string, s *cpu.State) error {
+	var buf bytes.Buffer
+	if err := s.Write(&buf); err != nil {
+		return err
+	}
+	return writeOutput(path, buf.Bytes())
+}
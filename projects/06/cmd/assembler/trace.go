@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/momotaro98/nand2tetris/assembler/trace"
+)
+
+var (
+	tracePath   = flag.String("trace", "", "write a per-cycle execution trace of -run to this file (\"-\" for stdout)")
+	traceFormat = flag.String("trace-format", "", "trace format: jsonl or vcd (default: vcd for .vcd files, otherwise jsonl)")
+	traceCycles = flag.String("trace-cycles", "", "trace only this cycle window, e.g. 1000-2000 or 5000-")
+	tracePC     = flag.String("trace-pc", "", "trace only instructions in this ROM address range, e.g. 100-200")
+	traceAddr   = flag.String("trace-addr", "", "trace only cycles that write to this RAM address range, e.g. 0-4 or 16384-24575")
+)
+
+// cpuTrace -runの実行記録の出力先。
+type cpuTrace struct {
+	tracer trace.Tracer
+	filter trace.Filter
+	file   io.Closer
+}
+
+// openTrace -traceが指定されていれば出力先を開く。指定がなければnilを返す。
+func openTrace() (*cpuTrace, error) {
+	if *tracePath == "" {
+		return nil, nil
+	}
+	var filter trace.Filter
+	for _, f := range []struct {
+		value string
+		dst   **trace.Range
+	}{{*traceCycles, &filter.Cycles}, {*tracePC, &filter.PC}, {*traceAddr, &filter.Writes}} {
+		if f.value == "" {
+			continue
+		}
+		r, err := trace.ParseRange(f.value)
+		if err != nil {
+			return nil, err
+		}
+		*f.dst = &r
+	}
+
+	format := *traceFormat
+	if format == "" {
+		format = "jsonl"
+		if strings.HasSuffix(*tracePath, ".vcd") {
+			format = "vcd"
+		}
+	}
+	var w io.WriteCloser = os.Stdout
+	if *tracePath != "-" {
+		f, err := os.Create(*tracePath)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	t := &cpuTrace{filter: filter}
+	if w != os.Stdout {
+		t.file = w
+	}
+	switch format {
+	case "jsonl":
+		t.tracer = trace.NewJSONL(w)
+	case "vcd":
+		t.tracer = trace.NewVCD(w)
+	default:
+		if t.file != nil {
+			t.file.Close()
+		}
+		return nil, fmt.Errorf("unknown trace format %q (want jsonl or vcd)", format)
+	}
+	return t, nil
+}
+
+func (t *cpuTrace) close() error {
+	err := t.tracer.Close()
+	if t.file != nil {
+		if cerr := t.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
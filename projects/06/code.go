@@ -1,11 +1,13 @@
-package main
+package assembler
+
+import "strings"
 
 type Mnemonic string
 
 type Code interface {
-	dest(n Mnemonic) string // return 3bit
-	comp(n Mnemonic) string // return 7bit
-	jump(n Mnemonic) string // return 3bit
+	dest(n Mnemonic) (string, bool) // return 3bit
+	comp(n Mnemonic) (string, bool) // return 7bit
+	jump(n Mnemonic) (string, bool) // return 3bit
 }
 
 func NewCode() Code {
@@ -15,108 +17,146 @@ func NewCode() Code {
 type code struct {
 }
 
-func (c *code) dest(n Mnemonic) string {
-	switch string(n) {
-	case "null":
-		return "000"
-	case "M":
-		return "001"
-	case "D":
-		return "010"
-	case "MD":
-		return "011"
-	case "A":
-		return "100"
-	case "AM":
-		return "101"
-	case "AD":
-		return "110"
-	case "AMD":
-		return "111"
+// destTable destニーモニック → 3bit
+// 空文字はdest省略(例: 0;JMP)を表す。
+var destTable = map[Mnemonic]string{
+	"":     "000",
+	"null": "000",
+	"M":    "001",
+	"D":    "010",
+	"MD":   "011",
+	"A":    "100",
+	"AM":   "101",
+	"AD":   "110",
+	"AMD":  "111",
+}
+
+// jumpTable jumpニーモニック → 3bit
+// 空文字はjump省略(例: D=M)を表す。
+var jumpTable = map[Mnemonic]string{
+	"":     "000",
+	"null": "000",
+	"JGT":  "001",
+	"JEQ":  "010",
+	"JGE":  "011",
+	"JLT":  "100",
+	"JNE":  "101",
+	"JLE":  "110",
+	"JMP":  "111",
+}
+
+// compTable compニーモニック → 7bit (a c1 c2 c3 c4 c5 c6)
+var compTable = map[Mnemonic]string{
+	"0":   "0101010",
+	"1":   "0111111",
+	"-1":  "0111010",
+	"D":   "0001100",
+	"A":   "0110000",
+	"!D":  "0001101",
+	"!A":  "0110001",
+	"-D":  "0001111",
+	"-A":  "0110011",
+	"D+1": "0011111",
+	"A+1": "0110111",
+	"D-1": "0001110",
+	"A-1": "0110010",
+	"D+A": "0000010",
+	"D-A": "0010011",
+	"A-D": "0000111",
+	"D&A": "0000000",
+	"D|A": "0010101",
+	"M":   "1110000",
+	"!M":  "1110001",
+	"-M":  "1110011",
+	"M+1": "1110111",
+	"M-1": "1110010",
+	"D+M": "1000010",
+	"D-M": "1010011",
+	"M-D": "1000111",
+	"D&M": "1000000",
+	"D|M": "1010101",
+}
+
+// 別表記 → 正規のニーモニック
+// compは可換な演算の左右を入れ替えたもの(M+D, 1+D, A&D など)、
+// destはレジスタの並びを入れ替えたもの(DM, MDA など)を受け付ける。
+var (
+	destAliases = permutedDests(destTable)
+	compAliases = commutedComps(compTable)
+)
+
+// commutedComps "X op Y"(opは+&|)の左右を入れ替えた表記を集める。
+func commutedComps(table map[Mnemonic]string) map[Mnemonic]Mnemonic {
+	aliases := make(map[Mnemonic]Mnemonic)
+	for m := range table {
+		if len(m) == 3 && strings.IndexByte("+&|", m[1]) >= 0 {
+			aliases[m[2:]+m[1:2]+m[:1]] = m
+		}
+	}
+	return aliases
+}
+
+// permutedDests 2文字以上のdestの文字を並べ替えた表記を集める。
+func permutedDests(table map[Mnemonic]string) map[Mnemonic]Mnemonic {
+	aliases := make(map[Mnemonic]Mnemonic)
+	var permute func(prefix, rest string, canonical Mnemonic)
+	permute = func(prefix, rest string, canonical Mnemonic) {
+		if rest == "" {
+			if Mnemonic(prefix) != canonical {
+				aliases[Mnemonic(prefix)] = canonical
+			}
+			return
+		}
+		for i := range rest {
+			permute(prefix+rest[i:i+1], rest[:i]+rest[i+1:], canonical)
+		}
+	}
+	for m := range table {
+		if m != "null" && len(m) >= 2 {
+			permute("", string(m), m)
+		}
 	}
-	return "000"
+	return aliases
 }
 
-func (c *code) jump(n Mnemonic) string {
-	switch string(n) {
-	case "null":
-		return "000"
-	case "JGT":
-		return "001"
-	case "JEQ":
-		return "010"
-	case "JGE":
-		return "011"
-	case "JLT":
-		return "100"
-	case "JNE":
-		return "101"
-	case "JLE":
-		return "110"
-	case "JMP":
-		return "111"
+// canonical nが別表記ならば正規のニーモニックを返す。それ以外はnをそのまま返す。
+func canonical(aliases map[Mnemonic]Mnemonic, n Mnemonic) Mnemonic {
+	if c, ok := aliases[n]; ok {
+		return c
 	}
-	return "000"
+	return n
+}
+
+// dest implements Code
+// 未知のニーモニックの場合はfalseを返す。
+func (c *code) dest(n Mnemonic) (string, bool) {
+	b, ok := destTable[canonical(destAliases, n)]
+	return b, ok
+}
+
+// jump implements Code
+// 未知のニーモニックの場合はfalseを返す。
+func (c *code) jump(n Mnemonic) (string, bool) {
+	b, ok := jumpTable[n]
+	return b, ok
+}
+
+// comp implements Code
+// 未知のニーモニックの場合はfalseを返す。
+func (c *code) comp(n Mnemonic) (string, bool) {
+	b, ok := compTable[canonical(compAliases, n)]
+	return b, ok
 }
 
-func (c *code) comp(n Mnemonic) string {
-	switch string(n) {
-	case "0":
-		return "0101010"
-	case "1":
-		return "0111111"
-	case "-1":
-		return "0111010"
-	case "D":
-		return "0001100"
-	case "A":
-		return "0110000"
-	case "!D":
-		return "0001101"
-	case "!A":
-		return "0110001"
-	case "-D":
-		return "0001111"
-	case "-A":
-		return "0110011"
-	case "D+1":
-		return "0011111"
-	case "A+1":
-		return "0110111"
-	case "D-1":
-		return "0001110"
-	case "A-1":
-		return "0110010"
-	case "D+A":
-		return "0000010"
-	case "D-A":
-		return "0010011"
-	case "A-D":
-		return "0000111"
-	case "D&A":
-		return "0000000"
-	case "D|A":
-		return "0010101"
-	case "M":
-		return "1110000"
-	case "!M":
-		return "1110001"
-	case "-M":
-		return "1110011"
-	case "M+1":
-		return "1110111"
-	case "M-1":
-		return "1110010"
-	case "D+M":
-		return "1000010"
-	case "D-M":
-		return "1010011"
-	case "M-D":
-		return "1000111"
-	case "D&M":
-		return "1000000"
-	case "D|M":
-		return "1010101"
+// mnemonicsOf 変換表に登録されている(空文字以外の)ニーモニックの一覧を返す。
+// 誤りに対する候補提示に使う。
+func mnemonicsOf(table map[Mnemonic]string) []string {
+	ms := make([]string, 0, len(table))
+	for m := range table {
+		if m == "" {
+			continue
+		}
+		ms = append(ms, string(m))
 	}
-	return "0000000"
+	return ms
 }
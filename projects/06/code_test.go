@@ -0,0 +1,101 @@
+package assembler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAliases(t *testing.T) {
+	c := NewCode()
+	// 別表記は正規の表記と同じビットになり、正規の表記とは重ならない
+	for alias, canon := range compAliases {
+		got, ok := c.comp(alias)
+		want, _ := c.comp(canon)
+		if _, isCanon := compTable[alias]; !ok || got != want || isCanon {
+			t.Errorf("comp %q = %s, %v, want %s (%q)", alias, got, ok, want, canon)
+		}
+	}
+	for alias, canon := range destAliases {
+		got, ok := c.dest(alias)
+		want, _ := c.dest(canon)
+		if _, isCanon := destTable[alias]; !ok || got != want || isCanon {
+			t.Errorf("dest %q = %s, %v, want %s (%q)", alias, got, ok, want, canon)
+		}
+	}
+	// D+A, D+M, D&A, D&M, D|A, D|M, D+1, A+1, M+1 の左右の入れ替えと、2文字のdestの1通り, 3文字のdestの5通りの並べ替え
+	if len(compAliases) != 9 || len(destAliases) != 3+5 {
+		t.Errorf("%d comp aliases, %d dest aliases", len(compAliases), len(destAliases))
+	}
+	for _, tt := range []struct {
+		aliases map[Mnemonic]Mnemonic
+		n, want Mnemonic
+	}{
+		{compAliases, "M+D", "D+M"},
+		{compAliases, "1+A", "A+1"},
+		{compAliases, "D-M", "D-M"}, // 引き算は入れ替えられない
+		{destAliases, "DM", "MD"},
+		{destAliases, "DMA", "AMD"},
+		{destAliases, "null", "null"},
+	} {
+		if got := canonical(tt.aliases, tt.n); got != tt.want {
+			t.Errorf("canonical(%q) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestAliasForms(t *testing.T) {
+	tests := []struct {
+		src, canonical string
+	}{
+		{"M=M+D", "M=D+M"},
+		{"DM=A|D", "MD=D|A"},
+		{"MAD=D&M;JGT", "AMD=D&M;JGT"},
+		{"D = D + M", "D=D+M"},
+		{"  AM = M - 1 ; JNE", "AM=M-1;JNE"},
+		{"0 ; JMP", "0;JMP"},
+	}
+	for _, tt := range tests {
+		got, err := Assemble(strings.NewReader(tt.src))
+		if err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		want, _ := Assemble(strings.NewReader(tt.canonical))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q = %016b, want %016b (%s)", tt.src, got, want, tt.canonical)
+		}
+	}
+}
+
+func TestStrictWarnings(t *testing.T) {
+	src := "DM=M+D\nM=D+M\n@0\nAMD=A|D;JMP\n"
+	plain, err := AssembleWith("", strings.NewReader(src), Options{})
+	if err != nil || len(plain.Warnings) != 0 {
+		t.Fatalf("without Strict: %v, warnings %v", err, plain.Warnings)
+	}
+	res, err := AssembleWith("", strings.NewReader(src), Options{Strict: true})
+	if err != nil {
+		t.Fatalf("warnings must not fail the assembly: %v", err)
+	}
+	if !reflect.DeepEqual(res.Words, plain.Words) {
+		t.Errorf("Strict changed the code: %v, want %v", res.Words, plain.Words)
+	}
+	want := []Diagnostic{
+		{Line: 1, Column: 1, Mnemonic: "DM", Message: "non-canonical dest mnemonic", Suggestion: "MD", Warning: true},
+		{Line: 1, Column: 4, Mnemonic: "M+D", Message: "non-canonical comp mnemonic", Suggestion: "D+M", Warning: true},
+		{Line: 4, Column: 5, Mnemonic: "A|D", Message: "non-canonical comp mnemonic", Suggestion: "D|A", Warning: true},
+	}
+	if !reflect.DeepEqual([]Diagnostic(res.Warnings), want) {
+		t.Errorf("got  %+v\nwant %+v", res.Warnings, want)
+	}
+	if msg := res.Warnings[0].Error(); msg != `1:1: warning: non-canonical dest mnemonic "DM" (canonical spelling is "MD")` {
+		t.Errorf("message %q", msg)
+	}
+
+	// エラーがあれば警告も合わせて返す
+	got := diagnose(t, "", src+"D=M+2\n", Options{Strict: true})
+	if len(got) != 4 || !got[0].Warning || got[3].Warning || got[3].Message != "invalid comp mnemonic" {
+		t.Errorf("with an error: %+v", got)
+	}
+}
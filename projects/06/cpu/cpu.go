@@ -0,0 +1,220 @@
+// Package cpu はHackコンピュータ(CPU, ROM, RAM, スクリーン, キーボード)の
+// エミュレータを提供する。
+package cpu
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	ROMSize    = 32768 // 命令メモリのワード数
+	ScreenAddr = 16384 // スクリーンのメモリマップ先頭アドレス
+	ScreenSize = 8192  // 512x256ピクセル / 16bit
+	KBDAddr    = 24576 // キーボードのメモリマップアドレス
+	RAMSize    = KBDAddr + 1
+)
+
+var (
+	ErrROMOverflow = errors.New("cpu: program does not fit in ROM")
+	ErrBadAddress  = errors.New("cpu: memory access out of range")
+)
+
+// CPU Hackコンピュータの状態。
+// ROMに格納されたプログラムを1命令1サイクルで実行する。
+type CPU struct {
+	A      uint16
+	D      uint16
+	PC     uint16
+	ROM    [ROMSize]uint16
+	RAM    [RAMSize]uint16
+	Cycles uint64 // 実行済みサイクル数
+	Size   int    // 読み込んだプログラムの命令数
+}
+
+// New programをROMに読み込んだCPUを返す。
+func New(program []uint16) (*CPU, error) {
+	if len(program) > ROMSize {
+		return nil, ErrROMOverflow
+	}
+	c := &CPU{Size: len(program)}
+	copy(c.ROM[:], program)
+	return c, nil
+}
+
+// Reset レジスタとRAM, サイクル数を初期状態に戻す。ROMはそのまま残す。
+func (c *CPU) Reset() {
+	c.A, c.D, c.PC = 0, 0, 0
+	c.RAM = [RAMSize]uint16{}
+	c.Cycles = 0
+}
+
+// SetKey キーボードが押しているキーのコードを設定する。0は何も押していない状態。
+func (c *CPU) SetKey(key uint16) {
+	c.RAM[KBDAddr] = key
+}
+
+// Step PCが指す命令を1つ実行する。
+// PCやMがメモリ範囲外を指す場合はErrBadAddressを返し、状態を変更しない。
+func (c *CPU) Step() error {
+	if int(c.PC) >= ROMSize {
+		return fmt.Errorf("%w: PC=%d", ErrBadAddress, c.PC)
+	}
+	inst := c.ROM[c.PC]
+
+	// A命令: 0vvv vvvv vvvv vvvv
+	if inst&0x8000 == 0 {
+		c.A = inst
+		c.PC++
+		c.Cycles++
+		return nil
+	}
+
+	// C命令: 111a cccc ccdd djjj
+	addr := c.A // M, ジャンプ先はともに命令実行前のAを参照する
+	comp := (inst >> 6) & 0x7f
+	dest := (inst >> 3) & 0x7
+	jump := inst & 0x7
+
+	y := c.A
+	if comp&0x40 != 0 {
+		if int(addr) >= RAMSize {
+			return fmt.Errorf("%w: read M[%d] at PC=%d", ErrBadAddress, addr, c.PC)
+		}
+		y = c.RAM[addr]
+	}
+	if dest&0x1 != 0 && int(addr) >= RAMSize {
+		return fmt.Errorf("%w: write M[%d] at PC=%d", ErrBadAddress, addr, c.PC)
+	}
+	out := ALU(c.D, y, comp&0x3f)
+
+	if dest&0x1 != 0 && addr != KBDAddr { // キーボードへの書き込みは無視される
+		c.RAM[addr] = out
+	}
+	if dest&0x2 != 0 {
+		c.D = out
+	}
+	if dest&0x4 != 0 {
+		c.A = out
+	}
+
+	if Jumps(out, jump) {
+		c.PC = addr
+	} else {
+		c.PC++
+	}
+	c.Cycles++
+	return nil
+}
+
+// Run 最大nサイクル実行し、実際に実行したサイクル数を返す。
+// 停止ループ(IsHalted)に入った場合はそこで止まる。
+func (c *CPU) Run(n int) (int, error) {
+	for i := 0; i < n; i++ {
+		if c.IsHalted() {
+			return i, nil
+		}
+		if err := c.Step(); err != nil {
+			return i, err
+		}
+	}
+	return n, nil
+}
+
+// IsHalted PCがプログラムの末尾を越えたか、プログラム終端の無限ループ
+//
+//	(END)
+//	@END
+//	0;JMP
+//
+// の先頭を指しているかを返す。
+func (c *CPU) IsHalted() bool {
+	pc := int(c.PC)
+	if pc >= c.Size {
+		return true
+	}
+	if pc+1 >= ROMSize {
+		return false
+	}
+	return c.ROM[pc] == uint16(pc) && c.ROM[pc+1] == 0xea87 // 0;JMP
+}
+
+// ALU Hack ALUの計算をする。xはD, yはAまたはM、
+// controlは zx nx zy ny f no の6bitである。
+func ALU(x, y uint16, control uint16) uint16 {
+	if control&0x20 != 0 { // zx
+		x = 0
+	}
+	if control&0x10 != 0 { // nx
+		x = ^x
+	}
+	if control&0x08 != 0 { // zy
+		y = 0
+	}
+	if control&0x04 != 0 { // ny
+		y = ^y
+	}
+	var out uint16
+	if control&0x02 != 0 { // f
+		out = x + y
+	} else {
+		out = x & y
+	}
+	if control&0x01 != 0 { // no
+		out = ^out
+	}
+	return out
+}
+
+// Jumps ALUの出力outとjumpビットからジャンプするかを判定する。
+func Jumps(out uint16, jump uint16) bool {
+	v := int16(out)
+	return (jump&0x4 != 0 && v < 0) ||
+		(jump&0x2 != 0 && v == 0) ||
+		(jump&0x1 != 0 && v > 0)
+}
+
+// ParseHack .hack形式("0101..."が1行に1命令)のプログラムを読み込む。
+func ParseHack(r io.Reader) ([]uint16, error) {
+	var program []uint16
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		w, err := ParseWord(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		program = append(program, w)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+// ParseWord "0101..."形式の16bitの2進数文字列を値に変換する。
+func ParseWord(s string) (uint16, error) {
+	if len(s) != 16 {
+		return 0, fmt.Errorf("invalid instruction %q: want 16 binary digits", s)
+	}
+	var w uint16
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '0':
+			w <<= 1
+		case '1':
+			w = w<<1 | 1
+		default:
+			return 0, fmt.Errorf("invalid instruction %q: want 16 binary digits", s)
+		}
+	}
+	return w, nil
+}
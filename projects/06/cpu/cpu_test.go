@@ -0,0 +1,168 @@
+package cpu
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestALU compの18通りの制御ビットを、いくつかのx, yの組で確かめる。
+func TestALU(t *testing.T) {
+	tests := []struct {
+		comp    string
+		control uint16 // zx nx zy ny f no
+		want    func(x, y uint16) uint16
+	}{
+		{"0", 0x2a, func(x, y uint16) uint16 { return 0 }},
+		{"1", 0x3f, func(x, y uint16) uint16 { return 1 }},
+		{"-1", 0x3a, func(x, y uint16) uint16 { return 0xffff }},
+		{"D", 0x0c, func(x, y uint16) uint16 { return x }},
+		{"A", 0x30, func(x, y uint16) uint16 { return y }},
+		{"!D", 0x0d, func(x, y uint16) uint16 { return ^x }},
+		{"!A", 0x31, func(x, y uint16) uint16 { return ^y }},
+		{"-D", 0x0f, func(x, y uint16) uint16 { return -x }},
+		{"-A", 0x33, func(x, y uint16) uint16 { return -y }},
+		{"D+1", 0x1f, func(x, y uint16) uint16 { return x + 1 }},
+		{"A+1", 0x37, func(x, y uint16) uint16 { return y + 1 }},
+		{"D-1", 0x0e, func(x, y uint16) uint16 { return x - 1 }},
+		{"A-1", 0x32, func(x, y uint16) uint16 { return y - 1 }},
+		{"D+A", 0x02, func(x, y uint16) uint16 { return x + y }},
+		{"D-A", 0x13, func(x, y uint16) uint16 { return x - y }},
+		{"A-D", 0x07, func(x, y uint16) uint16 { return y - x }},
+		{"D&A", 0x00, func(x, y uint16) uint16 { return x & y }},
+		{"D|A", 0x15, func(x, y uint16) uint16 { return x | y }},
+	}
+	pairs := [][2]uint16{{0, 0}, {1, 0xffff}, {17, 3}, {3, 17}, {0x7fff, 1}, {0x8000, 0x8000}, {0x5555, 0xaaaa}}
+	for _, tt := range tests {
+		for _, p := range pairs {
+			if got, want := ALU(p[0], p[1], tt.control), tt.want(p[0], p[1]); got != want {
+				t.Errorf("%s with D=%d, A=%d: got %d, want %d", tt.comp, p[0], p[1], got, want)
+			}
+		}
+	}
+}
+
+func TestJumps(t *testing.T) {
+	tests := []struct {
+		jump           string
+		bits           uint16
+		neg, zero, pos bool
+	}{
+		{"null", 0, false, false, false},
+		{"JGT", 1, false, false, true},
+		{"JEQ", 2, false, true, false},
+		{"JGE", 3, false, true, true},
+		{"JLT", 4, true, false, false},
+		{"JNE", 5, true, false, true},
+		{"JLE", 6, true, true, false},
+		{"JMP", 7, true, true, true},
+	}
+	for _, tt := range tests {
+		for _, c := range []struct {
+			out  uint16
+			want bool
+		}{{0x8000, tt.neg}, {0xffff, tt.neg}, {0, tt.zero}, {1, tt.pos}, {0x7fff, tt.pos}} {
+			if got := Jumps(c.out, tt.bits); got != c.want {
+				t.Errorf("%s with out=%d: got %v, want %v", tt.jump, int16(c.out), got, c.want)
+			}
+		}
+	}
+}
+
+func TestStep(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []uint16
+		setup   func(c *CPU)
+		steps   int
+		check   func(c *CPU) bool
+		err     error
+	}{
+		{"A-instruction", []uint16{12345}, nil, 1,
+			func(c *CPU) bool { return c.A == 12345 && c.PC == 1 && c.Cycles == 1 }, nil},
+		{"D=M", []uint16{100, 0xfc10}, func(c *CPU) { c.RAM[100] = 7 }, 2,
+			func(c *CPU) bool { return c.D == 7 && c.PC == 2 }, nil},
+		// AM=M+1は書き込み先に命令実行前のAを使う
+		{"AM=M+1", []uint16{5, 0xfde8}, func(c *CPU) { c.RAM[5] = 9 }, 2,
+			func(c *CPU) bool { return c.A == 10 && c.RAM[5] == 10 && c.RAM[10] == 0 }, nil},
+		// A=A+1;JMPのジャンプ先も命令実行前のA
+		{"A=A+1;JMP", []uint16{7, 0xede7}, nil, 2,
+			func(c *CPU) bool { return c.A == 8 && c.PC == 7 }, nil},
+		{"D;JGT not taken", []uint16{9, 0xe301}, nil, 2,
+			func(c *CPU) bool { return c.PC == 2 }, nil},
+		{"keyboard write ignored", []uint16{KBDAddr, 0xefc8}, func(c *CPU) { c.SetKey(65) }, 2,
+			func(c *CPU) bool { return c.RAM[KBDAddr] == 65 }, nil},
+		{"screen write", []uint16{ScreenAddr, 0xee88}, nil, 2,
+			func(c *CPU) bool { return c.RAM[ScreenAddr] == 0xffff }, nil},
+		{"read out of range", []uint16{KBDAddr + 1, 0xfc10}, nil, 2,
+			func(c *CPU) bool { return c.PC == 1 && c.Cycles == 1 }, ErrBadAddress},
+		{"write out of range", []uint16{0x7fff, 0xea88}, nil, 2,
+			func(c *CPU) bool { return c.PC == 1 }, ErrBadAddress},
+		// A=A-1 (0-1) はRAMの外を指すが、Mを使わなければエラーにならない
+		{"A out of range without M", []uint16{0xeca0, 0xec10}, nil, 2,
+			func(c *CPU) bool { return c.D == 0xffff && c.PC == 2 }, nil},
+	}
+	for _, tt := range tests {
+		c, err := New(tt.program)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.setup != nil {
+			tt.setup(c)
+		}
+		for i := 0; i < tt.steps && err == nil; i++ {
+			err = c.Step()
+		}
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.err)
+		}
+		if !tt.check(c) {
+			t.Errorf("%s: unexpected state A=%d D=%d PC=%d cycles=%d", tt.name, c.A, c.D, c.PC, c.Cycles)
+		}
+	}
+}
+
+func TestRunHalts(t *testing.T) {
+	// @3 D=A (END) @2 0;JMP
+	c, err := New([]uint16{3, 0xec10, 2, 0xea87})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := c.Run(100)
+	if err != nil || n != 2 || !c.IsHalted() || c.D != 3 {
+		t.Errorf("Run = %d, %v; halted %v, D=%d", n, err, c.IsHalted(), c.D)
+	}
+
+	// 末尾を越えても止まる
+	c, _ = New([]uint16{1, 2})
+	if n, err := c.Run(100); err != nil || n != 2 {
+		t.Errorf("Run past the end = %d, %v", n, err)
+	}
+
+	if _, err := New(make([]uint16, ROMSize+1)); !errors.Is(err, ErrROMOverflow) {
+		t.Errorf("New with too large a program: %v", err)
+	}
+
+	c, _ = New([]uint16{1, 0xec10})
+	c.Run(2)
+	c.RAM[3] = 4
+	c.Reset()
+	if c.A != 0 || c.D != 0 || c.PC != 0 || c.Cycles != 0 || c.RAM[3] != 0 || c.ROM[1] != 0xec10 {
+		t.Error("Reset did not clear the registers and RAM or lost the ROM")
+	}
+}
+
+func TestParseHack(t *testing.T) {
+	got, err := ParseHack(strings.NewReader("0000000000000010\n\n  1110110000010000  \r\n"))
+	if err != nil || len(got) != 2 || got[0] != 2 || got[1] != 0xec10 {
+		t.Errorf("got %v, %v", got, err)
+	}
+	for _, src := range []string{"000000000000001\n", "0000000000000021\n", "0000000000000000\nabc\n"} {
+		if _, err := ParseHack(strings.NewReader(src)); err == nil {
+			t.Errorf("%q: want an error", src)
+		}
+	}
+	if _, err := ParseHack(strings.NewReader("0000000000000000\nabc\n")); err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("error does not name the line: %v", err)
+	}
+}
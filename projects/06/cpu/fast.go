@@ -0,0 +1,409 @@
+package cpu
+
+import "fmt"
+
+// Fast 命令を前もってデコードした表で実行する高速なエミュレータ。
+//
+// 状態(レジスタ, RAM, サイクル数)はCPUと共有するので、StepやIsHaltedと混ぜて使える。
+// よく使う命令 (D=M, AM=M-1 など) は専用の操作にし、A命令と直後のC命令 (@SP / AM=M-1 など) は
+// 1つの操作にまとめて実行する。その場合もサイクル数は命令ごとに数え、Runはnサイクルちょうどで止まる。
+// ROMを書き換えた場合はNewFastで作り直すこと。
+type Fast struct {
+	cpu *CPU
+	ops []op // ROMアドレスごとの操作。プログラムの長さと同じ
+}
+
+// opKind 操作の種類。fXxxはA命令と直後のkXxxをまとめたもの。
+type opKind uint8
+
+const (
+	opHalt opKind = iota // 停止ループの先頭
+	opA                  // 後ろにC命令が続かないA命令
+
+	kC     // その他のC命令
+	kDA    // D=A
+	kDM    // D=M
+	kMD    // M=D
+	kAM    // A=M
+	kAMinc // AM=M+1
+	kAMdec // AM=M-1
+	kAinc  // A=A+1
+	kAdec  // A=A-1
+	kAMm1  // A=M-1
+	kAMp1  // A=M+1
+	kM0    // M=0
+	kMinc  // M=M+1
+	kMdec  // M=M-1
+	kDJ    // D;Jxx
+	kJMP   // 0;JMP
+
+	fC
+	fDA
+	fDM
+	fMD
+	fAM
+	fAMinc
+	fAMdec
+	fAinc
+	fAdec
+	fAMm1
+	fAMp1
+	fM0
+	fMinc
+	fMdec
+	fDJ
+	fJMP
+)
+
+// fused kXxxとA命令をまとめたfXxxの差。
+const fused = fC - kC
+
+// op デコードした命令。
+type op struct {
+	kind  opKind
+	value uint16 // A命令の値
+	comp  uint16 // zx nx zy ny f no
+	useM  bool   // comp の a ビット
+	dest  uint16
+	jump  uint16
+}
+
+// opForms 専用の操作にするC命令。
+var opForms = map[uint16]opKind{
+	0xec10: kDA, 0xfc10: kDM, 0xe308: kMD, 0xfc20: kAM,
+	0xfde8: kAMinc, 0xfca8: kAMdec, 0xede0: kAinc, 0xeca0: kAdec,
+	0xfca0: kAMm1, 0xfde0: kAMp1, 0xea88: kM0, 0xfdc8: kMinc, 0xfc88: kMdec,
+	0xea87: kJMP,
+}
+
+// NewFast cのROMをデコードしたFastを返す。
+func NewFast(c *CPU) *Fast {
+	ops := make([]op, c.Size)
+	for pc := range ops {
+		inst := c.ROM[pc]
+		o := &ops[pc]
+		switch {
+		case pc+1 < ROMSize && inst == uint16(pc) && c.ROM[pc+1] == 0xea87:
+			o.kind = opHalt
+		case inst&0x8000 == 0:
+			o.kind, o.value = opA, inst
+		default:
+			inst |= 0x6000 // 使われない2ビット
+			o.comp = (inst >> 6) & 0x3f
+			o.useM = inst&0x1000 != 0
+			o.dest = (inst >> 3) & 0x7
+			o.jump = inst & 0x7
+			if k, ok := opForms[inst]; ok {
+				o.kind = k
+			} else if inst&0xfff8 == 0xe300 && o.jump != 0 {
+				o.kind = kDJ
+			} else {
+				o.kind = kC
+			}
+		}
+	}
+	for pc := 0; pc+1 < len(ops); pc++ {
+		if ops[pc].kind == opA && ops[pc+1].kind >= kC && ops[pc+1].kind < fC {
+			v := ops[pc].value
+			ops[pc] = ops[pc+1]
+			ops[pc].kind += fused
+			ops[pc].value = v
+		}
+	}
+	return &Fast{cpu: c, ops: ops}
+}
+
+// CPU 状態を共有しているCPUを返す。
+func (f *Fast) CPU() *CPU {
+	return f.cpu
+}
+
+// Run 最大nサイクル実行し、実際に実行したサイクル数を返す。
+// CPU.Runと同じく停止ループに入った場合はそこで止まり、メモリ範囲外へのアクセスではエラーを返す。
+func (f *Fast) Run(n int) (int, error) {
+	c := f.cpu
+	ops := f.ops
+	ram := &c.RAM
+	a, d, pc := c.A, c.D, c.PC
+	done := 0
+	// まとめた操作は2サイクルかかるので、残りが2サイクル以上ある間だけ実行する。
+	// 停止, メモリ範囲外へのアクセス, 最後の1サイクルはCPU.Runに任せる。
+	// fXxxはA命令を実行してからkXxxに進む。
+loop:
+	for done < n-1 && int(pc) < len(ops) {
+		o := &ops[pc]
+		switch o.kind {
+		case opHalt:
+			break loop
+		case opA:
+			a = o.value
+
+		case fC:
+			a = o.value
+			pc++
+			done++
+			fallthrough
+		case kC:
+			addr := a
+			y := a
+			if o.useM || o.dest&0x1 != 0 {
+				if int(addr) >= RAMSize {
+					break loop
+				}
+				if o.useM {
+					y = ram[addr]
+				}
+			}
+			out := compute(o.comp, d, y)
+			if o.dest&0x1 != 0 && addr != KBDAddr {
+				ram[addr] = out
+			}
+			if o.dest&0x2 != 0 {
+				d = out
+			}
+			if o.dest&0x4 != 0 {
+				a = out
+			}
+			if o.jump != 0 && Jumps(out, o.jump) {
+				pc = addr - 1
+			}
+
+		case fDA:
+			a = o.value
+			pc++
+			done++
+			fallthrough
+		case kDA:
+			d = a
+
+		case fDM:
+			a = o.value
+			pc++
+			done++
+			fallthrough
+		case kDM:
+			if int(a) >= RAMSize {
+				break loop
+			}
+			d = ram[a]
+
+		case fMD:
+			a = o.value
+			pc++
+			done++
+			fallthrough
+		case kMD:
+			if int(a) >= RAMSize {
+				break loop
+			}
+			if a != KBDAddr {
+				ram[a] = d
+			}
+
+		case fAM:
+			a = o.value
+			pc++
+			done++
+			fallthrough
+		case kAM:
+			if int(a) >= RAMSize {
+				break loop
+			}
+			a = ram[a]
+
+		case fAMinc:
+			a = o.value
+			pc++
+			done++
+			fallthrough
+		case kAMinc:
+			if int(a) >= RAMSize {
+				break loop
+			}
+			v := ram[a] + 1
+			if a != KBDAddr {
+				ram[a] = v
+			}
+			a = v
+
+		case fAMdec:
+			a = o.value
+			pc++
+			done++
+			fallthrough
+		case kAMdec:
+			if int(a) >= RAMSize {
+				break loop
+			}
+			v := ram[a] - 1
+			if a != KBDAddr {
+				ram[a] = v
+			}
+			a = v
+
+		case fAinc:
+			a = o.value
+			pc++
+			done++
+			fallthrough
+		case kAinc:
+			a++
+
+		case fAdec:
+			a = o.value
+			pc++
+			done++
+			fallthrough
+		case kAdec:
+			a--
+
+		case fAMm1:
+			a = o.value
+			pc++
+			done++
+			fallthrough
+		case kAMm1:
+			if int(a) >= RAMSize {
+				break loop
+			}
+			a = ram[a] - 1
+
+		case fAMp1:
+			a = o.value
+			pc++
+			done++
+			fallthrough
+		case kAMp1:
+			if int(a) >= RAMSize {
+				break loop
+			}
+			a = ram[a] + 1
+
+		case fM0:
+			a = o.value
+			pc++
+			done++
+			fallthrough
+		case kM0:
+			if int(a) >= RAMSize {
+				break loop
+			}
+			if a != KBDAddr {
+				ram[a] = 0
+			}
+
+		case fMinc:
+			a = o.value
+			pc++
+			done++
+			fallthrough
+		case kMinc:
+			if int(a) >= RAMSize {
+				break loop
+			}
+			if a != KBDAddr {
+				ram[a]++
+			}
+
+		case fMdec:
+			a = o.value
+			pc++
+			done++
+			fallthrough
+		case kMdec:
+			if int(a) >= RAMSize {
+				break loop
+			}
+			if a != KBDAddr {
+				ram[a]--
+			}
+
+		case fDJ:
+			a = o.value
+			pc++
+			done++
+			fallthrough
+		case kDJ:
+			if Jumps(d, o.jump) {
+				pc = a - 1
+			}
+
+		case fJMP:
+			a = o.value
+			pc++
+			done++
+			fallthrough
+		case kJMP:
+			pc = a - 1
+		}
+		pc++
+		done++
+	}
+	c.A, c.D, c.PC = a, d, pc
+	c.Cycles += uint64(done)
+	rest, err := c.Run(n - done)
+	return done + rest, err
+}
+
+// compute Hackの命令で使う計算を直接行う。それ以外の組み合わせはALUで計算する。
+func compute(comp, x, y uint16) uint16 {
+	switch comp {
+	case 0x2a: // 0
+		return 0
+	case 0x3f: // 1
+		return 1
+	case 0x3a: // -1
+		return 0xffff
+	case 0x0c: // D
+		return x
+	case 0x30: // A, M
+		return y
+	case 0x0d: // !D
+		return ^x
+	case 0x31: // !A, !M
+		return ^y
+	case 0x0f: // -D
+		return -x
+	case 0x33: // -A, -M
+		return -y
+	case 0x1f: // D+1
+		return x + 1
+	case 0x37: // A+1, M+1
+		return y + 1
+	case 0x0e: // D-1
+		return x - 1
+	case 0x32: // A-1, M-1
+		return y - 1
+	case 0x02: // D+A, D+M
+		return x + y
+	case 0x13: // D-A, D-M
+		return x - y
+	case 0x07: // A-D, M-D
+		return y - x
+	case 0x00: // D&A, D&M
+		return x & y
+	case 0x15: // D|A, D|M
+		return x | y
+	}
+	return ALU(x, y, comp)
+}
+
+// Engine プログラムをまとめて実行するエミュレータ。*CPUと*Fastが実装する。
+type Engine interface {
+	Run(n int) (int, error)
+}
+
+// Engines NewEngineで選べるエミュレータの名前。
+var Engines = []string{"interp", "fast"}
+
+// NewEngine 名前で選んだエミュレータでcを実行するEngineを返す。
+// interpは1命令ずつ解釈するCPU自身、fastはFast。
+func NewEngine(c *CPU, name string) (Engine, error) {
+	switch name {
+	case "interp":
+		return c, nil
+	case "fast":
+		return NewFast(c), nil
+	}
+	return nil, fmt.Errorf("unknown engine %q (want interp or fast)", name)
+}
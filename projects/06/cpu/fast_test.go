@@ -0,0 +1,152 @@
+package cpu_test
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/momotaro98/nand2tetris/assembler"
+	"github.com/momotaro98/nand2tetris/assembler/cpu"
+)
+
+func assemble(t testing.TB, src string) []uint16 {
+	t.Helper()
+	words, err := assembler.Assemble(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return words
+}
+
+func assembleFile(t testing.TB, path string) []uint16 {
+	t.Helper()
+	src, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return assemble(t, string(src))
+}
+
+// runBoth programを1命令ずつ解釈するCPUとFastでそれぞれ実行し、状態と結果が同じことを確かめる。
+// Runはchunksの大きさに区切って呼ぶ (まとめた操作の途中で区切る場合を含めるため)。
+func runBoth(t *testing.T, name string, program []uint16, ram map[int]uint16, chunks []int, total int) {
+	t.Helper()
+	interp, err := cpu.New(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fastCPU, _ := cpu.New(program)
+	for addr, v := range ram {
+		interp.RAM[addr] = v
+		fastCPU.RAM[addr] = v
+	}
+	fast := cpu.NewFast(fastCPU)
+	for done, i := 0, 0; done < total; i++ {
+		n := chunks[i%len(chunks)]
+		n1, err1 := interp.Run(n)
+		n2, err2 := fast.Run(n)
+		if n1 != n2 || fmt.Sprint(err1) != fmt.Sprint(err2) {
+			t.Fatalf("%s: Run(%d) after %d cycles: interp (%d, %v), fast (%d, %v)", name, n, done, n1, err1, n2, err2)
+		}
+		if diffs := fastCPU.Save(nil).Diff(interp.Save(nil), 5); len(diffs) > 0 {
+			t.Fatalf("%s: states differ after Run(%d) at cycle %d:\n  %s", name, n, done, strings.Join(diffs, "\n  "))
+		}
+		if err1 != nil || n1 < n {
+			return // エラーか停止
+		}
+		done += n
+	}
+}
+
+// TestFastPrograms 4章から8章のプログラムで、CPUとFastが同じ状態になることを確かめる。
+func TestFastPrograms(t *testing.T) {
+	var paths []string
+	for _, pattern := range []string{"../../04/*/*.asm", "../*/*.asm", "../../0[78]/*/*/*.asm"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, matches...)
+	}
+	if len(paths) < 15 {
+		t.Fatalf("found only %d programs", len(paths))
+	}
+	// 8章の関数のテストはスクリプトがスタックを用意するので、代わりにSPなどを設定する
+	ram := map[int]uint16{0: 256, 1: 300, 2: 400, 3: 3000, 4: 3010, 400: 10}
+	for _, path := range paths {
+		program := assembleFile(t, path)
+		runBoth(t, path, program, ram, []int{1, 2, 3, 7, 100, 4096}, 200000)
+	}
+}
+
+// TestFastForms 専用の操作にするC命令それぞれを、A命令とまとめる場合とまとめない場合について確かめる。
+func TestFastForms(t *testing.T) {
+	forms := []string{
+		"D=A", "D=M", "M=D", "A=M", "AM=M+1", "AM=M-1", "A=A+1", "A=A-1", "A=M-1", "A=M+1",
+		"M=0", "M=M+1", "M=M-1", "D;JGT", "D;JEQ", "D;JLT", "0;JMP", "D=D+M", "MD=M-D", "AMD=!M", "M=D|A;JNE",
+	}
+	for _, form := range forms {
+		for _, addr := range []int{5, 100, 24576, 24577, 32767} {
+			// まとめる場合 (@addr の直後) とまとめない場合 (D=D の後)
+			src := fmt.Sprintf("@%d\nD=A\n@%d\n%s\nD=D\n%s\n@20\n0;JMP\n", addr-1, addr, form, form)
+			ram := map[int]uint16{5: 7, 6: 0xffff, 100: 3, 24576: 65}
+			for _, chunk := range []int{1, 2, 3, 1000} {
+				runBoth(t, form, assemble(t, src), ram, []int{chunk}, 40)
+			}
+		}
+	}
+}
+
+// TestFastRandom でたらめなプログラムで、メモリ範囲外へのアクセスで止まる場合も含めて比べる。
+func TestFastRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	values := []uint16{0, 1, 2, 3, 16, 17, 24575, 24576, 24577, 30000, 32767}
+	for i := 0; i < 300; i++ {
+		program := make([]uint16, 64)
+		for pc := range program {
+			switch rng.Intn(3) {
+			case 0:
+				if rng.Intn(2) == 0 {
+					program[pc] = values[rng.Intn(len(values))]
+				} else {
+					program[pc] = uint16(rng.Intn(len(program) + 4))
+				}
+			default:
+				// 使われない2ビットも含めてでたらめなC命令
+				program[pc] = 0x8000 | uint16(rng.Intn(0x8000))
+			}
+		}
+		ram := map[int]uint16{}
+		for j := 0; j < 20; j++ {
+			ram[rng.Intn(32)] = uint16(rng.Intn(0x10000))
+		}
+		runBoth(t, fmt.Sprintf("random %d", i), program, ram, []int{1 + rng.Intn(9), 2, 50}, 3000)
+	}
+}
+
+// BenchmarkPong 本書のPong (../pong/Pong.asm) を各エミュレータで実行する。1命令を1回と数える。
+// projects/11 のコンパイラの出力はアセンブルできないため、同じゲームの本書のビルドを使う。
+func BenchmarkPong(b *testing.B) {
+	program := assembleFile(b, "../pong/Pong.asm")
+	for _, name := range cpu.Engines {
+		b.Run(name, func(b *testing.B) {
+			c, err := cpu.New(program)
+			if err != nil {
+				b.Fatal(err)
+			}
+			engine, err := cpu.NewEngine(c, name)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			n, err := engine.Run(b.N)
+			if err != nil || n != b.N {
+				b.Fatalf("ran %d of %d cycles: %v", n, b.N, err)
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "inst/s")
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package cpu
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// KeyEvent キー入力の予定。Cycleサイクル目の命令を実行する前にKeyを押した状態にする。
+// Keyが0の場合はキーを離す。
+type KeyEvent struct {
+	Cycle uint64
+	Key   uint16
+}
+
+// keyNames Hackの特殊キーのコード。
+var keyNames = map[string]uint16{
+	"space": ' ', "newline": 128, "enter": 128, "backspace": 129,
+	"left": 130, "up": 131, "right": 132, "down": 133,
+	"home": 134, "end": 135, "pageup": 136, "pagedown": 137,
+	"insert": 138, "delete": 139, "esc": 140, "none": 0,
+}
+
+func init() {
+	for i := 1; i <= 12; i++ {
+		keyNames["f"+strconv.Itoa(i)] = uint16(140 + i)
+	}
+}
+
+// ParseKey キーの指定を解釈する。数値ならそのままキーコード(0は離す)、数字以外の1文字ならその文字、
+// それ以外はleft, space, f1などのキー名 (大文字小文字は区別しない)。
+func ParseKey(s string) (uint16, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 || n > 0x7fff {
+			return 0, fmt.Errorf("invalid key code %q", s)
+		}
+		return uint16(n), nil
+	}
+	if len(s) == 1 {
+		return uint16(s[0]), nil
+	}
+	if k, ok := keyNames[strings.ToLower(s)]; ok {
+		return k, nil
+	}
+	return 0, fmt.Errorf("unknown key %q", s)
+}
+
+// ParseKeyTimeline "サイクル=キー"をカンマ, 空白または改行で区切って並べたキー入力の予定を解釈する。
+// '#'から行末まではコメント。結果はサイクル順に並べる。
+//
+//	1000=right 5000=none  # 1000サイクル目から右を押し、5000サイクル目に離す
+func ParseKeyTimeline(s string) ([]KeyEvent, error) {
+	var events []KeyEvent
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.SplitN(line, "#", 2)[0]
+		for _, f := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\r' }) {
+			cs, ks, found := strings.Cut(f, "=")
+			cycle, err := strconv.ParseUint(cs, 10, 64)
+			if !found || err != nil {
+				return nil, fmt.Errorf("invalid key event %q: want CYCLE=KEY", f)
+			}
+			key, err := ParseKey(ks)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, KeyEvent{Cycle: cycle, Key: key})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Cycle < events[j].Cycle })
+	return events, nil
+}
+
+// FormatKeyTimeline キー入力の予定をParseKeyTimelineで読める形式にする。キーは数値のコードで書く。
+func FormatKeyTimeline(events []KeyEvent) string {
+	var sb strings.Builder
+	for _, e := range events {
+		fmt.Fprintf(&sb, "%d=%d\n", e.Cycle, e.Key)
+	}
+	return sb.String()
+}
+
+// ApplyKeys eventsのうち現在のサイクル数までに予定された入力をキーボードに反映し、
+// 残りの予定を返す。eventsはサイクル順に並んでいること。
+func (c *CPU) ApplyKeys(events []KeyEvent) []KeyEvent {
+	for len(events) > 0 && events[0].Cycle <= c.Cycles {
+		c.SetKey(events[0].Key)
+		events = events[1:]
+	}
+	return events
+}
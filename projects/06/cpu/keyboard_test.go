@@ -0,0 +1,70 @@
+package cpu
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		s    string
+		want uint16
+		err  string
+	}{
+		{"65", 65, ""},
+		{"0", 0, ""},
+		{"a", 'a', ""},
+		{"7", 7, ""}, // 1文字の数字はキーコード
+		{"Left", 130, ""},
+		{"space", ' ', ""},
+		{"ENTER", 128, ""},
+		{"f12", 152, ""},
+		{"none", 0, ""},
+		{"-1", 0, `invalid key code "-1"`},
+		{"32768", 0, `invalid key code "32768"`},
+		{"shift", 0, `unknown key "shift"`},
+	}
+	for _, tt := range tests {
+		got, err := ParseKey(tt.s)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("ParseKey(%q): got %v, want %q", tt.s, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseKey(%q) = %d, %v, want %d", tt.s, got, err, tt.want)
+		}
+	}
+}
+
+func TestKeyTimeline(t *testing.T) {
+	events, err := ParseKeyTimeline("5000=none, 1000=right # 右を押して離す\n\n  20=x\t30=13\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []KeyEvent{{20, 'x'}, {30, 13}, {1000, 132}, {5000, 0}}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got %v, want %v", events, want)
+	}
+	again, err := ParseKeyTimeline(FormatKeyTimeline(events))
+	if err != nil || !reflect.DeepEqual(again, events) {
+		t.Errorf("round trip: %v, %v", again, err)
+	}
+	for _, bad := range []string{"1000", "x=a", "10=nokey"} {
+		if _, err := ParseKeyTimeline(bad); err == nil {
+			t.Errorf("ParseKeyTimeline(%q): want an error", bad)
+		}
+	}
+
+	c, _ := New(nil)
+	c.Cycles = 30
+	rest := c.ApplyKeys(events)
+	if c.RAM[KBDAddr] != 13 || !reflect.DeepEqual(rest, events[2:]) {
+		t.Errorf("after cycle 30: KBD=%d, rest %v", c.RAM[KBDAddr], rest)
+	}
+	c.Cycles = 6000
+	if rest = c.ApplyKeys(rest); c.RAM[KBDAddr] != 0 || len(rest) != 0 {
+		t.Errorf("after cycle 6000: KBD=%d, rest %v", c.RAM[KBDAddr], rest)
+	}
+}
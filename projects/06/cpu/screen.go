@@ -0,0 +1,118 @@
+package cpu
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+)
+
+const (
+	ScreenWidth  = 512 // スクリーンの横のピクセル数
+	ScreenHeight = 256 // スクリーンの縦のピクセル数
+)
+
+// Pixel スクリーンの(x, y)のピクセルが黒かを返す。
+// 各行は32ワードで、ワードの最下位ビットが左端のピクセルになる。
+func (c *CPU) Pixel(x, y int) bool {
+	w := c.RAM[ScreenAddr+y*ScreenWidth/16+x/16]
+	return w>>(x%16)&1 != 0
+}
+
+// ScreenImage スクリーンを白黒の画像にする。
+func (c *CPU) ScreenImage() *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, ScreenWidth, ScreenHeight), color.Palette{color.White, color.Black})
+	for y := 0; y < ScreenHeight; y++ {
+		for x := 0; x < ScreenWidth; x++ {
+			if c.Pixel(x, y) {
+				img.Pix[y*img.Stride+x] = 1
+			}
+		}
+	}
+	return img
+}
+
+// WritePNG スクリーンをPNGで書き出す。
+func (c *CPU) WritePNG(w io.Writer) error {
+	return png.Encode(w, c.ScreenImage())
+}
+
+// WritePBM スクリーンをバイナリPBM(P4)で書き出す。PBMでは1が黒で、上位ビットが左になる。
+func (c *CPU) WritePBM(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "P4\n%d %d\n", ScreenWidth, ScreenHeight)
+	for y := 0; y < ScreenHeight; y++ {
+		for x := 0; x < ScreenWidth; x += 8 {
+			var b byte
+			for i := 0; i < 8; i++ {
+				if c.Pixel(x+i, y) {
+					b |= 0x80 >> i
+				}
+			}
+			bw.WriteByte(b)
+		}
+	}
+	return bw.Flush()
+}
+
+// ScreenASCII スクリーンを文字で表す。1文字がscale×2scaleピクセルに対応し、
+// 黒いピクセルの割合に応じて ' ', '.', '+', '#' を使う。
+func (c *CPU) ScreenASCII(scale int) string {
+	if scale < 1 {
+		scale = 1
+	}
+	cw, ch := scale, 2*scale
+	var sb strings.Builder
+	for y := 0; y < ScreenHeight; y += ch {
+		for x := 0; x < ScreenWidth; x += cw {
+			// 端で欠けた範囲はスクリーン内のピクセルだけで割合を求める
+			n, total := 0, 0
+			for dy := 0; dy < ch && y+dy < ScreenHeight; dy++ {
+				for dx := 0; dx < cw && x+dx < ScreenWidth; dx++ {
+					total++
+					if c.Pixel(x+dx, y+dy) {
+						n++
+					}
+				}
+			}
+			switch {
+			case n == 0:
+				sb.WriteByte(' ')
+			case n*3 < total:
+				sb.WriteByte('.')
+			case n*3 < total*2:
+				sb.WriteByte('+')
+			default:
+				sb.WriteByte('#')
+			}
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// brailleDots 点字の各点(2×4)に対応するビット。[y][x]
+var brailleDots = [4][2]rune{{0x01, 0x08}, {0x02, 0x10}, {0x04, 0x20}, {0x40, 0x80}}
+
+// ScreenBraille スクリーンを点字で表す。1文字が2×4ピクセルに対応し、縮小せずに表示できる。
+func (c *CPU) ScreenBraille() string {
+	var sb strings.Builder
+	for y := 0; y < ScreenHeight; y += 4 {
+		for x := 0; x < ScreenWidth; x += 2 {
+			r := rune(0x2800)
+			for dy := 0; dy < 4; dy++ {
+				for dx := 0; dx < 2; dx++ {
+					if c.Pixel(x+dx, y+dy) {
+						r |= brailleDots[dy][dx]
+					}
+				}
+			}
+			sb.WriteRune(r)
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
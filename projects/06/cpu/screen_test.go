@@ -0,0 +1,99 @@
+package cpu
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// dots (0, 0) と (31, 1) を黒にしたCPUを返す。
+func dots(t *testing.T) *CPU {
+	t.Helper()
+	c, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.RAM[ScreenAddr] = 0x0001      // 最下位ビットが左端
+	c.RAM[ScreenAddr+32+1] = 0x8000 // 2行目の2ワード目の右端
+	return c
+}
+
+func TestPixel(t *testing.T) {
+	c := dots(t)
+	for _, p := range [][2]int{{0, 0}, {31, 1}} {
+		if !c.Pixel(p[0], p[1]) {
+			t.Errorf("(%d, %d) should be black", p[0], p[1])
+		}
+	}
+	for _, p := range [][2]int{{1, 0}, {15, 0}, {0, 1}, {16, 1}, {31, 0}, {511, 255}} {
+		if c.Pixel(p[0], p[1]) {
+			t.Errorf("(%d, %d) should be white", p[0], p[1])
+		}
+	}
+}
+
+func TestWritePNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := dots(t).WritePNG(&buf); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != ScreenWidth || b.Dy() != ScreenHeight {
+		t.Fatalf("bounds %v", b)
+	}
+	black := func(x, y int) bool { r, _, _, _ := img.At(x, y).RGBA(); return r == 0 }
+	if !black(0, 0) || !black(31, 1) || black(1, 0) {
+		t.Error("pixels differ from the screen")
+	}
+}
+
+func TestWritePBM(t *testing.T) {
+	var buf bytes.Buffer
+	if err := dots(t).WritePBM(&buf); err != nil {
+		t.Fatal(err)
+	}
+	header := "P4\n512 256\n"
+	b := buf.Bytes()
+	if !bytes.HasPrefix(b, []byte(header)) || len(b) != len(header)+ScreenWidth/8*ScreenHeight {
+		t.Fatalf("header %q, %d bytes", b[:len(header)], len(b))
+	}
+	data := b[len(header):]
+	// PBMは上位ビットが左
+	if data[0] != 0x80 || data[64+3] != 0x01 || bytes.Count(data, []byte{0}) != len(data)-2 {
+		t.Errorf("data[0]=%#x, data[67]=%#x", data[0], data[67])
+	}
+}
+
+func TestScreenText(t *testing.T) {
+	c := dots(t)
+	// 1文字で256×512ピクセル (スクリーンの左半分) を表す
+	if got := c.ScreenASCII(256); got != ". \n" {
+		t.Errorf("ascii %q", got)
+	}
+	if got := c.ScreenASCII(0); strings.Count(got, "\n") != ScreenHeight/2 || !strings.HasPrefix(got, "+ ") {
+		t.Errorf("ascii with scale 0 (treated as 1) starts with %q", got[:4])
+	}
+	for i := range c.RAM[ScreenAddr:KBDAddr] {
+		c.RAM[ScreenAddr+i] = 0xffff
+	}
+	// 3×6の文字では最後の行が4ピクセルしかない
+	if got := c.ScreenASCII(3); !strings.HasSuffix(got, strings.Repeat("#", 171)+"\n") {
+		t.Errorf("ascii of a black screen ends with %q", got[len(got)-8:])
+	}
+	if got := c.ScreenASCII(256); got != "##\n" {
+		t.Errorf("ascii of a black screen %q", got)
+	}
+
+	lines := strings.Split(dots(t).ScreenBraille(), "\n")
+	if len(lines) != ScreenHeight/4+1 || len([]rune(lines[0])) != ScreenWidth/2 {
+		t.Fatalf("braille is %d lines of %d chars", len(lines), len([]rune(lines[0])))
+	}
+	row := []rune(lines[0])
+	if row[0] != 0x2801 || row[15] != 0x2810 || row[1] != 0x2800 {
+		t.Errorf("braille %U %U %U", row[0], row[1], row[15])
+	}
+}
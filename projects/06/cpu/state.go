@@ -0,0 +1,149 @@
+package cpu
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// stateMagic 状態ファイルの先頭に置く識別子と版。
+const stateMagic = "HACKSTATE\x01"
+
+// maxStateKeys 状態ファイルから読むキー入力の予定の上限 (壊れたファイルで巨大な領域を確保しないため)。
+const maxStateKeys = 1 << 20
+
+// ErrROMMismatch 状態を保存したときとROMの内容が異なる。
+var ErrROMMismatch = errors.New("cpu: state was saved with a different program")
+
+// State マシンの状態のスナップショット。ROMはハッシュだけを持つ。
+type State struct {
+	ROMHash [sha256.Size]byte
+	A       uint16
+	D       uint16
+	PC      uint16
+	Cycles  uint64
+	RAM     [RAMSize]uint16 // キーボードの状態を含む
+	Keys    []KeyEvent      // まだ反映していないキー入力の予定
+}
+
+// ROMHash 読み込んだプログラムのSHA-256ハッシュを返す。
+func (c *CPU) ROMHash() [sha256.Size]byte {
+	b := make([]byte, 2*c.Size)
+	for i, w := range c.ROM[:c.Size] {
+		binary.BigEndian.PutUint16(b[2*i:], w)
+	}
+	return sha256.Sum256(b)
+}
+
+// Save 現在の状態を返す。keysはまだ反映していないキー入力の予定。
+func (c *CPU) Save(keys []KeyEvent) *State {
+	return &State{
+		ROMHash: c.ROMHash(),
+		A:       c.A,
+		D:       c.D,
+		PC:      c.PC,
+		Cycles:  c.Cycles,
+		RAM:     c.RAM,
+		Keys:    append([]KeyEvent(nil), keys...),
+	}
+}
+
+// Restore sの状態に戻す。ROMが保存したときと異なる場合はErrROMMismatchを返し、状態を変更しない。
+func (c *CPU) Restore(s *State) error {
+	if c.ROMHash() != s.ROMHash {
+		return ErrROMMismatch
+	}
+	c.A, c.D, c.PC = s.A, s.D, s.PC
+	c.Cycles = s.Cycles
+	c.RAM = s.RAM
+	return nil
+}
+
+// stateHeader 状態ファイルの固定長部分。
+type stateHeader struct {
+	ROMHash [sha256.Size]byte
+	A       uint16
+	D       uint16
+	PC      uint16
+	Cycles  uint64
+	NumKeys uint32
+}
+
+// Write 状態をgzipで圧縮したバイナリ形式で書き出す。
+// ほとんどが0のRAMはよく縮むので、Pongの途中の状態でも数KBになる。
+func (s *State) Write(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+	bw.WriteString(stateMagic)
+	h := stateHeader{s.ROMHash, s.A, s.D, s.PC, s.Cycles, uint32(len(s.Keys))}
+	for _, v := range []any{h, s.RAM, s.Keys} {
+		if err := binary.Write(bw, binary.BigEndian, v); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// ReadState Writeで書き出した状態を読み込む。
+func ReadState(r io.Reader) (*State, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid state file: %w", err)
+	}
+	br := bufio.NewReader(zr)
+	magic := make([]byte, len(stateMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != stateMagic {
+		return nil, errors.New("invalid state file: bad header")
+	}
+	var h stateHeader
+	if err := binary.Read(br, binary.BigEndian, &h); err != nil {
+		return nil, fmt.Errorf("invalid state file: %w", err)
+	}
+	s := &State{ROMHash: h.ROMHash, A: h.A, D: h.D, PC: h.PC, Cycles: h.Cycles}
+	if err := binary.Read(br, binary.BigEndian, &s.RAM); err != nil {
+		return nil, fmt.Errorf("invalid state file: %w", err)
+	}
+	if h.NumKeys > maxStateKeys {
+		return nil, fmt.Errorf("invalid state file: too many key events (%d)", h.NumKeys)
+	}
+	if h.NumKeys > 0 {
+		s.Keys = make([]KeyEvent, h.NumKeys)
+		if err := binary.Read(br, binary.BigEndian, s.Keys); err != nil {
+			return nil, fmt.Errorf("invalid state file: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// Diff sとtで異なるレジスタとRAMを、最大n個まで "RAM[16384]: 0 != 255" の形式で返す。
+// 同じであれば空を返す。キー入力の予定は比べない。
+func (s *State) Diff(t *State, n int) []string {
+	var diffs []string
+	if s.ROMHash != t.ROMHash {
+		diffs = append(diffs, "ROM differs")
+	}
+	for _, r := range []struct {
+		name string
+		a, b uint64
+	}{{"cycles", s.Cycles, t.Cycles}, {"PC", uint64(s.PC), uint64(t.PC)}, {"A", uint64(s.A), uint64(t.A)}, {"D", uint64(s.D), uint64(t.D)}} {
+		if r.a != r.b {
+			diffs = append(diffs, fmt.Sprintf("%s: %d != %d", r.name, r.a, r.b))
+		}
+	}
+	for i := range s.RAM {
+		if s.RAM[i] != t.RAM[i] {
+			diffs = append(diffs, fmt.Sprintf("RAM[%d]: %d != %d", i, int16(s.RAM[i]), int16(t.RAM[i])))
+		}
+		if len(diffs) >= n {
+			return diffs[:n]
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,107 @@
+package cpu
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSaveRestore(t *testing.T) {
+	program := []uint16{0x0007, 0xec10, 0x0000, 0xe308, 0x0004, 0xea87} // @7 D=A @0 M=D (END) @4 0;JMP
+	c, _ := New(program)
+	c.Run(2)
+	keys := []KeyEvent{{100, 'a'}, {200, 0}}
+	s := c.Save(keys)
+	keys[0].Key = 'b' // 保存した予定は呼び出し元と共有しない
+
+	c.Run(10)
+	c.RAM[20] = 99
+	if err := c.Restore(s); err != nil {
+		t.Fatal(err)
+	}
+	if c.PC != 2 || c.A != 7 || c.D != 7 || c.Cycles != 2 || c.RAM[0] != 0 || c.RAM[20] != 0 {
+		t.Errorf("restored PC=%d A=%d D=%d cycles=%d RAM[0]=%d RAM[20]=%d", c.PC, c.A, c.D, c.Cycles, c.RAM[0], c.RAM[20])
+	}
+	if s.Keys[0].Key != 'a' {
+		t.Errorf("saved keys %v", s.Keys)
+	}
+
+	other, _ := New(program[:4])
+	if err := other.Restore(s); !errors.Is(err, ErrROMMismatch) || other.Cycles != 0 {
+		t.Errorf("restore into another program: %v, cycles=%d", err, other.Cycles)
+	}
+}
+
+func TestStateFile(t *testing.T) {
+	c, _ := New([]uint16{0x0007, 0xec10})
+	c.Run(2)
+	c.RAM[ScreenAddr] = 0xffff
+	c.SetKey(131)
+	for _, keys := range [][]KeyEvent{nil, {{10, 'a'}, {20, 0}}} {
+		s := c.Save(keys)
+		var buf bytes.Buffer
+		if err := s.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadState(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, s) {
+			t.Errorf("keys %v: read state differs: %v", keys, got.Diff(s, 5))
+		}
+	}
+
+	gz := func(data string) *bytes.Buffer {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(data))
+		zw.Close()
+		return &buf
+	}
+	var full bytes.Buffer
+	c.Save(nil).Write(&full)
+	truncated := full.Bytes()[:full.Len()/2]
+	tests := []struct {
+		name string
+		data *bytes.Buffer
+		want string
+	}{
+		{"not gzip", bytes.NewBufferString("HACKSTATE"), "invalid state file: "},
+		{"bad magic", gz("HACKSTATE\x02"), "invalid state file: bad header"},
+		{"short header", gz(stateMagic + "abc"), "invalid state file: "},
+		{"too many keys", gz(stateMagic + strings.Repeat("\x00", 32+2+2+2+8) + "\xff\xff\xff\xff" + strings.Repeat("\x00", 2*RAMSize)), "too many key events (4294967295)"},
+		{"truncated", bytes.NewBuffer(truncated), "invalid state file: "},
+	}
+	for _, tt := range tests {
+		if _, err := ReadState(tt.data); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestStateDiff(t *testing.T) {
+	c, _ := New([]uint16{0x0007})
+	a := c.Save(nil)
+	if d := a.Diff(c.Save(nil), 10); len(d) != 0 {
+		t.Errorf("same state: %v", d)
+	}
+	c.Step()
+	c.RAM[16384] = 255
+	c.RAM[5] = 0xffff
+	b := c.Save([]KeyEvent{{1, 'x'}}) // キー入力の予定は比べない
+	want := []string{"cycles: 0 != 1", "PC: 0 != 1", "A: 0 != 7", "RAM[5]: 0 != -1", "RAM[16384]: 0 != 255"}
+	if d := a.Diff(b, 10); !reflect.DeepEqual(d, want) {
+		t.Errorf("got %v, want %v", d, want)
+	}
+	if d := a.Diff(b, 2); !reflect.DeepEqual(d, want[:2]) {
+		t.Errorf("limited to 2: %v", d)
+	}
+	other, _ := New([]uint16{0x0008})
+	if d := a.Diff(other.Save(nil), 10); !reflect.DeepEqual(d, []string{"ROM differs"}) {
+		t.Errorf("other program: %v", d)
+	}
+}
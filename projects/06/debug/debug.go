@@ -0,0 +1,589 @@
+// Package debug はHack CPUエミュレータ上でプログラムを1命令ずつ調べるデバッガを提供する。
+//
+// コマンドは1行ずつExecに渡す。端末からの対話的な操作にも、
+// コマンドを並べたファイルによる自動実行にも使える。
+package debug
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/momotaro98/nand2tetris/assembler"
+	"github.com/momotaro98/nand2tetris/assembler/cpu"
+)
+
+// stackBase VM実装のスタックの先頭アドレス。
+const stackBase = 256
+
+// DefaultMaxCycles continue, untilで止まらない場合に実行を打ち切るサイクル数。
+const DefaultMaxCycles = 10000000
+
+// ErrQuit quitコマンドを実行したことを表す。
+var ErrQuit = errors.New("quit")
+
+// Debugger 1つのプログラムのデバッグ状態。
+type Debugger struct {
+	CPU       *cpu.CPU
+	MaxCycles uint64 // continue, untilの打ち切りサイクル数
+
+	name    string
+	symbols map[string]assembler.Symbol
+	labels  []assembler.Symbol // アドレス順
+	listing map[int]assembler.ListingEntry
+	breaks  []*breakpoint
+	watches []*watchpoint
+	nextID  int
+}
+
+type breakpoint struct {
+	id   int
+	addr int
+}
+
+type watchpoint struct {
+	id   int
+	addr int
+	old  uint16 // 最後に見た値
+}
+
+// New cでprogramを実行するデバッガを返す。
+// resがあればシンボルとリスティングを使って位置をラベルやソース行で表示する。
+// nameはリスティングのファイル名が空の(アセンブルしたファイル自身の)行に表示する名前。
+func New(c *cpu.CPU, name string, res *assembler.Result) *Debugger {
+	d := &Debugger{
+		CPU:       c,
+		MaxCycles: DefaultMaxCycles,
+		name:      name,
+		symbols:   make(map[string]assembler.Symbol),
+		listing:   make(map[int]assembler.ListingEntry),
+		nextID:    1,
+	}
+	if res != nil {
+		for _, sym := range res.Symbols {
+			d.symbols[sym.Name] = sym
+			if sym.Kind == assembler.Label {
+				d.labels = append(d.labels, sym)
+			}
+		}
+		sort.SliceStable(d.labels, func(i, j int) bool { return d.labels[i].Address < d.labels[j].Address })
+		for _, e := range res.Listing() {
+			d.listing[e.Address] = e
+		}
+	}
+	return d
+}
+
+// Exec 1行のコマンドを実行し、結果をwに書く。quitの場合はErrQuitを返す。
+func (d *Debugger) Exec(line string, w io.Writer) error {
+	f := strings.Fields(line)
+	if len(f) == 0 {
+		return nil
+	}
+	cmd, args := f[0], f[1:]
+	switch cmd {
+	case "help", "h", "?":
+		fmt.Fprint(w, help)
+	case "quit", "q":
+		return ErrQuit
+	case "break", "b":
+		return d.addBreak(args, w)
+	case "watch", "w":
+		return d.addWatch(args, w)
+	case "delete", "d":
+		return d.delete(args, w)
+	case "info", "i":
+		return d.info(args, w)
+	case "step", "s", "stepi", "si":
+		n, err := count(args, 1)
+		if err != nil {
+			return err
+		}
+		return d.run(w, uint64(n), -1, false)
+	case "continue", "c":
+		return d.run(w, d.MaxCycles, -1, true)
+	case "until", "u":
+		if len(args) != 1 {
+			return errors.New("usage: until <address|label>")
+		}
+		addr, err := d.romAddr(args[0])
+		if err != nil {
+			return err
+		}
+		return d.run(w, d.MaxCycles, addr, true)
+	case "regs", "r":
+		d.regs(w)
+	case "stack", "bt":
+		n, err := count(args, 10)
+		if err != nil {
+			return err
+		}
+		d.stack(w, n)
+	case "x", "mem":
+		return d.mem(args, w)
+	case "list", "l":
+		return d.list(args, w)
+	case "where":
+		d.where(w)
+	case "set":
+		return d.set(args, w)
+	case "reset":
+		d.CPU.Reset()
+		d.resetWatches()
+		d.where(w)
+	case "save":
+		if len(args) != 1 {
+			return errors.New("usage: save <file>")
+		}
+		return d.save(args[0], w)
+	case "load":
+		if len(args) != 1 {
+			return errors.New("usage: load <file>")
+		}
+		return d.load(args[0], w)
+	default:
+		return fmt.Errorf("unknown command %q (try help)", cmd)
+	}
+	return nil
+}
+
+// resetWatches ウォッチポイントの値を現在のRAMに合わせる。
+func (d *Debugger) resetWatches() {
+	for _, wp := range d.watches {
+		wp.old = d.CPU.RAM[wp.addr]
+	}
+}
+
+// save 状態をファイルに保存する。
+func (d *Debugger) save(path string, w io.Writer) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := d.CPU.Save(nil).Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "saved cycle %d to %s\n", d.CPU.Cycles, path)
+	return nil
+}
+
+// load ファイルに保存した状態に戻す。
+func (d *Debugger) load(path string, w io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s, err := cpu.ReadState(f)
+	if err != nil {
+		return err
+	}
+	if err := d.CPU.Restore(s); err != nil {
+		return err
+	}
+	d.resetWatches()
+	d.where(w)
+	return nil
+}
+
+const help = `commands:
+  break|b <addr|label>      stop before executing the instruction at a ROM address
+  watch|w <addr|symbol>     stop when a RAM word (e.g. SP, LCL, ARG, RAM[300], a variable) changes
+  delete|d [id]             delete a breakpoint or watchpoint (all without id)
+  info|i break|watch        list breakpoints or watchpoints
+  step|s [n]                execute n instructions (default 1)
+  continue|c                run until a breakpoint, a watchpoint or the final infinite loop
+  until|u <addr|label>      run until the PC reaches the address
+  regs|r                    show PC, A, D, M and the cycle count
+  stack|bt [n]              show SP, LCL, ARG, THIS, THAT and the top n stack words
+  x|mem <addr|symbol> [n]   dump n RAM words
+  list|l [addr|label] [n]   show the source around an address (default: PC)
+  where                     show the current instruction
+  set <A|D|PC|addr|symbol> <value>
+  reset                     reset registers and RAM
+  save <file>               save registers, RAM and the cycle count (load with -run -load-state too)
+  load <file>               restore a state saved by save or -save-state
+  quit|q
+`
+
+func count(args []string, def int) (int, error) {
+	if len(args) == 0 {
+		return def, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid count %q", args[0])
+	}
+	return n, nil
+}
+
+// run 最大limitサイクル実行する。ブレークポイント, ウォッチポイント, untilの位置で止まる。
+// stopAtHaltの場合は終端の無限ループに入ったところで止まる。
+func (d *Debugger) run(w io.Writer, limit uint64, until int, stopAtHalt bool) error {
+	i := uint64(0)
+	for ; i < limit; i++ {
+		if stopAtHalt && d.CPU.IsHalted() {
+			fmt.Fprintln(w, "program halted")
+			break
+		}
+		if err := d.CPU.Step(); err != nil {
+			d.where(w)
+			return err
+		}
+		if d.checkWatches(w) {
+			break
+		}
+		pc := int(d.CPU.PC)
+		if b := d.breakAt(pc); b != nil {
+			fmt.Fprintf(w, "breakpoint %d, %s\n", b.id, d.describe(pc))
+			break
+		}
+		if pc == until {
+			break
+		}
+	}
+	if i == limit && stopAtHalt {
+		fmt.Fprintf(w, "stopped after %d cycles\n", limit)
+	}
+	d.where(w)
+	return nil
+}
+
+// checkWatches 値が変わったウォッチポイントを表示し、1つでもあればtrueを返す。
+func (d *Debugger) checkWatches(w io.Writer) bool {
+	hit := false
+	for _, wp := range d.watches {
+		v := d.CPU.RAM[wp.addr]
+		if v == wp.old {
+			continue
+		}
+		fmt.Fprintf(w, "watchpoint %d: %s: %d -> %d\n", wp.id, d.ramName(wp.addr), int16(wp.old), int16(v))
+		wp.old = v
+		hit = true
+	}
+	return hit
+}
+
+func (d *Debugger) breakAt(pc int) *breakpoint {
+	for _, b := range d.breaks {
+		if b.addr == pc {
+			return b
+		}
+	}
+	return nil
+}
+
+func (d *Debugger) addBreak(args []string, w io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("usage: break <address|label>")
+	}
+	addr, err := d.romAddr(args[0])
+	if err != nil {
+		return err
+	}
+	b := &breakpoint{id: d.nextID, addr: addr}
+	d.nextID++
+	d.breaks = append(d.breaks, b)
+	fmt.Fprintf(w, "breakpoint %d at %s\n", b.id, d.describe(addr))
+	return nil
+}
+
+func (d *Debugger) addWatch(args []string, w io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("usage: watch <address|symbol>")
+	}
+	addr, err := d.ramAddr(args[0])
+	if err != nil {
+		return err
+	}
+	wp := &watchpoint{id: d.nextID, addr: addr, old: d.CPU.RAM[addr]}
+	d.nextID++
+	d.watches = append(d.watches, wp)
+	fmt.Fprintf(w, "watchpoint %d: %s = %d\n", wp.id, d.ramName(addr), int16(wp.old))
+	return nil
+}
+
+func (d *Debugger) delete(args []string, w io.Writer) error {
+	if len(args) == 0 {
+		d.breaks, d.watches = nil, nil
+		fmt.Fprintln(w, "deleted all breakpoints and watchpoints")
+		return nil
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid id %q", args[0])
+	}
+	for i, b := range d.breaks {
+		if b.id == id {
+			d.breaks = append(d.breaks[:i], d.breaks[i+1:]...)
+			return nil
+		}
+	}
+	for i, wp := range d.watches {
+		if wp.id == id {
+			d.watches = append(d.watches[:i], d.watches[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no breakpoint or watchpoint %d", id)
+}
+
+func (d *Debugger) info(args []string, w io.Writer) error {
+	what := ""
+	if len(args) > 0 {
+		what = args[0]
+	}
+	switch what {
+	case "break", "b", "":
+		for _, b := range d.breaks {
+			fmt.Fprintf(w, "breakpoint %d at %s\n", b.id, d.describe(b.addr))
+		}
+		if what != "" {
+			return nil
+		}
+		fallthrough
+	case "watch", "w":
+		for _, wp := range d.watches {
+			fmt.Fprintf(w, "watchpoint %d: %s = %d\n", wp.id, d.ramName(wp.addr), int16(d.CPU.RAM[wp.addr]))
+		}
+	default:
+		return fmt.Errorf("usage: info break|watch")
+	}
+	return nil
+}
+
+// regs レジスタを表示する。
+func (d *Debugger) regs(w io.Writer) {
+	c := d.CPU
+	fmt.Fprintf(w, "PC=%d A=%d D=%d", c.PC, int16(c.A), int16(c.D))
+	if int(c.A) < cpu.RAMSize {
+		fmt.Fprintf(w, " M=%d", int16(c.RAM[c.A]))
+	}
+	fmt.Fprintf(w, " cycles=%d\n", c.Cycles)
+}
+
+// stack VM実装のポインタとスタックの上からn語を表示する。
+func (d *Debugger) stack(w io.Writer, n int) {
+	ram := &d.CPU.RAM
+	fmt.Fprintf(w, "SP=%d LCL=%d ARG=%d THIS=%d THAT=%d\n", ram[0], ram[1], ram[2], ram[3], ram[4])
+	sp := int(ram[0])
+	if sp <= stackBase || sp > cpu.ScreenAddr {
+		fmt.Fprintln(w, "(stack is empty)")
+		return
+	}
+	lo := sp - n
+	if lo < stackBase {
+		lo = stackBase
+	}
+	for addr := sp - 1; addr >= lo; addr-- {
+		var marks []string
+		for i, name := range []string{"LCL", "ARG", "THIS", "THAT"} {
+			if int(ram[i+1]) == addr {
+				marks = append(marks, name)
+			}
+		}
+		fmt.Fprintf(w, "  RAM[%d] = %d", addr, int16(ram[addr]))
+		if addr == sp-1 {
+			marks = append([]string{"top"}, marks...)
+		}
+		if len(marks) > 0 {
+			fmt.Fprintf(w, "  <- %s", strings.Join(marks, ", "))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// mem RAMの内容を表示する。
+func (d *Debugger) mem(args []string, w io.Writer) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("usage: x <address|symbol> [count]")
+	}
+	addr, err := d.ramAddr(args[0])
+	if err != nil {
+		return err
+	}
+	n, err := count(args[1:], 1)
+	if err != nil {
+		return err
+	}
+	for a := addr; a < addr+n && a < cpu.RAMSize; a++ {
+		fmt.Fprintf(w, "%s = %d\n", d.ramName(a), int16(d.CPU.RAM[a]))
+	}
+	return nil
+}
+
+// list アドレスの前後のソースを表示する。=>は現在のPC, *はブレークポイント。
+func (d *Debugger) list(args []string, w io.Writer) error {
+	center := int(d.CPU.PC)
+	if len(args) > 0 {
+		addr, err := d.romAddr(args[0])
+		if err != nil {
+			return err
+		}
+		center = addr
+	}
+	var rest []string
+	if len(args) > 1 {
+		rest = args[1:]
+	}
+	n, err := count(rest, 10)
+	if err != nil {
+		return err
+	}
+	lo := center - n/2
+	if lo < 0 {
+		lo = 0
+	}
+	for addr := lo; addr < lo+n && addr < cpu.ROMSize; addr++ {
+		if label := d.labelAt(addr); label != "" {
+			fmt.Fprintf(w, "          (%s)\n", label)
+		}
+		mark := "  "
+		if addr == int(d.CPU.PC) {
+			mark = "=>"
+		}
+		if d.breakAt(addr) != nil {
+			mark = mark[:1] + "*"
+		}
+		fmt.Fprintf(w, "%s %5d  %s\n", mark, addr, d.source(addr))
+	}
+	return nil
+}
+
+// where 現在の命令を表示する。
+func (d *Debugger) where(w io.Writer) {
+	pc := int(d.CPU.PC)
+	fmt.Fprintf(w, "=> %s  %s\n", d.describe(pc), d.source(pc))
+}
+
+func (d *Debugger) set(args []string, w io.Writer) error {
+	if len(args) != 2 {
+		return errors.New("usage: set <A|D|PC|address|symbol> <value>")
+	}
+	v, err := strconv.Atoi(args[1])
+	if err != nil || v < -32768 || v > 65535 {
+		return fmt.Errorf("invalid value %q", args[1])
+	}
+	switch args[0] {
+	case "A":
+		d.CPU.A = uint16(v)
+	case "D":
+		d.CPU.D = uint16(v)
+	case "PC":
+		d.CPU.PC = uint16(v)
+	default:
+		addr, err := d.ramAddr(args[0])
+		if err != nil {
+			return err
+		}
+		d.CPU.RAM[addr] = uint16(v)
+		for _, wp := range d.watches {
+			if wp.addr == addr {
+				wp.old = uint16(v)
+			}
+		}
+	}
+	return nil
+}
+
+// romAddr ROMアドレスの数値またはラベルを解釈する。
+func (d *Debugger) romAddr(s string) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 || n >= cpu.ROMSize {
+			return 0, fmt.Errorf("ROM address %d out of range", n)
+		}
+		return n, nil
+	}
+	if sym, ok := d.symbols[s]; ok && sym.Kind == assembler.Label {
+		return sym.Address, nil
+	}
+	return 0, fmt.Errorf("unknown label %q", s)
+}
+
+// ramAddr RAMアドレスの数値, RAM[n]またはシンボル(定義済みシンボル, 変数, 定数)を解釈する。
+func (d *Debugger) ramAddr(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(s, "RAM["), "]"))
+	if err != nil {
+		var ok bool
+		if n, ok = assembler.Predefined(s); !ok {
+			sym, found := d.symbols[s]
+			if !found {
+				return 0, fmt.Errorf("unknown symbol %q", s)
+			}
+			n = sym.Address
+		}
+	}
+	if n < 0 || n >= cpu.RAMSize {
+		return 0, fmt.Errorf("RAM address %d out of range", n)
+	}
+	return n, nil
+}
+
+// ramName RAMアドレスを、対応する変数や定義済みシンボルがあれば名前付きで表す。
+func (d *Debugger) ramName(addr int) string {
+	for _, name := range []string{"SP", "LCL", "ARG", "THIS", "THAT"} {
+		if v, _ := assembler.Predefined(name); v == addr {
+			return fmt.Sprintf("%s (RAM[%d])", name, addr)
+		}
+	}
+	for _, sym := range d.symbols {
+		if sym.Kind == assembler.Variable && sym.Address == addr {
+			return fmt.Sprintf("%s (RAM[%d])", sym.Name, addr)
+		}
+	}
+	return fmt.Sprintf("RAM[%d]", addr)
+}
+
+// labelAt addrに定義されたラベルを返す (複数ある場合は最後のもの)。
+func (d *Debugger) labelAt(addr int) string {
+	i := sort.Search(len(d.labels), func(i int) bool { return d.labels[i].Address > addr })
+	if i > 0 && d.labels[i-1].Address == addr {
+		return d.labels[i-1].Name
+	}
+	return ""
+}
+
+// describe ROMアドレスを "42 <Main.fibonacci+3> (Main.asm:57)" の形で表す。
+func (d *Debugger) describe(addr int) string {
+	s := strconv.Itoa(addr)
+	i := sort.Search(len(d.labels), func(i int) bool { return d.labels[i].Address > addr })
+	if i > 0 {
+		l := d.labels[i-1]
+		if addr == l.Address {
+			s += fmt.Sprintf(" <%s>", l.Name)
+		} else {
+			s += fmt.Sprintf(" <%s+%d>", l.Name, addr-l.Address)
+		}
+	}
+	if e, ok := d.listing[addr]; ok {
+		file := e.File
+		if file == "" {
+			file = d.name
+		}
+		s += fmt.Sprintf(" (%s:%d)", file, e.Line)
+	}
+	return s
+}
+
+// source ROMアドレスの命令のソースを返す。リスティングがなければ逆アセンブルする。
+func (d *Debugger) source(addr int) string {
+	if e, ok := d.listing[addr]; ok {
+		return strings.TrimSpace(e.Source)
+	}
+	if addr >= d.CPU.Size {
+		return "(end of program)"
+	}
+	s, err := assembler.DisassembleWord(d.CPU.ROM[addr])
+	if err != nil {
+		return fmt.Sprintf("%016b", d.CPU.ROM[addr])
+	}
+	return s
+}
@@ -0,0 +1,150 @@
+package debug
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/momotaro98/nand2tetris/assembler"
+	"github.com/momotaro98/nand2tetris/assembler/cpu"
+)
+
+// sumSrc nから1までの和をsumに求める。
+const sumSrc = `// sum = n + (n-1) + ... + 1
+    @5
+    D=A
+    @n
+    M=D
+    @sum
+    M=0
+(LOOP)
+    @n
+    D=M
+    @END
+    D;JEQ
+    @sum
+    M=D+M
+    @n
+    M=M-1
+    @LOOP
+    0;JMP
+(END)
+    @END
+    0;JMP
+`
+
+func newDebugger(t *testing.T) *Debugger {
+	t.Helper()
+	res, err := assembler.AssembleSource("", strings.NewReader(sumSrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cpu.New(res.Words)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(c, "sum.asm", res)
+}
+
+// TestSession コマンドを順に実行し、それぞれの出力に期待する文字列が含まれることを確かめる。
+func TestSession(t *testing.T) {
+	dir := t.TempDir()
+	state := filepath.Join(dir, "sum.state")
+	steps := []struct {
+		cmd  string
+		want []string // 出力に含まれるべき文字列
+		err  string   // 空ならエラーなし
+	}{
+		{"where", []string{"=> 0 (sum.asm:2)  @5"}, ""},
+		{"break LOOP", []string{"breakpoint 1 at 6 <LOOP> (sum.asm:9)"}, ""},
+		{"continue", []string{"breakpoint 1, 6 <LOOP> (sum.asm:9)", "=> 6 <LOOP> (sum.asm:9)  @n"}, ""},
+		{"x n", []string{"n (RAM[16]) = 5"}, ""},
+		{"x 16 2", []string{"n (RAM[16]) = 5\nsum (RAM[17]) = 0\n"}, ""},
+		{"watch sum", []string{"watchpoint 2: sum (RAM[17]) = 0"}, ""},
+		{"info", []string{"breakpoint 1 at 6 <LOOP>", "watchpoint 2: sum (RAM[17]) = 0"}, ""},
+		{"delete 1", nil, ""},
+		{"continue", []string{"watchpoint 2: sum (RAM[17]): 0 -> 5", "=> 12 <LOOP+6> (sum.asm:15)  @n"}, ""},
+		{"save " + state, []string{"saved cycle 12 to " + state}, ""},
+		{"delete", []string{"deleted all breakpoints and watchpoints"}, ""},
+		{"until END", []string{"=> 16 <END> (sum.asm:20)  @END"}, ""},
+		{"x sum", []string{"sum (RAM[17]) = 15"}, ""},
+		{"continue", []string{"program halted"}, ""},
+		{"regs", []string{"PC=16 A=16 D=0 M=0 cycles="}, ""},
+		{"set D -7", nil, ""},
+		{"set sum 3", nil, ""},
+		{"regs", []string{"D=-7"}, ""},
+		{"x RAM[17]", []string{"sum (RAM[17]) = 3"}, ""},
+		{"load " + state, []string{"=> 12 <LOOP+6>"}, ""},
+		{"x sum", []string{"sum (RAM[17]) = 5"}, ""},
+		{"list LOOP 3", []string{"          (LOOP)\n       6  @n\n       7  D=M\n"}, ""},
+		{"step 2", []string{"=> 14 <LOOP+8>"}, ""},
+		{"list 14 2", []string{"      13  M=M-1\n=>    14  @LOOP\n"}, ""},
+		{"reset", []string{"=> 0 (sum.asm:2)"}, ""},
+		{"set SP 258", nil, ""},
+		{"set 256 11", nil, ""},
+		{"set 257 12", nil, ""},
+		{"set ARG 256", nil, ""},
+		{"stack", []string{"SP=258 LCL=0 ARG=256", "RAM[257] = 12  <- top\n  RAM[256] = 11  <- ARG\n"}, ""},
+		{"break NOPE", nil, `unknown label "NOPE"`},
+		{"break 40000", nil, "ROM address 40000 out of range"},
+		{"x RAM[99999]", nil, "RAM address 99999 out of range"},
+		{"watch nope", nil, `unknown symbol "nope"`},
+		{"step 0", nil, `invalid count "0"`},
+		{"set D x", nil, `invalid value "x"`},
+		{"delete 9", nil, "no breakpoint or watchpoint 9"},
+		{"until", nil, "usage: until"},
+		{"info foo", nil, "usage: info break|watch"},
+		{"frob", nil, `unknown command "frob"`},
+		{"", nil, ""},
+	}
+	d := newDebugger(t)
+	for _, s := range steps {
+		var out strings.Builder
+		err := d.Exec(s.cmd, &out)
+		switch {
+		case s.err == "" && err != nil:
+			t.Fatalf("%q: %v", s.cmd, err)
+		case s.err != "" && (err == nil || !strings.Contains(err.Error(), s.err)):
+			t.Fatalf("%q: got error %v, want %q", s.cmd, err, s.err)
+		}
+		for _, want := range s.want {
+			if !strings.Contains(out.String(), want) {
+				t.Fatalf("%q: output\n%s\ndoes not contain\n%s", s.cmd, out.String(), want)
+			}
+		}
+	}
+	if err := d.Exec("quit", &strings.Builder{}); !errors.Is(err, ErrQuit) {
+		t.Errorf("quit: %v", err)
+	}
+}
+
+func TestContinueLimit(t *testing.T) {
+	// 終端の無限ループ (L) @L 0;JMP の形ではないので止まらない
+	res, err := assembler.AssembleSource("", strings.NewReader("(L)\nD=D+1\n@L\n0;JMP\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := cpu.New(res.Words)
+	d := New(c, "loop.asm", res)
+	d.MaxCycles = 100
+	var out strings.Builder
+	if err := d.Exec("c", &out); err != nil || !strings.Contains(out.String(), "stopped after 100 cycles") {
+		t.Errorf("got %q, %v", out.String(), err)
+	}
+
+	// シンボルの無い.hackは逆アセンブルして表示する
+	c.Reset()
+	d = New(c, "loop.hack", nil)
+	out.Reset()
+	if err := d.Exec("list 0 3", &out); err != nil || out.String() != "=>     0  D=D+1\n       1  @0\n       2  0;JMP\n" {
+		t.Errorf("list without symbols: %q, %v", out.String(), err)
+	}
+	c.PC = 0x7fff
+	c.A = 0x7fff
+	c.ROM[0x7fff] = 0xfc10 // D=M (RAMの外)
+	out.Reset()
+	if err := d.Exec("s", &out); !errors.Is(err, cpu.ErrBadAddress) {
+		t.Errorf("step out of range: %v", err)
+	}
+}
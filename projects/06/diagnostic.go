@@ -0,0 +1,129 @@
+package assembler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Diagnostic アセンブル中に検出した1件のエラーまたは警告。
+// Line, Columnは1始まりで、Columnは問題のあるニーモニックの開始位置を指す。
+type Diagnostic struct {
+	File       string
+	Line       int
+	Column     int
+	Mnemonic   string
+	Message    string
+	Suggestion string  // 最も近い正しいニーモニック、警告では正規の表記 (無い場合は空)
+	Trace      []Frame // マクロ展開や.includeの呼び出し元 (内側から順)
+	Warning    bool    // エラーではなく警告 (Options.Strictで検出したもの)
+}
+
+// maxTraceFrames Errorに表示する呼び出し元の数の上限。
+const maxTraceFrames = 8
+
+func (d Diagnostic) Error() string {
+	msg := d.Message
+	if d.Warning {
+		msg = "warning: " + msg
+	}
+	s := fmt.Sprintf("%d:%d: %s %q", d.Line, d.Column, msg, d.Mnemonic)
+	if d.File != "" {
+		s = d.File + ":" + s
+	}
+	switch {
+	case d.Suggestion != "" && d.Warning:
+		s += fmt.Sprintf(" (canonical spelling is %q)", d.Suggestion)
+	case d.Suggestion != "":
+		s += fmt.Sprintf(" (did you mean %q?)", d.Suggestion)
+	}
+	for i, f := range d.Trace {
+		if i == maxTraceFrames {
+			s += fmt.Sprintf("\n\t... and %d more", len(d.Trace)-i)
+			break
+		}
+		s += "\n\t" + f.String()
+	}
+	return s
+}
+
+// Diagnostics 1回のアセンブルで検出したすべてのエラー。
+type Diagnostics []Diagnostic
+
+// hasErrors 警告以外のDiagnosticを含むかを返す。
+func (ds Diagnostics) hasErrors() bool {
+	for _, d := range ds {
+		if !d.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+func (ds Diagnostics) Error() string {
+	lines := make([]string, len(ds))
+	for i, d := range ds {
+		lines[i] = d.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// locate 展開後のソースの行番号順に並べ、展開元のファイルと行に戻す。
+func (ds Diagnostics) locate(lines []srcLine) {
+	sort.SliceStable(ds, func(i, j int) bool {
+		if ds[i].Line != ds[j].Line {
+			return ds[i].Line < ds[j].Line
+		}
+		return ds[i].Column < ds[j].Column
+	})
+	for i := range ds {
+		pos := lines[ds[i].Line-1].pos
+		ds[i].File, ds[i].Line, ds[i].Trace = pos.File, pos.Line, pos.Trace
+	}
+}
+
+// suggest candidatesの中からsに最も近いもの(編集距離が最小のもの)を返す。
+// 距離が離れすぎている場合は候補なしとして空文字を返す。
+func suggest(s string, candidates []string) string {
+	sorted := append([]string(nil), candidates...)
+	sort.Strings(sorted) // 同距離の場合の結果を安定させる
+
+	best, bestDist := "", -1
+	for _, c := range sorted {
+		d := editDistance(s, c)
+		if bestDist < 0 || d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	if bestDist < 0 || bestDist > (len(s)+1)/2+1 {
+		return ""
+	}
+	return best
+}
+
+// editDistance レーベンシュタイン距離を返す。
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j] + 1
+			if v := cur[j-1] + 1; v < cur[j] {
+				cur[j] = v
+			}
+			if v := prev[j-1] + cost; v < cur[j] {
+				cur[j] = v
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,114 @@
+package assembler
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// diagnose srcをアセンブルし、エラーのDiagnosticsを返す。
+// TraceとWarning以外のフィールドを比べられるよう、Traceは取り除く。
+func diagnose(t *testing.T, name, src string, opts Options) Diagnostics {
+	t.Helper()
+	_, err := AssembleWith(name, strings.NewReader(src), opts)
+	if err == nil {
+		return nil
+	}
+	var diags Diagnostics
+	if !errors.As(err, &diags) {
+		t.Fatalf("%q: got %v, want diagnostics", src, err)
+	}
+	for i := range diags {
+		diags[i].Trace = nil
+	}
+	return diags
+}
+
+func TestInvalidMnemonics(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []Diagnostic
+	}{
+		{"D=M+2", []Diagnostic{{Line: 1, Column: 3, Mnemonic: "M+2", Message: "invalid comp mnemonic", Suggestion: "M+1"}}},
+		{"0;JMPP", []Diagnostic{{Line: 1, Column: 3, Mnemonic: "JMPP", Message: "invalid jump mnemonic", Suggestion: "JMP"}}},
+		{"   AM=D;JQQ", []Diagnostic{{Line: 1, Column: 9, Mnemonic: "JQQ", Message: "invalid jump mnemonic", Suggestion: "JEQ"}}},
+		{"X=D", []Diagnostic{{Line: 1, Column: 1, Mnemonic: "X", Message: "invalid dest mnemonic", Suggestion: "A"}}},
+		{"\tD=D+Q // コメント", []Diagnostic{{Line: 1, Column: 4, Mnemonic: "D+Q", Message: "invalid comp mnemonic", Suggestion: "D+1"}}},
+		// 近いニーモニックが無ければ候補を出さない
+		{"D=FOOBAR", []Diagnostic{{Line: 1, Column: 3, Mnemonic: "FOOBAR", Message: "invalid comp mnemonic"}}},
+		// 1つの命令の複数のエラーもまとめて報告する
+		{"Q=D+2;JJ", []Diagnostic{
+			{Line: 1, Column: 1, Mnemonic: "Q", Message: "invalid dest mnemonic", Suggestion: "A"},
+			{Line: 1, Column: 3, Mnemonic: "D+2", Message: "invalid comp mnemonic", Suggestion: "D+1"},
+			{Line: 1, Column: 7, Mnemonic: "JJ", Message: "invalid jump mnemonic", Suggestion: "JEQ"},
+		}},
+	}
+	for _, tt := range tests {
+		got := diagnose(t, "", tt.src, Options{})
+		if !reflect.DeepEqual([]Diagnostic(got), tt.want) {
+			t.Errorf("%q:\n got  %+v\n want %+v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestDiagnosticsCollected(t *testing.T) {
+	// 最初のエラーで止まらず、すべての行のエラーを行順に集める
+	src := "@2\nD=M+2\n(LOOP)\n0;JMPP\n@LOOP\nD;JGT\nX=D\n"
+	got := diagnose(t, "prog.asm", src, Options{})
+	want := []Diagnostic{
+		{File: "prog.asm", Line: 2, Column: 3, Mnemonic: "M+2", Message: "invalid comp mnemonic", Suggestion: "M+1"},
+		{File: "prog.asm", Line: 4, Column: 3, Mnemonic: "JMPP", Message: "invalid jump mnemonic", Suggestion: "JMP"},
+		{File: "prog.asm", Line: 7, Column: 1, Mnemonic: "X", Message: "invalid dest mnemonic", Suggestion: "A"},
+	}
+	if !reflect.DeepEqual([]Diagnostic(got), want) {
+		t.Fatalf("got  %+v\nwant %+v", got, want)
+	}
+	wantMsg := `prog.asm:2:3: invalid comp mnemonic "M+2" (did you mean "M+1"?)
+prog.asm:4:3: invalid jump mnemonic "JMPP" (did you mean "JMP"?)
+prog.asm:7:1: invalid dest mnemonic "X" (did you mean "A"?)`
+	if got.Error() != wantMsg {
+		t.Errorf("message\n%s\nwant\n%s", got.Error(), wantMsg)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	tests := []struct {
+		s          string
+		candidates []string
+		want       string
+	}{
+		{"M+2", mnemonicsOf(compTable), "M+1"},
+		{"JMPP", mnemonicsOf(jumpTable), "JMP"},
+		{"JNQ", mnemonicsOf(jumpTable), "JEQ"}, // 同じ距離ならソート順で最初のもの
+		{"XYZXYZ", mnemonicsOf(jumpTable), ""},
+		{"A", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := suggest(tt.s, tt.candidates); got != tt.want {
+			t.Errorf("suggest(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"JMP", "JMP", 0},
+		{"JMPP", "JMP", 1},
+		{"kitten", "sitting", 3},
+		{"D+M", "M+D", 2},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := editDistance(tt.b, tt.a); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
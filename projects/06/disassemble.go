@@ -0,0 +1,167 @@
+package assembler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// 逆変換表 (ビット列 → ニーモニック)。"null"は出力せず、000は省略形(空文字)に戻す。
+var (
+	destNames = invert(destTable)
+	compNames = invert(compTable)
+	jumpNames = invert(jumpTable)
+)
+
+func invert(table map[Mnemonic]string) map[string]Mnemonic {
+	inv := make(map[string]Mnemonic, len(table))
+	for m, bits := range table {
+		if m == "null" {
+			continue
+		}
+		inv[bits] = m
+	}
+	return inv
+}
+
+// DisassembleWord 1語の機械語を"@value"または"dest=comp;jump"に戻す。
+// アセンブリで表せない語(未使用ビットが1, 未定義のcomp)はエラーを返す。
+func DisassembleWord(w uint16) (string, error) {
+	if w&0x8000 == 0 {
+		return "@" + strconv.Itoa(int(w)), nil
+	}
+	bits := fmt.Sprintf("%016b", w)
+	if bits[:3] != "111" {
+		return "", fmt.Errorf("%s: unused bits of C-instruction are not 11", bits)
+	}
+	comp, ok := compNames[bits[3:10]]
+	if !ok {
+		return "", fmt.Errorf("%s: undefined comp bits %s", bits, bits[3:10])
+	}
+	s := string(comp)
+	if dest := destNames[bits[10:13]]; dest != "" {
+		s = string(dest) + "=" + s
+	}
+	if jump := jumpNames[bits[13:]]; jump != "" {
+		s += ";" + string(jump)
+	}
+	return s, nil
+}
+
+// disassembleAny アセンブリで表せない語も、ROMアドレスがずれないよう1つの命令に戻す。
+//   - 未使用ビットが11でない語は、そのビットを11にした命令にする (CPUはこのビットを使わないので動作は同じ)
+//   - 未定義のcompの語は、何もしない命令 0 にする (destとjumpが無ければ動作は同じ)
+//
+// どちらも "// ? 機械語: 理由" のコメントを付け、再びアセンブルしても元と同じ語にはならない。
+func disassembleAny(w uint16) string {
+	s, err := DisassembleWord(w)
+	if err == nil {
+		return s
+	}
+	if fixed, err2 := DisassembleWord(w | 0x6000); err2 == nil {
+		return fmt.Sprintf("%s // ? %v", fixed, err)
+	}
+	return fmt.Sprintf("0 // ? %v", err)
+}
+
+// Disassemble 機械語をアセンブリの行に戻す。
+// symbolsを渡すと、ラベルの位置に(Xxx)を挿入し、ジャンプ先と変数のアドレスをシンボル名で表す。
+// 結果は再びアセンブルすると元と同じ機械語になる。シンボル名を使うとそうならない場合
+// (変数の割り当て順が変わるなど)は、その種類のシンボル名を使わずに出力する。
+// アセンブリで表せない語は "// ?" のコメントを付けた命令にして続ける (disassembleAny)。
+func Disassemble(words []uint16, symbols []Symbol) ([]string, error) {
+	plain := make([]string, len(words))
+	for i, w := range words {
+		plain[i] = disassembleAny(w)
+	}
+	if len(symbols) == 0 {
+		return plain, nil
+	}
+
+	for _, useVars := range []bool{true, false} {
+		lines := withSymbols(words, plain, symbols, useVars)
+		if got, err := Assemble(strings.NewReader(strings.Join(lines, "\n"))); err == nil && reflect.DeepEqual(got, words) {
+			return lines, nil
+		}
+	}
+	return plain, nil
+}
+
+// withSymbols plainにラベル定義を挿入し、@の値をシンボル名に置き換える。
+func withSymbols(words []uint16, plain []string, symbols []Symbol, useVars bool) []string {
+	labels := make(map[int][]string) // ROMアドレス → ラベル名
+	labelAt := make(map[int]string)  // ROMアドレス → @で参照するときの名前
+	vars := make(map[int]string)     // RAMアドレス → 変数名
+	for _, sym := range symbols {
+		switch sym.Kind {
+		case Label:
+			labels[sym.Address] = append(labels[sym.Address], sym.Name)
+			if _, ok := labelAt[sym.Address]; !ok {
+				labelAt[sym.Address] = sym.Name
+			}
+		case Variable:
+			if useVars {
+				vars[sym.Address] = sym.Name
+			}
+		}
+	}
+
+	var lines []string
+	for i, w := range words {
+		for _, name := range labels[i] {
+			lines = append(lines, "("+name+")")
+		}
+		line := plain[i]
+		if w&0x8000 == 0 {
+			// 直後がジャンプ命令ならジャンプ先のラベル、そうでなければ変数として名前を探す。
+			jumps := i+1 < len(words) && words[i+1]&0x8000 != 0 && words[i+1]&0x7 != 0
+			if name, ok := labelAt[int(w)]; ok && jumps {
+				line = "@" + name
+			} else if name, ok := vars[int(w)]; ok {
+				line = "@" + name
+			}
+		} else {
+			line = "    " + line
+		}
+		lines = append(lines, line)
+	}
+	for _, name := range labels[len(words)] {
+		lines = append(lines, "("+name+")")
+	}
+	return lines
+}
+
+// ReadSymbols WriteSymbolsまたはWriteSymbolsJSONで書き出したシンボルテーブルを読み込む。
+func ReadSymbols(r io.Reader) ([]Symbol, error) {
+	br := bufio.NewReader(r)
+	if b, err := br.Peek(1); err == nil && b[0] == '[' {
+		var symbols []Symbol
+		err := json.NewDecoder(br).Decode(&symbols)
+		return symbols, err
+	}
+	var symbols []Symbol
+	scanner := bufio.NewScanner(br)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: want \"name address kind\"", n)
+		}
+		addr, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid address %q", n, fields[1])
+		}
+		sym := Symbol{Name: fields[0], Address: addr}
+		if err := sym.Kind.UnmarshalText([]byte(fields[2])); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		symbols = append(symbols, sym)
+	}
+	return symbols, scanner.Err()
+}
@@ -0,0 +1,131 @@
+package assembler
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDisassembleWord(t *testing.T) {
+	for _, src := range []string{"@0", "@32767", "0;JMP", "D=M", "M=D", "AM=M-1", "D=D-M", "D;JEQ", "AMD=-D;JLE", "0", "M=!M", "D=D|A;JNE"} {
+		words, err := Assemble(strings.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := DisassembleWord(words[0]); err != nil || got != src {
+			t.Errorf("%016b: got %q, %v, want %q", words[0], got, err, src)
+		}
+	}
+	bad := []struct {
+		word uint16
+		want string
+	}{
+		{0x8000, "unused bits of C-instruction are not 11"},
+		{0x9c10, "unused bits of C-instruction are not 11"},
+		{0xe040, "undefined comp bits 0000001"},
+	}
+	for _, tt := range bad {
+		if _, err := DisassembleWord(tt.word); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%016b: got error %v, want %q", tt.word, err, tt.want)
+		}
+	}
+}
+
+// TestDisassembleRoundTrip 4章から8章のプログラムをアセンブル → 逆アセンブル → アセンブルして同じ機械語になることを確かめる。
+// シンボルテーブルを使う場合も同じ機械語になり、ラベルが復元されることを確かめる。
+func TestDisassembleRoundTrip(t *testing.T) {
+	var paths []string
+	for _, pattern := range []string{"../04/*/*.asm", "*/*.asm", "../0[78]/*/*/*.asm"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, matches...)
+	}
+	if len(paths) < 15 {
+		t.Fatalf("found only %d programs", len(paths))
+	}
+	for _, path := range paths {
+		res := assembleFile(path, Options{})
+		if res.Err != nil {
+			t.Fatalf("%s: %v", path, res.Err)
+		}
+		for _, symbols := range [][]Symbol{nil, res.Result.Symbols} {
+			lines, err := Disassemble(res.Result.Words, symbols)
+			if err != nil {
+				t.Fatalf("%s: %v", path, err)
+			}
+			src := strings.Join(lines, "\n")
+			got, err := Assemble(strings.NewReader(src))
+			if err != nil {
+				t.Fatalf("%s: reassembling: %v", path, err)
+			}
+			if !reflect.DeepEqual(got, res.Result.Words) {
+				t.Errorf("%s (symbols=%v): round trip differs", path, symbols != nil)
+			}
+			if symbols != nil && hasLabel(res.Result.Symbols) && !strings.Contains(src, "(") {
+				t.Errorf("%s: labels were not recovered", path)
+			}
+		}
+	}
+}
+
+func hasLabel(symbols []Symbol) bool {
+	for _, sym := range symbols {
+		if sym.Kind == Label {
+			return true
+		}
+	}
+	return false
+}
+
+// TestDisassembleSymbolsFile シンボルマップを書き出して読み込んでも同じように復元できることを確かめる。
+func TestDisassembleSymbolsFile(t *testing.T) {
+	res := assembleFile("max/Max.asm", Options{})
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	for _, write := range []func(*bytes.Buffer, []Symbol) error{
+		func(b *bytes.Buffer, s []Symbol) error { return WriteSymbols(b, s) },
+		func(b *bytes.Buffer, s []Symbol) error { return WriteSymbolsJSON(b, s) },
+	} {
+		var buf bytes.Buffer
+		if err := write(&buf, res.Result.Symbols); err != nil {
+			t.Fatal(err)
+		}
+		symbols, err := ReadSymbols(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(symbols, res.Result.Symbols) {
+			t.Errorf("got %v, want %v", symbols, res.Result.Symbols)
+		}
+	}
+}
+
+// TestDisassembleUnrepresentable アセンブリで表せない語があっても、ROMアドレスをずらさずに逆アセンブルを続けることを確かめる。
+func TestDisassembleUnrepresentable(t *testing.T) {
+	words := []uint16{
+		0x0003, // @3
+		0x9c10, // 未使用ビットが00の D=M
+		0xe040, // 未定義のcomp
+		0xea87, // 0;JMP
+	}
+	lines, err := Disassemble(words, []Symbol{{Name: "LOOP", Address: 3, Kind: Label}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"@3", "D=M // ? 1001110000010000: unused bits of C-instruction are not 11", "0 // ? 1110000001000000: undefined comp bits 0000001", "0;JMP"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Fatalf("got %q, want %q", lines, want)
+	}
+	got, err := Assemble(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(words) || got[0] != words[0] || got[1] != 0xfc10 || got[2] != 0xea80 || got[3] != words[3] {
+		t.Errorf("reassembled %04x", got)
+	}
+}
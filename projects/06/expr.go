@@ -0,0 +1,187 @@
+package assembler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A命令の定数式 (@LABEL+1, @SCREEN+32*2 など)。
+// 優先順位は低い方から | & << (+ -) * で、単項の-と括弧も使える。
+// 値は数値, ラベル, 定義済みシンボル, 定数および変数で、ラベルが確定した後の2パス目で評価する。
+// 未定義のシンボルは@Xxxと同じく変数として割り当てる (.equと.ifの式では定数に限る)。
+
+// exprLimit 途中の値の上限。これを超えたらオーバーフローとして扱う。
+const exprLimit = 1 << 31
+
+// isExpression @Xxxのxxxが演算を含む式かを返す。
+// "-3"のような負の数は式ではなく負の定数として扱う。
+func isExpression(s string) bool {
+	if strings.HasPrefix(s, "-") {
+		if _, err := strconv.Atoi(s[1:]); err == nil {
+			return false
+		}
+	}
+	return strings.ContainsAny(s, "+-*&|<() \t")
+}
+
+// ExprError 式の評価エラー。Offsetは式の中での位置 (0始まり)。
+type ExprError struct {
+	Offset  int
+	Message string
+}
+
+func (e *ExprError) Error() string {
+	return e.Message
+}
+
+// exprOffset errが (ラップされた) ExprErrorならその式の中での位置を、そうでなければ0を返す。
+func exprOffset(err error) int {
+	var ee *ExprError
+	if errors.As(err, &ee) {
+		return ee.Offset
+	}
+	return 0
+}
+
+type exprToken struct {
+	text string
+	pos  int
+}
+
+type exprParser struct {
+	toks   []exprToken
+	pos    int
+	end    int
+	lookup func(name string) (int, bool)
+}
+
+// evalExpr 式sを評価する。lookupはシンボルの値を返す。
+// 結果がA命令の範囲(0〜32767)を超える場合もエラーを返す。
+func evalExpr(s string, lookup func(name string) (int, bool)) (int, error) {
+	toks, err := tokenizeExpr(s)
+	if err != nil {
+		return 0, err
+	}
+	p := &exprParser{toks: toks, end: len(s), lookup: lookup}
+	v, err := p.parseBinary(0)
+	if err != nil {
+		return 0, err
+	}
+	if p.pos < len(p.toks) {
+		t := p.toks[p.pos]
+		return 0, &ExprError{t.pos, fmt.Sprintf("unexpected %q in expression", t.text)}
+	}
+	if v < 0 || v > maxAConstant {
+		return 0, &ExprError{0, fmt.Sprintf("expression value %d out of range (0..%d)", v, maxAConstant)}
+	}
+	return v, nil
+}
+
+func tokenizeExpr(s string) ([]exprToken, error) {
+	var toks []exprToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case strings.HasPrefix(s[i:], "<<"):
+			toks = append(toks, exprToken{"<<", i})
+			i += 2
+		case strings.IndexByte("+-*&|()", c) >= 0:
+			toks = append(toks, exprToken{string(c), i})
+			i++
+		case isSymbolChar(c):
+			j := i
+			for j < len(s) && isSymbolChar(s[j]) {
+				j++
+			}
+			toks = append(toks, exprToken{s[i:j], i})
+			i = j
+		default:
+			return nil, &ExprError{i, fmt.Sprintf("unexpected %q in expression", c)}
+		}
+	}
+	return toks, nil
+}
+
+// binaryOps 二項演算子の優先順位 (大きいほど強く結合する)。
+var binaryOps = map[string]int{"|": 1, "&": 2, "<<": 3, "+": 4, "-": 4, "*": 5}
+
+// parseBinary 優先順位がminPrec以上の二項演算を読む (優先順位法)。
+func (p *exprParser) parseBinary(minPrec int) (int, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	for p.pos < len(p.toks) {
+		op := p.toks[p.pos]
+		prec, ok := binaryOps[op.text]
+		if !ok || prec < minPrec {
+			break
+		}
+		p.pos++
+		rhs, err := p.parseBinary(prec + 1)
+		if err != nil {
+			return 0, err
+		}
+		switch op.text {
+		case "|":
+			lhs |= rhs
+		case "&":
+			lhs &= rhs
+		case "<<":
+			if rhs < 0 || rhs >= 32 {
+				return 0, &ExprError{op.pos, fmt.Sprintf("invalid shift count %d", rhs)}
+			}
+			lhs <<= rhs
+		case "+":
+			lhs += rhs
+		case "-":
+			lhs -= rhs
+		case "*":
+			lhs *= rhs
+		}
+		if lhs >= exprLimit || lhs <= -exprLimit {
+			return 0, &ExprError{op.pos, "overflow in expression"}
+		}
+	}
+	return lhs, nil
+}
+
+func (p *exprParser) parseUnary() (int, error) {
+	if p.pos >= len(p.toks) {
+		return 0, &ExprError{p.end, "missing operand in expression"}
+	}
+	t := p.toks[p.pos]
+	p.pos++
+	switch {
+	case t.text == "-":
+		v, err := p.parseUnary()
+		return -v, err
+	case t.text == "(":
+		v, err := p.parseBinary(0)
+		if err != nil {
+			return 0, err
+		}
+		if p.pos >= len(p.toks) || p.toks[p.pos].text != ")" {
+			return 0, &ExprError{t.pos, "unbalanced parentheses in expression"}
+		}
+		p.pos++
+		return v, nil
+	case isDigit(t.text[0]):
+		v, err := strconv.Atoi(t.text)
+		if err != nil || v > maxAConstant {
+			return 0, &ExprError{t.pos, fmt.Sprintf("invalid number %q in expression", t.text)}
+		}
+		return v, nil
+	case isSymbolChar(t.text[0]):
+		v, ok := p.lookup(t.text)
+		if !ok {
+			return 0, &ExprError{t.pos, fmt.Sprintf("undefined symbol %q in expression", t.text)}
+		}
+		return v, nil
+	}
+	return 0, &ExprError{t.pos, fmt.Sprintf("unexpected %q in expression", t.text)}
+}
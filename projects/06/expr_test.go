@@ -0,0 +1,86 @@
+package assembler
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEvalExpr(t *testing.T) {
+	symbols := map[string]int{"LOOP": 10, "SCREEN": 16384, "W": 32}
+	lookup := func(name string) (int, bool) {
+		v, ok := symbols[name]
+		return v, ok
+	}
+	tests := []struct {
+		expr string
+		want int
+		err  string
+	}{
+		{"LOOP+1", 11, ""},
+		{"SCREEN+W*2", 16448, ""},
+		{"(1<<4)|3", 19, ""},
+		{"-1+LOOP", 9, ""},
+		{"W-2*(3+1)", 24, ""},
+		{"12&6|1", 5, ""},
+		{"LOOP-11", 0, "expression value -1 out of range (0..32767)"},
+		{"SCREEN*2", 0, "expression value 32768 out of range (0..32767)"},
+		{"X+1", 0, `undefined symbol "X" in expression`},
+		{"1+", 0, "missing operand in expression"},
+		{"(1+2", 0, "unbalanced parentheses in expression"},
+		{"1 2", 0, `unexpected "2" in expression`},
+		{"1+#", 0, `unexpected '#' in expression`},
+	}
+	for _, tt := range tests {
+		got, err := evalExpr(tt.expr, lookup)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%q: got %d, %v, want error %q", tt.expr, got, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %d, %v, want %d", tt.expr, got, err, tt.want)
+		}
+	}
+}
+
+// TestExprVariables 式の中で初めて参照したシンボルも@Xxxと同じく変数になることを確かめる。
+func TestExprVariables(t *testing.T) {
+	res, err := AssembleSource("", strings.NewReader("@ARR-1\nD=A\n@ARR\nM=D\n@i+ARR\nM=0\n@i\nM=1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint16{15, 0xec10, 16, 0xe308, 33, 0xea88, 17, 0xefc8}; !reflect.DeepEqual(res.Words, want) {
+		t.Errorf("got %v, want %v", res.Words, want)
+	}
+	want := []Symbol{{Name: "ARR", Address: 16, Kind: Variable}, {Name: "i", Address: 17, Kind: Variable}}
+	if !reflect.DeepEqual(res.Symbols, want) {
+		t.Errorf("symbols %v, want %v", res.Symbols, want)
+	}
+
+	// .equの式は定数に限る
+	_, err = Assemble(strings.NewReader(".equ N ARR+1\n@N\n"))
+	var diags Diagnostics
+	if !errors.As(err, &diags) || !strings.Contains(err.Error(), `undefined symbol "ARR" in expression`) {
+		t.Errorf(".equ with a variable: got %v", err)
+	}
+}
+
+func TestExprOffset(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{&ExprError{4, "unexpected \")\" in expression"}, 4},
+		{fmt.Errorf("lib.asm: %w", &ExprError{2, "overflow in expression"}), 2},
+		{errors.New("not an expression error"), 0},
+	}
+	for _, tt := range tests {
+		if got := exprOffset(tt.err); got != tt.want {
+			t.Errorf("exprOffset(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
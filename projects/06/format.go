@@ -0,0 +1,388 @@
+package assembler
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/momotaro98/nand2tetris/assembler/cpu"
+)
+
+// Format 機械語の出力形式。
+type Format string
+
+const (
+	FormatHack     Format = "hack"     // 1行に16桁の2進数 (nand2tetris標準)
+	FormatBinLE    Format = "bin-le"   // 16bitリトルエンディアンの生バイナリ
+	FormatBinBE    Format = "bin-be"   // 16bitビッグエンディアンの生バイナリ
+	FormatIHex     Format = "ihex"     // Intel HEX (バイトアドレス, 1語はビッグエンディアンの2バイト)
+	FormatReadmemb Format = "readmemb" // Verilog $readmemb (1行に16桁の2進数)
+	FormatReadmemh Format = "readmemh" // Verilog $readmemh (1行に4桁の16進数)
+	FormatMIF      Format = "mif"      // Altera Memory Initialization File
+)
+
+// Formats 対応している出力形式の一覧。
+var Formats = []Format{FormatHack, FormatBinLE, FormatBinBE, FormatIHex, FormatReadmemb, FormatReadmemh, FormatMIF}
+
+// ParseFormat 形式名を解釈する。
+func ParseFormat(s string) (Format, error) {
+	for _, f := range Formats {
+		if string(f) == s {
+			return f, nil
+		}
+	}
+	names := make([]string, len(Formats))
+	for i, f := range Formats {
+		names[i] = string(f)
+	}
+	return "", fmt.Errorf("unknown output format %q (want one of %s)", s, strings.Join(names, ", "))
+}
+
+// Ext 形式に対応するファイルの拡張子。
+func (f Format) Ext() string {
+	switch f {
+	case FormatBinLE, FormatBinBE:
+		return ".bin"
+	case FormatIHex:
+		return ".hex"
+	case FormatReadmemb, FormatReadmemh:
+		return ".mem"
+	case FormatMIF:
+		return ".mif"
+	}
+	return ".hack"
+}
+
+// WriteFormat 機械語をformatの形式で書き出す。
+func WriteFormat(w io.Writer, words []uint16, format Format) error {
+	switch format {
+	case FormatHack:
+		return WriteHack(w, words)
+	case FormatBinLE:
+		return binary.Write(w, binary.LittleEndian, words)
+	case FormatBinBE:
+		return binary.Write(w, binary.BigEndian, words)
+	case FormatIHex:
+		return writeIHex(w, words)
+	case FormatReadmemb:
+		return writeReadmem(w, words, "%016b")
+	case FormatReadmemh:
+		return writeReadmem(w, words, "%04x")
+	case FormatMIF:
+		return writeMIF(w, words)
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
+
+// ReadFormat formatの形式で書かれた機械語を読み込む。
+func ReadFormat(r io.Reader, format Format) ([]uint16, error) {
+	switch format {
+	case FormatHack:
+		return cpu.ParseHack(r)
+	case FormatBinLE:
+		return readBinary(r, binary.LittleEndian)
+	case FormatBinBE:
+		return readBinary(r, binary.BigEndian)
+	case FormatIHex:
+		return readIHex(r)
+	case FormatReadmemb:
+		return readReadmem(r, 2)
+	case FormatReadmemh:
+		return readReadmem(r, 16)
+	case FormatMIF:
+		return readMIF(r)
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+func readBinary(r io.Reader, order binary.ByteOrder) ([]uint16, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(b)%2 != 0 {
+		return nil, errors.New("odd number of bytes in 16-bit binary")
+	}
+	words := make([]uint16, len(b)/2)
+	for i := range words {
+		words[i] = order.Uint16(b[2*i:])
+	}
+	return words, nil
+}
+
+// ihexRecordSize Intel HEXの1レコードに入れるバイト数。
+const ihexRecordSize = 16
+
+func writeIHex(w io.Writer, words []uint16) error {
+	bw := bufio.NewWriter(w)
+	data := make([]byte, 2*len(words))
+	for i, word := range words {
+		binary.BigEndian.PutUint16(data[2*i:], word)
+	}
+	for addr := 0; addr < len(data); addr += ihexRecordSize {
+		end := addr + ihexRecordSize
+		if end > len(data) {
+			end = len(data)
+		}
+		writeIHexRecord(bw, addr, 0x00, data[addr:end])
+	}
+	writeIHexRecord(bw, 0, 0x01, nil)
+	return bw.Flush()
+}
+
+// writeIHexRecord ":LLAAAATT<data>CC" の1レコードを書く。
+// ROMは最大64KBなので拡張アドレスレコードは使わない。
+func writeIHexRecord(w *bufio.Writer, addr int, typ byte, data []byte) {
+	rec := append([]byte{byte(len(data)), byte(addr >> 8), byte(addr), typ}, data...)
+	var sum byte
+	for _, b := range rec {
+		sum += b
+	}
+	fmt.Fprintf(w, ":%X%02X\n", rec, -sum)
+}
+
+func readIHex(r io.Reader) ([]uint16, error) {
+	var data []byte
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line[0] != ':' || len(line)%2 != 1 {
+			return nil, fmt.Errorf("line %d: malformed Intel HEX record", n)
+		}
+		rec := make([]byte, len(line)/2)
+		for i := range rec {
+			v, err := strconv.ParseUint(line[1+2*i:3+2*i], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: malformed Intel HEX record", n)
+			}
+			rec[i] = byte(v)
+		}
+		var sum byte
+		for _, b := range rec {
+			sum += b
+		}
+		if len(rec) < 5 || int(rec[0]) != len(rec)-5 || sum != 0 {
+			return nil, fmt.Errorf("line %d: bad Intel HEX length or checksum", n)
+		}
+		addr := int(rec[1])<<8 | int(rec[2])
+		switch rec[3] {
+		case 0x00:
+			for len(data) < addr+int(rec[0]) {
+				data = append(data, 0)
+			}
+			copy(data[addr:], rec[4:len(rec)-1])
+		case 0x01:
+			return readBinary(strings.NewReader(string(data)), binary.BigEndian)
+		default:
+			return nil, fmt.Errorf("line %d: unsupported Intel HEX record type %02X", n, rec[3])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("missing Intel HEX end-of-file record")
+}
+
+func writeReadmem(w io.Writer, words []uint16, format string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "// Hack ROM, %d words\n", len(words))
+	for _, word := range words {
+		fmt.Fprintf(bw, format+"\n", word)
+	}
+	return bw.Flush()
+}
+
+// readReadmem $readmemb/$readmemhの形式を読む。コメントと"@アドレス"にも対応する。
+func readReadmem(r io.Reader, base int) ([]uint16, error) {
+	var words []uint16
+	addr := 0
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.SplitN(scanner.Text(), "//", 2)[0]
+		for _, tok := range strings.Fields(line) {
+			if strings.HasPrefix(tok, "@") {
+				v, err := strconv.ParseUint(tok[1:], 16, 16)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid address %q", n, tok)
+				}
+				addr = int(v)
+				continue
+			}
+			v, err := strconv.ParseUint(strings.ReplaceAll(tok, "_", ""), base, 16)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid word %q", n, tok)
+			}
+			for len(words) <= addr {
+				words = append(words, 0)
+			}
+			words[addr] = uint16(v)
+			addr++
+		}
+	}
+	return words, scanner.Err()
+}
+
+func writeMIF(w io.Writer, words []uint16) error {
+	bw := bufio.NewWriter(w)
+	depth := len(words)
+	if depth == 0 {
+		depth = 1
+	}
+	fmt.Fprintf(bw, "DEPTH = %d;\nWIDTH = 16;\nADDRESS_RADIX = HEX;\nDATA_RADIX = BIN;\nCONTENT\nBEGIN\n", depth)
+	for i, word := range words {
+		fmt.Fprintf(bw, "%04X : %016b;\n", i, word)
+	}
+	if len(words) == 0 {
+		fmt.Fprintf(bw, "0000 : %016b;\n", 0)
+	}
+	fmt.Fprintln(bw, "END;")
+	return bw.Flush()
+}
+
+// readMIF MIFの"アドレス : 値;"の行を読む。"[lo..hi] : 値;"の範囲指定にも対応する。
+// 内容の誤りは"line N: ..."の形式で、その文が始まる行を示す。
+func readMIF(r io.Reader) ([]uint16, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	src := string(b)
+	for { // "% ... %"コメントを除去 (行番号が変わらないよう改行は残す)
+		i := strings.Index(src, "%")
+		if i < 0 {
+			break
+		}
+		j := strings.Index(src[i+1:], "%")
+		if j < 0 {
+			return nil, fmt.Errorf("line %d: unterminated MIF comment", 1+strings.Count(src[:i], "\n"))
+		}
+		comment := src[i : i+j+2]
+		src = src[:i] + strings.Repeat("\n", strings.Count(comment, "\n")) + src[i+j+2:]
+	}
+	var lines []string // "--"から行末までのコメントを除去
+	for _, line := range strings.Split(src, "\n") {
+		lines = append(lines, strings.SplitN(line, "--", 2)[0])
+	}
+	stmts := strings.Split(strings.Join(lines, "\n"), ";")
+
+	depth, addrRadix, dataRadix := -1, 16, 16
+	radix := map[string]int{"BIN": 2, "OCT": 8, "DEC": 10, "UNS": 10, "HEX": 16}
+	var words []uint16
+	inContent := false
+	line := 1 // 次の文の直前までの行数+1
+	for _, raw := range stmts {
+		stmt := strings.TrimSpace(raw)
+		n := line + strings.Count(raw[:len(raw)-len(strings.TrimLeft(raw, " \t\r\n"))], "\n") // stmtが始まる行
+		line += strings.Count(raw, "\n")
+		upper := strings.ToUpper(stmt)
+		if !inContent {
+			if strings.HasPrefix(upper, "CONTENT") {
+				i := strings.Index(upper, "BEGIN")
+				if i < 0 {
+					return nil, fmt.Errorf("line %d: MIF CONTENT without BEGIN", n)
+				}
+				inContent = true
+				rest := stmt[i+len("BEGIN"):]
+				n += strings.Count(stmt[:i]+rest[:len(rest)-len(strings.TrimLeft(rest, " \t\r\n"))], "\n")
+				stmt = strings.TrimSpace(rest)
+				upper = strings.ToUpper(stmt)
+			} else {
+				key, val, ok := strings.Cut(upper, "=")
+				if !ok {
+					continue
+				}
+				key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+				switch key {
+				case "DEPTH":
+					if depth, err = strconv.Atoi(val); err != nil {
+						return nil, fmt.Errorf("line %d: invalid MIF depth %q", n, val)
+					}
+				case "WIDTH":
+					if val != "16" {
+						return nil, fmt.Errorf("line %d: unsupported MIF width %s", n, val)
+					}
+				case "ADDRESS_RADIX", "DATA_RADIX":
+					rdx, ok := radix[val]
+					if !ok {
+						return nil, fmt.Errorf("line %d: unsupported MIF radix %s", n, val)
+					}
+					if key == "ADDRESS_RADIX" {
+						addrRadix = rdx
+					} else {
+						dataRadix = rdx
+					}
+				}
+				continue
+			}
+		}
+		if upper == "END" {
+			break
+		}
+		if stmt == "" {
+			continue
+		}
+		addrs, data, ok := strings.Cut(stmt, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: malformed MIF content %q", n, stmt)
+		}
+		addrs = strings.TrimSpace(addrs)
+		lo, hi, err := parseMIFAddress(addrs, addrRadix)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		var vals []uint16
+		for _, tok := range strings.Fields(data) {
+			v, err := strconv.ParseUint(tok, dataRadix, 16)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid MIF data %q", n, tok)
+			}
+			vals = append(vals, uint16(v))
+		}
+		if len(vals) == 0 {
+			return nil, fmt.Errorf("line %d: MIF address %q has no value", n, addrs)
+		}
+		if lo != hi && len(vals) != 1 {
+			return nil, fmt.Errorf("line %d: MIF address range %q needs exactly one value", n, addrs)
+		}
+		for a := lo; a <= hi || a < lo+len(vals); a++ {
+			for len(words) <= a {
+				words = append(words, 0)
+			}
+			if lo == hi {
+				words[a] = vals[a-lo] // "addr : v0 v1 ..."は連続するアドレスに入れる
+			} else {
+				words[a] = vals[0]
+			}
+		}
+	}
+	if depth >= 0 && len(words) > depth {
+		return nil, fmt.Errorf("MIF content exceeds DEPTH %d", depth)
+	}
+	return words, nil
+}
+
+func parseMIFAddress(s string, base int) (int, int, error) {
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		loS, hiS, ok := strings.Cut(s[1:len(s)-1], "..")
+		if ok {
+			lo, err1 := strconv.ParseUint(strings.TrimSpace(loS), base, 16)
+			hi, err2 := strconv.ParseUint(strings.TrimSpace(hiS), base, 16)
+			if err1 == nil && err2 == nil && lo <= hi {
+				return int(lo), int(hi), nil
+			}
+		}
+		return 0, 0, fmt.Errorf("invalid MIF address range %q", s)
+	}
+	a, err := strconv.ParseUint(s, base, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid MIF address %q", s)
+	}
+	return int(a), int(a), nil
+}
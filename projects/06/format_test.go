@@ -0,0 +1,111 @@
+package assembler
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testWords 往復のテストに使う機械語。境界の値とRect.asmを組み立てたもの。
+func testWords(t *testing.T) []uint16 {
+	t.Helper()
+	f, err := os.Open("rect/Rect.asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	words, err := Assemble(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append([]uint16{0x0000, 0xffff, 0x8000, 0x7fff, 0x00ff, 0xff00}, words...)
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	words := testWords(t)
+	for _, format := range Formats {
+		for _, in := range [][]uint16{words, words[:1], words[:17]} {
+			var buf bytes.Buffer
+			if err := WriteFormat(&buf, in, format); err != nil {
+				t.Fatalf("%s: WriteFormat: %v", format, err)
+			}
+			got, err := ReadFormat(&buf, format)
+			if err != nil {
+				t.Fatalf("%s: ReadFormat: %v", format, err)
+			}
+			if !equalWords(got, in) {
+				t.Errorf("%s: round trip of %d words got %d words %v", format, len(in), len(got), got)
+			}
+		}
+	}
+}
+
+func equalWords(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReadMIF(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []uint16
+	}{
+		{"comments", "% header %\nWIDTH=16; -- width\nDEPTH=4;\nADDRESS_RADIX=HEX;\nDATA_RADIX=HEX;\nCONTENT BEGIN\n0 : 1234;\n1 : ABCD;\nEND;\n", []uint16{0x1234, 0xabcd}},
+		{"range", "WIDTH=16;DEPTH=4;DATA_RADIX=DEC;CONTENT BEGIN [0..2] : 7; 3 : 9; END;", []uint16{7, 7, 7, 9}},
+		{"consecutive", "WIDTH=16;DEPTH=4;DATA_RADIX=BIN;CONTENT BEGIN 1 : 1 10 11; END;", []uint16{0, 1, 2, 3}},
+	}
+	for _, tt := range tests {
+		got, err := ReadFormat(strings.NewReader(tt.src), FormatMIF)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !equalWords(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadFormatErrors(t *testing.T) {
+	tests := []struct {
+		format Format
+		src    string
+		want   string
+	}{
+		{FormatMIF, "WIDTH=16;DEPTH=4;CONTENT BEGIN 0 : ; END;", "line 1: MIF address \"0\" has no value"},
+		{FormatMIF, "WIDTH=16;\nDEPTH=4;\nCONTENT\n0 : 1;\nEND;", "line 3: MIF CONTENT without BEGIN"},
+		{FormatMIF, "WIDTH=16;\nCONTENT BEGIN\n0 : 1;\n1 : 2 : 3;\nEND;", "line 4: invalid MIF data"},
+		{FormatMIF, "WIDTH=16;\nCONTENT BEGIN\n0 : 1;\nzz : 2;\nEND;", "line 4: invalid MIF address \"zz\""},
+		{FormatMIF, "WIDTH=16;\nCONTENT BEGIN\n[3..1] : 2;\nEND;", "line 3: invalid MIF address range"},
+		{FormatMIF, "WIDTH=16;\nCONTENT BEGIN\n[0..3] : 1 2;\nEND;", "line 3: MIF address range \"[0..3]\" needs exactly one value"},
+		{FormatMIF, "WIDTH=16;\nCONTENT BEGIN\n0 1;\nEND;", "line 3: malformed MIF content"},
+		{FormatMIF, "% open\n\nWIDTH=8;", "line 1: unterminated MIF comment"},
+		{FormatMIF, "% a\ncomment %\nWIDTH=8;", "line 3: unsupported MIF width 8"},
+		{FormatMIF, "WIDTH=16;DEPTH=1;CONTENT BEGIN 0 : 1 2; END;", "MIF content exceeds DEPTH 1"},
+		{FormatIHex, ":020000001234B8\n020000001234B8\n", "line 2: malformed Intel HEX record"},
+		{FormatIHex, ":020000001234\n", "line 1: bad Intel HEX length or checksum"},
+		{FormatIHex, ":020000001234B9\n", "line 1: bad Intel HEX length or checksum"},
+		{FormatIHex, ":030000001234B7\n", "line 1: bad Intel HEX length or checksum"},
+		{FormatIHex, ":020000001234B8\n:00000002FE\n", "line 2: unsupported Intel HEX record type 02"},
+		{FormatIHex, ":020000001234B8\n", "missing Intel HEX end-of-file record"},
+		{FormatIHex, ":02000000zz34B8\n", "line 1: malformed Intel HEX record"},
+		{FormatBinLE, "abc", "odd number of bytes"},
+		{FormatReadmemh, "0001\n@zz\n", "line 2: invalid address"},
+		{FormatReadmemb, "0001\n2\n", "line 2: invalid word"},
+	}
+	for _, tt := range tests {
+		_, err := ReadFormat(strings.NewReader(tt.src), tt.format)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s %q: got error %v, want %q", tt.format, tt.src, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,477 @@
+package hdl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// compiledChip ピン名を添字に解決済みのチップ定義。チップの種類ごとに1度だけ作る。
+type compiledChip struct {
+	name      string
+	spec      *builtinSpec // 組み込みチップの場合
+	inputs    []PinDecl
+	outputs   []PinDecl
+	parts     []compiledPart
+	numWires  int
+	wireWidth []int
+}
+
+type compiledPart struct {
+	chip     *compiledChip
+	outConns []pinConn // 部品の出力 → 外側の内部ピン/出力ピン
+	inConns  []pinConn // 外側の信号 → 部品の入力
+}
+
+type outerKind uint8
+
+const (
+	outerInput outerKind = iota
+	outerOutput
+	outerWire
+	outerConst
+)
+
+// pinConn 部品のピン(inner)のビット範囲と外側の信号のビット範囲の対応。
+type pinConn struct {
+	inner   int
+	innerLo int
+	width   int
+	kind    outerKind
+	outer   int // outerConstの場合は定数のネット
+	outerLo int
+}
+
+// compile チップ名の定義を解決し、部品も含めて添字に変換する。
+func (l *Loader) compile(name string, stack []string) (*compiledChip, error) {
+	if cc, ok := l.compiled[name]; ok {
+		return cc, nil
+	}
+	for _, s := range stack {
+		if s == name {
+			return nil, fmt.Errorf("chip %s includes itself: %s", name, strings.Join(append(stack, name), " -> "))
+		}
+	}
+	stack = append(stack, name)
+
+	def, spec, err := l.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	cc := &compiledChip{name: name, spec: spec}
+	cc.inputs, cc.outputs = pinsOf(def, spec)
+	if spec != nil {
+		l.compiled[name] = cc
+		return cc, nil
+	}
+
+	inIdx, outIdx := declIndex(def.Inputs), declIndex(def.Outputs)
+	wireIdx := make(map[string]int)
+	outDriven := make([][]bool, len(def.Outputs))
+	for i, p := range def.Outputs {
+		outDriven[i] = make([]bool, p.Width)
+	}
+
+	// 1段目: 部品の出力の接続先を決め、内部ピンの幅を確定する。
+	cc.parts = make([]compiledPart, len(def.Parts))
+	for i, part := range def.Parts {
+		errorf := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%s line %d: %s: %s", name, part.Line, part.Chip, fmt.Sprintf(format, args...))
+		}
+		sub, err := l.compile(part.Chip, stack)
+		if errors.Is(err, ErrNotFound) && !strings.Contains(err.Error(), " line ") {
+			return nil, errorf("%v", err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		cp := compiledPart{chip: sub}
+		subIn, subOut := declIndex(sub.inputs), declIndex(sub.outputs)
+		for _, c := range part.Conns {
+			pi, isOut := subOut[c.Inner.Name]
+			if !isOut {
+				if _, isIn := subIn[c.Inner.Name]; !isIn {
+					return nil, errorf("unknown pin %s", c.Inner.Name)
+				}
+				continue
+			}
+			w := sub.outputs[pi].Width
+			if err := checkRange(c.Inner, w); err != nil {
+				return nil, errorf("%v", err)
+			}
+			pc := pinConn{inner: pi, innerLo: lowBit(c.Inner), width: c.Inner.width(w)}
+			if oi, ok := outIdx[c.Outer.Name]; ok {
+				ow := def.Outputs[oi].Width
+				if err := checkRange(c.Outer, ow); err != nil {
+					return nil, errorf("%v", err)
+				}
+				if c.Outer.width(ow) != pc.width {
+					return nil, errorf("width mismatch: %s is %d bits, %s is %d bits", c.Inner, pc.width, c.Outer, c.Outer.width(ow))
+				}
+				pc.kind, pc.outer, pc.outerLo = outerOutput, oi, lowBit(c.Outer)
+				for k := 0; k < pc.width; k++ {
+					if outDriven[oi][pc.outerLo+k] {
+						return nil, errorf("output pin %s has multiple drivers", c.Outer)
+					}
+					outDriven[oi][pc.outerLo+k] = true
+				}
+			} else {
+				switch {
+				case c.Outer.isConst():
+					return nil, errorf("cannot connect output %s to constant", c.Inner)
+				case hasPin(def.Inputs, c.Outer.Name):
+					return nil, errorf("cannot drive input pin %s", c.Outer.Name)
+				case c.Outer.Sub:
+					return nil, errorf("sub-bus of internal pin %s cannot be driven", c.Outer)
+				}
+				if _, ok := wireIdx[c.Outer.Name]; ok {
+					return nil, errorf("internal pin %s has multiple drivers", c.Outer.Name)
+				}
+				wireIdx[c.Outer.Name] = cc.numWires
+				cc.wireWidth = append(cc.wireWidth, pc.width)
+				pc.kind, pc.outer = outerWire, cc.numWires
+				cc.numWires++
+			}
+			cp.outConns = append(cp.outConns, pc)
+		}
+		cc.parts[i] = cp
+	}
+
+	// 2段目: 部品の入力の接続元を解決する。
+	for i, part := range def.Parts {
+		errorf := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%s line %d: %s: %s", name, part.Line, part.Chip, fmt.Sprintf(format, args...))
+		}
+		cp := &cc.parts[i]
+		subIn := declIndex(cp.chip.inputs)
+		for _, c := range part.Conns {
+			pi, isIn := subIn[c.Inner.Name]
+			if !isIn {
+				continue
+			}
+			w := cp.chip.inputs[pi].Width
+			if err := checkRange(c.Inner, w); err != nil {
+				return nil, errorf("%v", err)
+			}
+			pc := pinConn{inner: pi, innerLo: lowBit(c.Inner), width: c.Inner.width(w)}
+			outerWidth := pc.width
+			switch {
+			case c.Outer.isConst():
+				pc.kind, pc.outer = outerConst, int(netFalse)
+				if c.Outer.Name == "true" {
+					pc.outer = int(netTrue)
+				}
+			case hasPin(def.Inputs, c.Outer.Name):
+				ii := inIdx[c.Outer.Name]
+				if err := checkRange(c.Outer, def.Inputs[ii].Width); err != nil {
+					return nil, errorf("%v", err)
+				}
+				pc.kind, pc.outer, pc.outerLo = outerInput, ii, lowBit(c.Outer)
+				outerWidth = c.Outer.width(def.Inputs[ii].Width)
+			case hasPin(def.Outputs, c.Outer.Name):
+				return nil, errorf("cannot use output pin %s as an input", c.Outer.Name)
+			default:
+				wi, ok := wireIdx[c.Outer.Name]
+				if !ok {
+					return nil, errorf("undefined pin %s", c.Outer.Name)
+				}
+				if err := checkRange(c.Outer, cc.wireWidth[wi]); err != nil {
+					return nil, errorf("%v", err)
+				}
+				pc.kind, pc.outer, pc.outerLo = outerWire, wi, lowBit(c.Outer)
+				outerWidth = c.Outer.width(cc.wireWidth[wi])
+			}
+			if outerWidth != pc.width {
+				return nil, errorf("width mismatch: %s is %d bits, %s is %d bits", c.Inner, pc.width, c.Outer, outerWidth)
+			}
+			cp.inConns = append(cp.inConns, pc)
+		}
+	}
+	l.compiled[name] = cc
+	return cc, nil
+}
+
+func declIndex(pins []PinDecl) map[string]int {
+	m := make(map[string]int, len(pins))
+	for i, p := range pins {
+		m[p.Name] = i
+	}
+	return m
+}
+
+func hasPin(pins []PinDecl, name string) bool {
+	for _, p := range pins {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func lowBit(r PinRef) int {
+	if r.Sub {
+		return r.Lo
+	}
+	return 0
+}
+
+func checkRange(r PinRef, width int) error {
+	if r.Sub && r.Hi >= width {
+		return fmt.Errorf("sub-bus %s out of range (width %d)", r, width)
+	}
+	return nil
+}
+
+func sliceOf(nets []int32, r PinRef) []int32 {
+	if !r.Sub {
+		return nets
+	}
+	return nets[r.Lo : r.Hi+1]
+}
+
+// builder コンパイル済みのチップを平坦化してSimulatorを作る。
+// ネットはunion-findで同一視し、最後に代表元に置き換える。
+type builder struct {
+	parent []int32
+	sim    *Simulator
+}
+
+func build(l *Loader, name string) (*Simulator, error) {
+	cc, err := l.compile(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	b := &builder{sim: &Simulator{Name: name, pins: make(map[string]pinInfo)}}
+	b.newNet() // netFalse
+	b.newNet() // netTrue
+
+	ins := make([][]int32, len(cc.inputs))
+	outs := make([][]int32, len(cc.outputs))
+	for i, p := range cc.inputs {
+		ins[i] = b.newNets(p.Width)
+		b.sim.pins[p.Name] = pinInfo{nets: ins[i], input: true}
+		b.sim.pinOrder = append(b.sim.pinOrder, p.Name)
+	}
+	for i, p := range cc.outputs {
+		outs[i] = b.newNets(p.Width)
+		b.sim.pins[p.Name] = pinInfo{nets: outs[i]}
+		b.sim.pinOrder = append(b.sim.pinOrder, p.Name)
+	}
+	b.instantiate(cc, ins, outs)
+	if err := b.finish(); err != nil {
+		return nil, err
+	}
+	b.sim.nets[netTrue] = true
+	for i := range b.sim.nodes {
+		b.sim.markDirty(int32(i))
+	}
+	b.sim.Eval()
+	return b.sim, nil
+}
+
+func (b *builder) newNet() int32 {
+	n := int32(len(b.parent))
+	b.parent = append(b.parent, n)
+	return n
+}
+
+func (b *builder) newNets(width int) []int32 {
+	nets := make([]int32, width)
+	for i := range nets {
+		nets[i] = b.newNet()
+	}
+	return nets
+}
+
+func (b *builder) find(n int32) int32 {
+	for b.parent[n] != n {
+		b.parent[n] = b.parent[b.parent[n]]
+		n = b.parent[n]
+	}
+	return n
+}
+
+func (b *builder) union(x, y int32) {
+	x, y = b.find(x), b.find(y)
+	if x != y {
+		b.parent[x] = y
+	}
+}
+
+// instantiate チップ1つ分を展開する。ins, outsはこのチップのピンに割り当てるネット。
+func (b *builder) instantiate(cc *compiledChip, ins, outs [][]int32) {
+	if cc.spec != nil {
+		b.addBuiltin(cc, ins, outs)
+		return
+	}
+	wires := make([][]int32, cc.numWires)
+	partOuts := make([][][]int32, len(cc.parts))
+	for i, cp := range cc.parts {
+		po := make([][]int32, len(cp.chip.outputs))
+		for k, p := range cp.chip.outputs {
+			po[k] = b.newNets(p.Width)
+		}
+		for _, c := range cp.outConns {
+			src := po[c.inner][c.innerLo : c.innerLo+c.width]
+			if c.kind == outerWire {
+				wires[c.outer] = src
+				continue
+			}
+			for k, n := range src {
+				b.union(n, outs[c.outer][c.outerLo+k])
+			}
+		}
+		partOuts[i] = po
+	}
+	for i, cp := range cc.parts {
+		pi := make([][]int32, len(cp.chip.inputs))
+		for k, p := range cp.chip.inputs {
+			pi[k] = make([]int32, p.Width) // 未接続の入力はfalse (netFalse == 0)
+		}
+		for _, c := range cp.inConns {
+			dst := pi[c.inner][c.innerLo : c.innerLo+c.width]
+			switch c.kind {
+			case outerConst:
+				for k := range dst {
+					dst[k] = int32(c.outer)
+				}
+			case outerInput:
+				copy(dst, ins[c.outer][c.outerLo:])
+			case outerWire:
+				copy(dst, wires[c.outer][c.outerLo:])
+			}
+		}
+		b.instantiate(cp.chip, pi, partOuts[i])
+	}
+}
+
+// addBuiltin 組み込みチップの素子を追加する。
+func (b *builder) addBuiltin(cc *compiledChip, ins, outs [][]int32) {
+	s := b.sim
+	spec := cc.spec
+	switch spec.name {
+	case "Nand":
+		s.nodes = append(s.nodes, node{op: opNand, a: ins[0][0], b: ins[1][0], out: outs[0][0]})
+		return
+	case "DFF":
+		s.nodes = append(s.nodes, node{op: opDFF, a: ins[0][0], b: int32(len(s.dffState)), out: outs[0][0]})
+		s.dffs = append(s.dffs, int32(len(s.nodes)-1))
+		s.dffState = append(s.dffState, false)
+		return
+	}
+	inst := &builtinInst{spec: spec, node: int32(len(s.nodes)), pins: make(map[string][]int32), mem: make([]uint16, spec.memSize)}
+	for k, p := range spec.inputs {
+		inst.pins[p.Name] = ins[k]
+	}
+	for k, p := range spec.outputs {
+		inst.pins[p.Name] = outs[k]
+	}
+	s.nodes = append(s.nodes, node{op: opBuiltin, a: int32(len(s.builtins))})
+	s.builtins = append(s.builtins, inst)
+}
+
+// finish ネットを代表元に置き換え、組み合わせ回路の段数を決める。
+func (b *builder) finish() error {
+	s := b.sim
+	for i := range s.nodes {
+		n := &s.nodes[i]
+		if n.op != opBuiltin {
+			n.a, n.b, n.out = b.find(n.a), b.find(n.b), b.find(n.out)
+		}
+	}
+	for _, bi := range s.builtins {
+		for _, nets := range bi.pins {
+			for k := range nets {
+				nets[k] = b.find(nets[k])
+			}
+		}
+	}
+	for _, p := range s.pins {
+		for k := range p.nets {
+			p.nets[k] = b.find(p.nets[k])
+		}
+	}
+	numNets := len(b.parent)
+	s.nets = make([]bool, numNets)
+
+	// ネット → そのネットを組み合わせ入力として読む素子 (readerStart[net]からreaderStart[net+1]まで)
+	s.readerStart = make([]int32, numNets+1)
+	s.forEachCombInput(func(i, net int32) { s.readerStart[net+1]++ })
+	for i := 1; i <= numNets; i++ {
+		s.readerStart[i] += s.readerStart[i-1]
+	}
+	s.readers = make([]int32, s.readerStart[numNets])
+	fill := append([]int32(nil), s.readerStart[:numNets]...)
+	s.forEachCombInput(func(i, net int32) {
+		s.readers[fill[net]] = i
+		fill[net]++
+	})
+
+	// ネットを出力する素子。DFFの出力は組み合わせ回路の起点なので含めない。
+	driver := make([]int32, numNets)
+	for i := range driver {
+		driver[i] = -1
+	}
+	for i, n := range s.nodes {
+		switch n.op {
+		case opNand:
+			driver[n.out] = int32(i)
+		case opBuiltin:
+			bi := s.builtins[n.a]
+			for _, p := range bi.spec.outputs {
+				for _, net := range bi.pins[p.Name] {
+					driver[net] = int32(i)
+				}
+			}
+		}
+	}
+	indeg := make([]int32, len(s.nodes))
+	s.forEachCombInput(func(i, net int32) {
+		if driver[net] >= 0 {
+			indeg[i]++
+		}
+	})
+
+	// Kahnの方法で段数を決める。残った素子があれば組み合わせ回路のループである。
+	queue := make([]int32, 0, len(s.nodes))
+	for i := range s.nodes {
+		if indeg[i] == 0 {
+			queue = append(queue, int32(i))
+		}
+	}
+	maxLevel := int32(0)
+	visit := func(i int32, net int32) {
+		for _, j := range s.readers[s.readerStart[net]:s.readerStart[net+1]] {
+			if l := s.nodes[i].level + 1; l > s.nodes[j].level {
+				s.nodes[j].level = l
+				if l > maxLevel {
+					maxLevel = l
+				}
+			}
+			indeg[j]--
+			if indeg[j] == 0 {
+				queue = append(queue, j)
+			}
+		}
+	}
+	for head := 0; head < len(queue); head++ {
+		i := queue[head]
+		switch n := s.nodes[i]; n.op {
+		case opNand:
+			visit(i, n.out)
+		case opBuiltin:
+			bi := s.builtins[n.a]
+			for _, p := range bi.spec.outputs {
+				for _, net := range bi.pins[p.Name] {
+					visit(i, net)
+				}
+			}
+		}
+	}
+	if len(queue) != len(s.nodes) {
+		return fmt.Errorf("chip %s has a combinational loop", s.Name)
+	}
+	s.dirty = make([][]int32, maxLevel+1)
+	s.queued = make([]bool, len(s.nodes))
+	return nil
+}
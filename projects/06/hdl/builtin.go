@@ -0,0 +1,163 @@
+package hdl
+
+// builtinSpec 組み込みチップの定義。
+// NandとDFFは基本素子で、それ以外は公式シミュレータが組み込みで持つチップである。
+// ARegister, DRegister, ROM32K, Screen, Keyboardは常に組み込みを使い、
+// それ以外はHDLファイルが見つからない場合(またはPreferBuiltin指定時)に使う。
+type builtinSpec struct {
+	name    string
+	inputs  []PinDecl
+	outputs []PinDecl
+	combIn  []string // 出力が組み合わせ回路として依存する入力ピン
+	memSize int      // 内部状態のワード数 (テストスクリプトから Name[i] で参照する)
+	eval    func(b *builtinInst, s *Simulator)
+	tick    func(b *builtinInst, s *Simulator)
+	tock    func(b *builtinInst, s *Simulator)
+}
+
+// builtinInst 組み込みチップの実体。
+type builtinInst struct {
+	spec  *builtinSpec
+	node  int32
+	pins  map[string][]int32
+	mem   []uint16
+	next  uint16 // tickで取り込んだ値
+	write bool   // tickで書き込みがあったか
+	addr  int    // tickで取り込んだアドレス
+}
+
+// state 内部状態mem[i]の値を返す。公式のシミュレータと同様に、
+// tickで取り込んだ値はtockを待たずに内部状態として見える。
+func (b *builtinInst) state(i int) uint16 {
+	if b.write && b.addr == i {
+		return b.next
+	}
+	return b.mem[i]
+}
+
+// alwaysBuiltin HDLファイルを探さずに常に組み込みを使うチップ。
+var alwaysBuiltin = map[string]bool{
+	"Nand": true, "DFF": true,
+	"ARegister": true, "DRegister": true,
+	"ROM32K": true, "Screen": true, "Keyboard": true,
+}
+
+var builtins = map[string]*builtinSpec{}
+
+func init() {
+	w16 := func(name string) PinDecl { return PinDecl{name, 16} }
+	w1 := func(name string) PinDecl { return PinDecl{name, 1} }
+
+	// Nand, DFFはSimulatorのノードとして直接実装する。ここではピン定義のみ。
+	builtins["Nand"] = &builtinSpec{name: "Nand", inputs: []PinDecl{w1("a"), w1("b")}, outputs: []PinDecl{w1("out")}}
+	builtins["DFF"] = &builtinSpec{name: "DFF", inputs: []PinDecl{w1("in")}, outputs: []PinDecl{w1("out")}}
+
+	register := func(name string, width int) *builtinSpec {
+		return &builtinSpec{
+			name:    name,
+			inputs:  []PinDecl{{"in", width}, w1("load")},
+			outputs: []PinDecl{{"out", width}},
+			memSize: 1,
+			eval:    evalRegister,
+			tick:    tickRegister,
+			tock:    tockRegister,
+		}
+	}
+	builtins["Bit"] = register("Bit", 1)
+	builtins["Register"] = register("Register", 16)
+	builtins["ARegister"] = register("ARegister", 16)
+	builtins["DRegister"] = register("DRegister", 16)
+
+	builtins["PC"] = &builtinSpec{
+		name:    "PC",
+		inputs:  []PinDecl{w16("in"), w1("load"), w1("inc"), w1("reset")},
+		outputs: []PinDecl{w16("out")},
+		memSize: 1,
+		eval:    evalRegister,
+		tick:    tickPC,
+		tock:    tockRegister,
+	}
+
+	ram := func(name string, addrBits int) *builtinSpec {
+		return &builtinSpec{
+			name:    name,
+			inputs:  []PinDecl{w16("in"), w1("load"), {"address", addrBits}},
+			outputs: []PinDecl{w16("out")},
+			combIn:  []string{"address"},
+			memSize: 1 << addrBits,
+			eval:    evalMemory,
+			tick:    tickMemory,
+			tock:    tockMemory,
+		}
+	}
+	for name, bits := range map[string]int{
+		"RAM8": 3, "RAM64": 6, "RAM512": 9, "RAM4K": 12, "RAM16K": 14,
+	} {
+		builtins[name] = ram(name, bits)
+	}
+	builtins["Screen"] = ram("Screen", 13)
+
+	builtins["ROM32K"] = &builtinSpec{
+		name:    "ROM32K",
+		inputs:  []PinDecl{{"address", 15}},
+		outputs: []PinDecl{w16("out")},
+		combIn:  []string{"address"},
+		memSize: 32768,
+		eval:    evalMemory,
+	}
+	builtins["Keyboard"] = &builtinSpec{
+		name:    "Keyboard",
+		outputs: []PinDecl{w16("out")},
+		memSize: 1,
+		eval:    evalRegister,
+	}
+}
+
+func evalRegister(b *builtinInst, s *Simulator) {
+	s.setBus(b.pins["out"], int(b.mem[0]))
+}
+
+func tickRegister(b *builtinInst, s *Simulator) {
+	b.write = s.getBus(b.pins["load"]) != 0
+	b.next = uint16(s.getBus(b.pins["in"]))
+}
+
+func tockRegister(b *builtinInst, s *Simulator) {
+	if b.write {
+		b.mem[0] = b.next
+		b.write = false
+	}
+	s.markDirty(b.node)
+}
+
+func tickPC(b *builtinInst, s *Simulator) {
+	b.write = true
+	switch {
+	case s.getBus(b.pins["reset"]) != 0:
+		b.next = 0
+	case s.getBus(b.pins["load"]) != 0:
+		b.next = uint16(s.getBus(b.pins["in"]))
+	case s.getBus(b.pins["inc"]) != 0:
+		b.next = b.mem[0] + 1
+	default:
+		b.next = b.mem[0]
+	}
+}
+
+func evalMemory(b *builtinInst, s *Simulator) {
+	s.setBus(b.pins["out"], int(b.mem[s.getBus(b.pins["address"])]))
+}
+
+func tickMemory(b *builtinInst, s *Simulator) {
+	b.write = s.getBus(b.pins["load"]) != 0
+	b.addr = s.getBus(b.pins["address"])
+	b.next = uint16(s.getBus(b.pins["in"]))
+}
+
+func tockMemory(b *builtinInst, s *Simulator) {
+	if b.write {
+		b.mem[b.addr] = b.next
+		b.write = false
+	}
+	s.markDirty(b.node)
+}
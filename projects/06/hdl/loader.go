@@ -0,0 +1,95 @@
+package hdl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound チップの定義が見つからない。
+var ErrNotFound = errors.New("chip not found")
+
+// Loader チップ名から定義を解決する。
+// Dirsを先頭から順に探して Name.hdl を読み、見つからなければ組み込みチップを使う。
+type Loader struct {
+	Dirs          []string
+	PreferBuiltin map[string]bool // HDLファイルがあっても組み込みを使うチップ
+	defs          map[string]*ChipDef
+	compiled      map[string]*compiledChip
+}
+
+func NewLoader(dirs ...string) *Loader {
+	return &Loader{
+		Dirs:          dirs,
+		PreferBuiltin: make(map[string]bool),
+		defs:          make(map[string]*ChipDef),
+		compiled:      make(map[string]*compiledChip),
+	}
+}
+
+// Build nameのチップを組み立ててシミュレータを返す。
+func (l *Loader) Build(name string) (*Simulator, error) {
+	return build(l, name)
+}
+
+// BuildFile .hdlファイルのチップを組み立てる。ファイルのあるディレクトリを最優先で探す。
+func (l *Loader) BuildFile(path string) (*Simulator, error) {
+	dir := filepath.Dir(path)
+	if len(l.Dirs) == 0 || l.Dirs[0] != dir {
+		l.Dirs = append([]string{dir}, l.Dirs...)
+	}
+	return l.Build(strings.TrimSuffix(filepath.Base(path), ".hdl"))
+}
+
+// resolve チップ名をHDL定義または組み込みチップに解決する。
+func (l *Loader) resolve(name string) (*ChipDef, *builtinSpec, error) {
+	if alwaysBuiltin[name] || l.PreferBuiltin[name] {
+		if spec, ok := builtins[name]; ok {
+			return nil, spec, nil
+		}
+	}
+	if def, ok := l.defs[name]; ok {
+		return def, nil, nil
+	}
+	for _, dir := range l.Dirs {
+		path := filepath.Join(dir, name+".hdl")
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		def, err := Parse(f)
+		f.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if def.Name != name {
+			return nil, nil, fmt.Errorf("%s: chip name %s does not match file name", path, def.Name)
+		}
+		if def.Builtin != "" {
+			spec, ok := builtins[def.Builtin]
+			if !ok {
+				return nil, nil, fmt.Errorf("%s: unknown builtin chip %s", path, def.Builtin)
+			}
+			return nil, spec, nil
+		}
+		l.defs[name] = def
+		return def, nil, nil
+	}
+	if spec, ok := builtins[name]; ok {
+		return nil, spec, nil
+	}
+	return nil, nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// pins チップのIN/OUT定義を返す。
+func pinsOf(def *ChipDef, spec *builtinSpec) (inputs, outputs []PinDecl) {
+	if spec != nil {
+		return spec.inputs, spec.outputs
+	}
+	return def.Inputs, def.Outputs
+}
@@ -0,0 +1,371 @@
+// Package hdl はnand2tetrisのHDLを解釈し、チップをゲートレベルでシミュレーションする。
+// NandとDFFを基本素子とし、それ以外のチップは.hdlファイルから組み立てる。
+package hdl
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ChipDef 1つのCHIP定義。
+type ChipDef struct {
+	Name    string
+	Inputs  []PinDecl
+	Outputs []PinDecl
+	Parts   []Part
+	Builtin string // "BUILTIN Xxx;" の場合の組み込みチップ名
+}
+
+// PinDecl IN/OUTで宣言されたピン。
+type PinDecl struct {
+	Name  string
+	Width int
+}
+
+// Part PARTS内の1部品。
+type Part struct {
+	Chip  string
+	Conns []Conn
+	Line  int
+}
+
+// Conn 部品のピン(Inner)と外側の信号(Outer)の接続 "inner=outer"。
+type Conn struct {
+	Inner PinRef
+	Outer PinRef
+}
+
+// PinRef ピン名と任意の添字 "a", "a[3]", "a[0..7]"。
+type PinRef struct {
+	Name string
+	Sub  bool // 添字があるか
+	Lo   int
+	Hi   int
+}
+
+func (r PinRef) String() string {
+	switch {
+	case !r.Sub:
+		return r.Name
+	case r.Lo == r.Hi:
+		return fmt.Sprintf("%s[%d]", r.Name, r.Lo)
+	default:
+		return fmt.Sprintf("%s[%d..%d]", r.Name, r.Lo, r.Hi)
+	}
+}
+
+// width 添字付きの場合のビット幅。添字なしの場合はfullを返す。
+func (r PinRef) width(full int) int {
+	if !r.Sub {
+		return full
+	}
+	return r.Hi - r.Lo + 1
+}
+
+// isConst true/falseの定数か
+func (r PinRef) isConst() bool {
+	return r.Name == "true" || r.Name == "false"
+}
+
+// ParseError HDLの文法エラー。
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Parse HDLを読み込んでCHIP定義を返す。
+func Parse(r io.Reader) (*ChipDef, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	toks, err := lex(string(b))
+	if err != nil {
+		return nil, err
+	}
+	p := &hdlParser{toks: toks}
+	return p.parseChip()
+}
+
+type hdlToken struct {
+	text string
+	line int
+}
+
+// lex コメントを除去し、識別子・数値・記号に分割する。
+func lex(src string) ([]hdlToken, error) {
+	var toks []hdlToken
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, &ParseError{line, "unterminated comment"}
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+		case strings.HasPrefix(src[i:], ".."):
+			toks = append(toks, hdlToken{"..", line})
+			i += 2
+		case strings.IndexByte("{}()[],;:=", c) >= 0:
+			toks = append(toks, hdlToken{string(c), line})
+			i++
+		case isIdentChar(c):
+			start := i
+			for i < len(src) && isIdentChar(src[i]) && !strings.HasPrefix(src[i:], "..") {
+				i++
+			}
+			toks = append(toks, hdlToken{src[start:i], line})
+		default:
+			return nil, &ParseError{line, fmt.Sprintf("unexpected character %q", c)}
+		}
+	}
+	return toks, nil
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '.' || c == '$' ||
+		'0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+type hdlParser struct {
+	toks []hdlToken
+	pos  int
+}
+
+func (p *hdlParser) line() int {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos].line
+	}
+	if len(p.toks) > 0 {
+		return p.toks[len(p.toks)-1].line
+	}
+	return 1
+}
+
+func (p *hdlParser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos].text
+	}
+	return ""
+}
+
+func (p *hdlParser) next() string {
+	s := p.peek()
+	p.pos++
+	return s
+}
+
+func (p *hdlParser) expect(s string) error {
+	if got := p.peek(); got != s {
+		return p.errorf("expected %q, got %q", s, got)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *hdlParser) errorf(format string, args ...interface{}) error {
+	return &ParseError{p.line(), fmt.Sprintf(format, args...)}
+}
+
+func (p *hdlParser) ident() (string, error) {
+	s := p.peek()
+	if s == "" || !isIdentChar(s[0]) || '0' <= s[0] && s[0] <= '9' {
+		return "", p.errorf("expected identifier, got %q", s)
+	}
+	p.pos++
+	return s, nil
+}
+
+func (p *hdlParser) number() (int, error) {
+	s := p.peek()
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, p.errorf("expected number, got %q", s)
+	}
+	p.pos++
+	return n, nil
+}
+
+// CHIP name { IN ...; OUT ...; PARTS: ... | BUILTIN name; CLOCKED ...; }
+func (p *hdlParser) parseChip() (*ChipDef, error) {
+	if err := p.expect("CHIP"); err != nil {
+		return nil, err
+	}
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	def := &ChipDef{Name: name}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek() {
+		case "IN":
+			p.pos++
+			if def.Inputs, err = p.parsePinDecls(); err != nil {
+				return nil, err
+			}
+		case "OUT":
+			p.pos++
+			if def.Outputs, err = p.parsePinDecls(); err != nil {
+				return nil, err
+			}
+		case "PARTS":
+			p.pos++
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			for p.peek() != "}" && p.peek() != "" {
+				part, err := p.parsePart()
+				if err != nil {
+					return nil, err
+				}
+				def.Parts = append(def.Parts, part)
+			}
+		case "BUILTIN":
+			p.pos++
+			if def.Builtin, err = p.ident(); err != nil {
+				return nil, err
+			}
+			if err := p.expect(";"); err != nil {
+				return nil, err
+			}
+		case "CLOCKED":
+			// 組み込みチップの宣言の一部。クロック動作は組み込み側で定義済みなので読み飛ばす。
+			for p.peek() != ";" && p.peek() != "" {
+				p.pos++
+			}
+			if err := p.expect(";"); err != nil {
+				return nil, err
+			}
+		case "}":
+			p.pos++
+			if p.pos < len(p.toks) {
+				return nil, p.errorf("unexpected %q after chip definition", p.peek())
+			}
+			return def, nil
+		default:
+			return nil, p.errorf("unexpected %q in chip %s", p.peek(), name)
+		}
+	}
+}
+
+// pin (, pin)* ;
+func (p *hdlParser) parsePinDecls() ([]PinDecl, error) {
+	var pins []PinDecl
+	if p.peek() == ";" {
+		p.pos++
+		return pins, nil
+	}
+	for {
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		pin := PinDecl{Name: name, Width: 1}
+		if p.peek() == "[" {
+			p.pos++
+			if pin.Width, err = p.number(); err != nil {
+				return nil, err
+			}
+			if pin.Width < 1 || pin.Width > 16 {
+				return nil, p.errorf("invalid width %d for pin %s", pin.Width, name)
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		}
+		pins = append(pins, pin)
+		switch p.next() {
+		case ",":
+			continue
+		case ";":
+			return pins, nil
+		default:
+			p.pos--
+			return nil, p.errorf("expected ',' or ';' in pin list, got %q", p.peek())
+		}
+	}
+}
+
+// Name(conn, conn, ...);
+func (p *hdlParser) parsePart() (Part, error) {
+	part := Part{Line: p.line()}
+	var err error
+	if part.Chip, err = p.ident(); err != nil {
+		return part, err
+	}
+	if err := p.expect("("); err != nil {
+		return part, err
+	}
+	for {
+		inner, err := p.parsePinRef()
+		if err != nil {
+			return part, err
+		}
+		if err := p.expect("="); err != nil {
+			return part, err
+		}
+		outer, err := p.parsePinRef()
+		if err != nil {
+			return part, err
+		}
+		part.Conns = append(part.Conns, Conn{Inner: inner, Outer: outer})
+		if p.peek() == "," {
+			p.pos++
+			continue
+		}
+		break
+	}
+	if err := p.expect(")"); err != nil {
+		return part, err
+	}
+	return part, p.expect(";")
+}
+
+// name | name[n] | name[lo..hi]
+func (p *hdlParser) parsePinRef() (PinRef, error) {
+	name, err := p.ident()
+	if err != nil {
+		return PinRef{}, err
+	}
+	ref := PinRef{Name: name}
+	if p.peek() != "[" {
+		return ref, nil
+	}
+	p.pos++
+	ref.Sub = true
+	if ref.Lo, err = p.number(); err != nil {
+		return ref, err
+	}
+	ref.Hi = ref.Lo
+	if p.peek() == ".." {
+		p.pos++
+		if ref.Hi, err = p.number(); err != nil {
+			return ref, err
+		}
+	}
+	if ref.Hi < ref.Lo || ref.Hi > 15 {
+		return ref, p.errorf("invalid sub-bus %s", ref)
+	}
+	return ref, p.expect("]")
+}
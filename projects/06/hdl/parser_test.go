@@ -0,0 +1,81 @@
+package hdl
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	src := `// コメント
+/** 複数行の
+    コメント */
+CHIP Mux4 {
+    IN a[4], b[4], sel;
+    OUT out[4], any;
+
+    PARTS:
+    Not(in=sel, out=nsel);
+    And(a=a[0..1], b=true, out=out[0..1]);  // 定数と添字
+    Or(a=b[3], b=false, out=out[2], out=any);
+}
+`
+	got, err := Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ChipDef{
+		Name:    "Mux4",
+		Inputs:  []PinDecl{{"a", 4}, {"b", 4}, {"sel", 1}},
+		Outputs: []PinDecl{{"out", 4}, {"any", 1}},
+		Parts: []Part{
+			{Chip: "Not", Line: 9, Conns: []Conn{{PinRef{Name: "in"}, PinRef{Name: "sel"}}, {PinRef{Name: "out"}, PinRef{Name: "nsel"}}}},
+			{Chip: "And", Line: 10, Conns: []Conn{
+				{PinRef{Name: "a"}, PinRef{Name: "a", Sub: true, Lo: 0, Hi: 1}},
+				{PinRef{Name: "b"}, PinRef{Name: "true"}},
+				{PinRef{Name: "out"}, PinRef{Name: "out", Sub: true, Lo: 0, Hi: 1}},
+			}},
+			{Chip: "Or", Line: 11, Conns: []Conn{
+				{PinRef{Name: "a"}, PinRef{Name: "b", Sub: true, Lo: 3, Hi: 3}},
+				{PinRef{Name: "b"}, PinRef{Name: "false"}},
+				{PinRef{Name: "out"}, PinRef{Name: "out", Sub: true, Lo: 2, Hi: 2}},
+				{PinRef{Name: "out"}, PinRef{Name: "any"}},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+
+	builtin, err := Parse(strings.NewReader("CHIP Bit { IN in, load; OUT out; BUILTIN Bit; CLOCKED in, load; }"))
+	if err != nil || builtin.Builtin != "Bit" || len(builtin.Parts) != 0 {
+		t.Errorf("builtin chip: %+v, %v", builtin, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"CHIP {", `line 1: expected identifier, got "{"`},
+		{"CHIP A {\n IN a[17];\n}", "line 2: invalid width 17 for pin a"},
+		{"CHIP A {\n IN a b;\n}", `line 2: expected ',' or ';' in pin list, got "b"`},
+		{"CHIP A {\n IN a;\n PARTS:\n Not(in=a[3..1], out=x);\n}", "line 4: invalid sub-bus a[3..1]"},
+		{"CHIP A {\n PARTS:\n Not(in=a[16], out=x);\n}", "line 3: invalid sub-bus a[16]"},
+		{"CHIP A {\n PARTS:\n Not(in a);\n}", `line 3: expected "=", got "a"`},
+		{"CHIP A {\n PARTS:\n Not(in=a)\n}", `line 4: expected ";", got "}"`},
+		{"CHIP A {\n FOO;\n}", `line 2: unexpected "FOO" in chip A`},
+		{"CHIP A { }\nCHIP B { }", `line 2: unexpected "CHIP" after chip definition`},
+		{"CHIP A {\n /* open", "line 2: unterminated comment"},
+		{"CHIP A {\n IN a#;\n}", "line 2: unexpected character '#'"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(strings.NewReader(tt.src))
+		var perr *ParseError
+		if !errors.As(err, &perr) || err.Error() != tt.want {
+			t.Errorf("%q: got %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}
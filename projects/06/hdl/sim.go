@@ -0,0 +1,282 @@
+package hdl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	netFalse int32 = 0 // 定数false
+	netTrue  int32 = 1 // 定数true
+)
+
+type nodeOp uint8
+
+const (
+	opNand nodeOp = iota
+	opDFF
+	opBuiltin
+)
+
+// node 回路を平坦化した後の1素子。
+type node struct {
+	op    nodeOp
+	a, b  int32 // Nandの入力 / DFFの入力とdffState上の添字 / 組み込みチップの添字
+	out   int32
+	level int32 // 組み合わせ回路としての段数
+}
+
+// pinInfo 最上位チップのピン。
+type pinInfo struct {
+	nets  []int32 // 下位ビットから順
+	input bool
+}
+
+// Simulator 平坦化したチップをイベント駆動でシミュレーションする。
+// 値が変化したネットを読む素子だけを段数順に再評価する。
+type Simulator struct {
+	Name        string
+	nets        []bool
+	nodes       []node
+	readers     []int32 // ネットを組み合わせ入力として読む素子 (readerStartで区切る)
+	readerStart []int32
+	dirty       [][]int32 // 段数ごとの再評価待ち素子
+	queued      []bool
+	dffs        []int32
+	dffState    []bool
+	builtins    []*builtinInst
+	pins        map[string]pinInfo
+	pinOrder    []string
+	time        int
+	ticked      bool
+}
+
+// forEachCombInput 各素子が組み合わせ入力として読むネットを列挙する。
+func (s *Simulator) forEachCombInput(f func(i, net int32)) {
+	for i, n := range s.nodes {
+		switch n.op {
+		case opNand:
+			f(int32(i), n.a)
+			f(int32(i), n.b)
+		case opBuiltin:
+			bi := s.builtins[n.a]
+			for _, p := range bi.spec.combIn {
+				for _, net := range bi.pins[p] {
+					f(int32(i), net)
+				}
+			}
+		}
+	}
+}
+
+func (s *Simulator) markDirty(i int32) {
+	if s.queued[i] {
+		return
+	}
+	s.queued[i] = true
+	l := s.nodes[i].level
+	s.dirty[l] = append(s.dirty[l], i)
+}
+
+func (s *Simulator) setNet(n int32, v bool) {
+	if s.nets[n] == v {
+		return
+	}
+	s.nets[n] = v
+	for _, r := range s.readers[s.readerStart[n]:s.readerStart[n+1]] {
+		s.markDirty(r)
+	}
+}
+
+// getBus ネット列の値を符号なし整数として返す。
+func (s *Simulator) getBus(nets []int32) int {
+	v := 0
+	for k := len(nets) - 1; k >= 0; k-- {
+		v <<= 1
+		if s.nets[nets[k]] {
+			v |= 1
+		}
+	}
+	return v
+}
+
+func (s *Simulator) setBus(nets []int32, v int) {
+	for k, n := range nets {
+		s.setNet(n, v>>k&1 == 1)
+	}
+}
+
+// Eval 組み合わせ回路を評価する。
+func (s *Simulator) Eval() {
+	for l := range s.dirty {
+		for len(s.dirty[l]) > 0 {
+			i := s.dirty[l][len(s.dirty[l])-1]
+			s.dirty[l] = s.dirty[l][:len(s.dirty[l])-1]
+			s.queued[i] = false
+			n := &s.nodes[i]
+			switch n.op {
+			case opNand:
+				s.setNet(n.out, !(s.nets[n.a] && s.nets[n.b]))
+			case opBuiltin:
+				bi := s.builtins[n.a]
+				if bi.spec.eval != nil {
+					bi.spec.eval(bi, s)
+				}
+			}
+		}
+	}
+}
+
+// Tick クロックの立ち上がり。回路を評価してから順序回路が入力を取り込む。
+func (s *Simulator) Tick() {
+	s.Eval()
+	for _, i := range s.dffs {
+		n := s.nodes[i]
+		s.dffState[n.b] = s.nets[n.a]
+	}
+	for _, bi := range s.builtins {
+		if bi.spec.tick != nil {
+			bi.spec.tick(bi, s)
+		}
+	}
+	s.ticked = true
+}
+
+// Tock クロックの立ち下がり。順序回路の出力を更新して回路を評価する。
+func (s *Simulator) Tock() {
+	for _, i := range s.dffs {
+		n := s.nodes[i]
+		s.setNet(n.out, s.dffState[n.b])
+	}
+	for _, bi := range s.builtins {
+		if bi.spec.tock != nil {
+			bi.spec.tock(bi, s)
+		}
+	}
+	s.Eval()
+	s.ticked = false
+	s.time++
+}
+
+// Time テストスクリプトのtime変数 ("3", tick後は"3+")。
+func (s *Simulator) Time() string {
+	if s.ticked {
+		return strconv.Itoa(s.time) + "+"
+	}
+	return strconv.Itoa(s.time)
+}
+
+// Pins 最上位チップのピン名を宣言順に返す。
+func (s *Simulator) Pins() []string {
+	return s.pinOrder
+}
+
+// Set 入力ピン("a", "in[3]", "sel[0..1]")または組み込み部品の状態("RAM16K[3]", "ARegister[]")に値を設定する。
+// 値はEvalまたはTick/Tockで回路に反映される。
+func (s *Simulator) Set(name string, v int) error {
+	ref, err := parseVarName(name)
+	if err != nil {
+		return err
+	}
+	if p, ok := s.pins[ref.Name]; ok {
+		if !p.input {
+			return fmt.Errorf("%s is not an input pin", ref.Name)
+		}
+		if err := checkRange(ref, len(p.nets)); err != nil {
+			return err
+		}
+		s.setBus(sliceOf(p.nets, ref), v)
+		return nil
+	}
+	bi, idx, err := s.partState(name)
+	if err != nil {
+		return err
+	}
+	bi.mem[idx] = uint16(v)
+	s.markDirty(bi.node)
+	return nil
+}
+
+// Get ピンまたは組み込み部品の状態の値を返す。16bitの値は符号付きで返す。
+func (s *Simulator) Get(name string) (int, error) {
+	ref, err := parseVarName(name)
+	if err != nil {
+		return 0, err
+	}
+	if p, ok := s.pins[ref.Name]; ok {
+		if err := checkRange(ref, len(p.nets)); err != nil {
+			return 0, err
+		}
+		return signed(s.getBus(sliceOf(p.nets, ref)), ref.width(len(p.nets))), nil
+	}
+	bi, idx, err := s.partState(name)
+	if err != nil {
+		return 0, err
+	}
+	return int(int16(bi.state(idx))), nil
+}
+
+// LoadROM ROM32K部品にプログラムを書き込む。
+func (s *Simulator) LoadROM(program []uint16) error {
+	for _, bi := range s.builtins {
+		if bi.spec.name == "ROM32K" {
+			if len(program) > len(bi.mem) {
+				return fmt.Errorf("program too large for ROM32K")
+			}
+			copy(bi.mem, program)
+			for k := len(program); k < len(bi.mem); k++ {
+				bi.mem[k] = 0
+			}
+			s.markDirty(bi.node)
+			return nil
+		}
+	}
+	return fmt.Errorf("chip %s has no ROM32K part", s.Name)
+}
+
+// partState "Name[i]" / "Name[]" を組み込み部品の内部状態に解決する。
+func (s *Simulator) partState(name string) (*builtinInst, int, error) {
+	part, idx, found := strings.Cut(name, "[")
+	if !found || !strings.HasSuffix(idx, "]") {
+		return nil, 0, fmt.Errorf("unknown pin %s", name)
+	}
+	idx = strings.TrimSuffix(idx, "]")
+	for _, bi := range s.builtins {
+		if bi.spec.name != part || bi.spec.memSize == 0 {
+			continue
+		}
+		if idx == "" {
+			return bi, 0, nil
+		}
+		i, err := strconv.Atoi(idx)
+		if err != nil || i < 0 || i >= len(bi.mem) {
+			return nil, 0, fmt.Errorf("index out of range: %s", name)
+		}
+		return bi, i, nil
+	}
+	return nil, 0, fmt.Errorf("unknown pin %s (no builtin %s part)", name, part)
+}
+
+// parseVarName "a", "a[3]", "a[0..7]" を解釈する。
+func parseVarName(name string) (PinRef, error) {
+	toks, err := lex(name)
+	if err != nil {
+		return PinRef{}, err
+	}
+	p := &hdlParser{toks: toks}
+	ref, err := p.parsePinRef()
+	if err != nil || p.pos != len(toks) {
+		// 添字が範囲外の"RAM16K[3]"などは組み込み部品の状態として扱う。
+		return PinRef{Name: name}, nil
+	}
+	return ref, nil
+}
+
+// signed widthが16bitの場合に2の補数として符号付きに変換する。
+func signed(v, width int) int {
+	if width == 16 {
+		return int(int16(v))
+	}
+	return v
+}
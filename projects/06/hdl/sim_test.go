@@ -0,0 +1,180 @@
+package hdl
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// chipDir chipsの各定義を Name.hdl として一時ディレクトリに書き、そのディレクトリを返す。
+func chipDir(t *testing.T, chips map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range chips {
+		if err := os.WriteFile(filepath.Join(dir, name+".hdl"), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+var gates = map[string]string{
+	"Not": "CHIP Not { IN in; OUT out; PARTS: Nand(a=in, b=in, out=out); }",
+	"And": "CHIP And { IN a, b; OUT out; PARTS: Nand(a=a, b=b, out=n); Not(in=n, out=out); }",
+	"Or":  "CHIP Or { IN a, b; OUT out; PARTS: Not(in=a, out=na); Not(in=b, out=nb); Nand(a=na, b=nb, out=out); }",
+	"Xor": "CHIP Xor { IN a, b; OUT out; PARTS: Or(a=a, b=b, out=o); Nand(a=a, b=b, out=n); And(a=o, b=n, out=out); }",
+	// 添字, 定数, 同じ出力の複数の接続先
+	"Bus": `CHIP Bus { IN in[4]; OUT out[4], low[2], x;
+	PARTS:
+	Not(in=in[0], out=out[3]);
+	Xor(a=in[1], b=true, out=out[2]);
+	And(a=in[2], b=false, out=out[1]);
+	Or(a=in[3], b=in[3], out=out[0], out=x);
+	Xor(a=in[0], b=in[1], out=low[0]);
+	Not(in=in[3], out=low[1]);
+}`,
+	// DFFの出力を反転して戻す: tickとtockのたびに0, 1, 0, ...
+	"Toggle": "CHIP Toggle { OUT out; PARTS: DFF(in=nq, out=q, out=out); Not(in=q, out=nq); }",
+	"Mem":    "CHIP Mem { IN in[16], load, address[3]; OUT out[16]; PARTS: RAM8(in=in, load=load, address=address, out=out); }",
+}
+
+func TestCombinational(t *testing.T) {
+	l := NewLoader(chipDir(t, gates))
+	xor, err := l.Build("Xor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range [][3]int{{0, 0, 0}, {0, 1, 1}, {1, 0, 1}, {1, 1, 0}} {
+		xor.Set("a", tt[0])
+		xor.Set("b", tt[1])
+		xor.Eval()
+		if got, _ := xor.Get("out"); got != tt[2] {
+			t.Errorf("Xor(%d, %d) = %d", tt[0], tt[1], got)
+		}
+	}
+	if pins := xor.Pins(); strings.Join(pins, ",") != "a,b,out" {
+		t.Errorf("pins %v", pins)
+	}
+
+	bus, err := l.Build("Bus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for in := 0; in < 16; in++ {
+		bit := func(i int) int { return in >> i & 1 }
+		wantOut := (1-bit(0))<<3 | (1-bit(1))<<2 | 0<<1 | bit(3)
+		wantLow := (bit(0)^bit(1))<<0 | (1-bit(3))<<1
+		bus.Set("in", in)
+		bus.Eval()
+		out, _ := bus.Get("out")
+		low, _ := bus.Get("low")
+		x, _ := bus.Get("x")
+		hi, _ := bus.Get("out[2..3]")
+		if out != wantOut || low != wantLow || x != bit(3) || hi != wantOut>>2 {
+			t.Errorf("in=%04b: out=%04b low=%02b x=%d out[2..3]=%02b, want %04b %02b %d", in, out, low, x, hi, wantOut, wantLow, bit(3))
+		}
+	}
+	// 部分的な設定
+	bus.Set("in", 0)
+	bus.Set("in[3]", 1)
+	bus.Eval()
+	if x, _ := bus.Get("x"); x != 1 {
+		t.Errorf("in[3]=1: x=%d", x)
+	}
+}
+
+func TestSequential(t *testing.T) {
+	l := NewLoader(chipDir(t, gates))
+	toggle, err := l.Build("Toggle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	toggle.Eval()
+	times := []string{"0"}
+	outs := []int{}
+	for i := 0; i < 3; i++ {
+		out, _ := toggle.Get("out")
+		outs = append(outs, out)
+		toggle.Tick()
+		times = append(times, toggle.Time())
+		// tickでは出力はまだ変わらない
+		if after, _ := toggle.Get("out"); after != out {
+			t.Errorf("cycle %d: out changed on tick", i)
+		}
+		toggle.Tock()
+		times = append(times, toggle.Time())
+	}
+	if strings.Join(times, " ") != "0 0+ 1 1+ 2 2+ 3" {
+		t.Errorf("times %v", times)
+	}
+	if outs[0] != 0 || outs[1] != 1 || outs[2] != 0 {
+		t.Errorf("outs %v, want 0 1 0", outs)
+	}
+
+	mem, err := l.Build("Mem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem.Set("address", 3)
+	mem.Set("in", -5)
+	mem.Set("load", 1)
+	mem.Tick()
+	mem.Tock()
+	mem.Set("load", 0)
+	mem.Set("address", 4)
+	mem.Eval()
+	if out, _ := mem.Get("out"); out != 0 {
+		t.Errorf("RAM8[4] = %d", out)
+	}
+	if v, err := mem.Get("RAM8[3]"); err != nil || v != -5 {
+		t.Errorf("RAM8[3] = %d, %v", v, err)
+	}
+	if err := mem.Set("RAM8[4]", 9); err != nil {
+		t.Fatal(err)
+	}
+	mem.Eval()
+	if out, _ := mem.Get("out"); out != 9 {
+		t.Errorf("out after setting RAM8[4] = %d", out)
+	}
+	if _, err := mem.Get("RAM8[8]"); err == nil {
+		t.Error("RAM8[8]: want an error")
+	}
+	if err := mem.Set("out", 1); err == nil || !strings.Contains(err.Error(), "out is not an input pin") {
+		t.Errorf("setting an output: %v", err)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	tests := []struct {
+		chip string
+		src  string
+		want string
+	}{
+		{"Loop", "CHIP Loop { OUT out; PARTS: Nand(a=x, b=x, out=y); Nand(a=y, b=y, out=x, out=out); }", "chip Loop has a combinational loop"},
+		{"Width", "CHIP Width { IN a[2]; OUT out; PARTS: Nand(a=a, b=a[0], out=out); }", "Width line 1: Nand: width mismatch: a is 1 bits, a is 2 bits"},
+		{"Pin", "CHIP Pin { IN a; OUT out;\nPARTS: Nand(a=a, c=a, out=out); }", "Pin line 2: Nand: unknown pin c"},
+		{"Drivers", "CHIP Drivers { IN a; OUT out; PARTS: Nand(a=a, b=a, out=out); Nand(a=a, b=a, out=out); }", "output pin out has multiple drivers"},
+		{"Input", "CHIP Input { IN a; OUT out; PARTS: Nand(a=a, b=a, out=a); }", "cannot drive input pin a"},
+		{"Undefined", "CHIP Undefined { OUT out; PARTS: Nand(a=x, b=x, out=out); }", "undefined pin x"},
+		{"Self", "CHIP Self { IN a; OUT out; PARTS: Self(a=a, out=out); }", "chip Self includes itself: Self -> Self"},
+		{"Missing", "CHIP Missing { IN a; OUT out; PARTS: Nope(a=a, out=out); }", "chip not found: Nope"},
+		{"Named", "CHIP Other { IN a; OUT out; PARTS: Nand(a=a, b=a, out=out); }", "chip name Other does not match file name"},
+		{"Syntax", "CHIP Syntax { IN a\n OUT out; }", `line 2: expected ',' or ';' in pin list, got "OUT"`},
+	}
+	chips := make(map[string]string)
+	for _, tt := range tests {
+		chips[tt.chip] = tt.src
+	}
+	l := NewLoader(chipDir(t, chips))
+	for _, tt := range tests {
+		_, err := l.Build(tt.chip)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want %q", tt.chip, err, tt.want)
+		}
+	}
+	if _, err := l.Build("Nope"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown chip: %v", err)
+	}
+}
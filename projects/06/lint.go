@@ -0,0 +1,189 @@
+package assembler
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// Hackアセンブリのリンタ。
+// アセンブルには成功するが誤りの可能性が高い書き方を警告として報告する。
+//
+//   - 参照されないラベル
+//   - 1回しか参照されない変数 (綴り間違いで新しいRAMが割り当てられた可能性)
+//   - 変数や定義済みシンボル(データのアドレス)へのジャンプ
+//   - ラベル(ROMアドレス)やキーボードなど書き込めないアドレスへのM=
+//   - ジャンプと同じ命令でのA=, M= (Aはジャンプ先を指しているため)
+//   - 無条件ジャンプの後の到達しない命令
+//   - 最後が無限ループで終わらないプログラム
+
+// kbdAddress キーボードのメモリマップのアドレス (読み出し専用)。
+const kbdAddress = 24576
+
+// lintInst リント対象の1命令。
+type lintInst struct {
+	line      int    // 展開後の行番号
+	column    int    // A命令はシンボル, C命令はdestの位置
+	text      string // コメントを除いた命令
+	symbol    string // A命令の@Xxxのxxx (C命令では空)
+	word      uint16
+	comp      Mnemonic // 正規の表記にしたcomp
+	reachable bool     // 直前にラベルがあるか数値のジャンプ先で、ジャンプで到達しうる
+}
+
+func (inst lintInst) isA() bool { return inst.word&0x8000 == 0 }
+
+func (inst lintInst) jumps() bool { return !inst.isA() && inst.word&0x7 != 0 }
+
+// unconditional 必ずジャンプするC命令かを返す (0;JMPや0;JEQなど)。
+func (inst lintInst) unconditional() bool {
+	if !inst.jumps() {
+		return false
+	}
+	j := inst.word & 0x7
+	switch inst.comp {
+	case "0":
+		return j&0x2 != 0
+	case "1":
+		return j&0x1 != 0
+	case "-1":
+		return j&0x4 != 0
+	}
+	return j == 0x7
+}
+
+// Lint rのアセンブリを検査し、見つかった問題を警告として返す。
+// アセンブルに失敗した場合はそのエラーを返す。
+func Lint(name string, r io.Reader, opts Options) (Diagnostics, error) {
+	opts.Relocatable = false
+	res, err := AssembleWith(name, r, opts)
+	if err != nil {
+		return nil, err
+	}
+	kinds := make(map[string]SymbolKind)
+	for _, sym := range res.Symbols {
+		kinds[sym.Name] = sym.Kind
+	}
+
+	expanded := make([]string, len(res.source))
+	for i, l := range res.source {
+		expanded[i] = l.text
+	}
+	type label struct {
+		name         string
+		line, column int
+	}
+	var (
+		labels   []label
+		insts    []lintInst
+		refs     = make(map[string][]int) // シンボル → 参照するA命令の位置
+		labeled  = true                   // プログラムの先頭は到達しうる
+		parser   = NewParser(bytes.NewReader([]byte(strings.Join(expanded, "\n"))))
+		textOf   = func(line int) string { return strings.TrimSpace(strings.SplitN(expanded[line-1], "//", 2)[0]) }
+		refer    = func(name string) { refs[name] = append(refs[name], len(insts)) }
+		warnings Diagnostics
+	)
+	for parser.hasMoreCommands() {
+		parser.advance()
+		switch parser.commandType() {
+		case L_COMMAND:
+			labels = append(labels, label{parser.symbol(), parser.line(), parser.symbolColumn()})
+			labeled = true
+			continue
+		case A_COMMAND:
+			symbol := parser.symbol()
+			if isExpression(symbol) {
+				toks, _ := tokenizeExpr(symbol)
+				for _, t := range toks {
+					if isSymbolChar(t.text[0]) && !isDigit(t.text[0]) {
+						refer(t.text)
+					}
+				}
+			} else if !isDigit(symbol[0]) {
+				refer(symbol)
+			}
+			insts = append(insts, lintInst{
+				line: parser.line(), column: parser.symbolColumn(), text: textOf(parser.line()),
+				symbol: symbol, word: res.Words[len(insts)], reachable: labeled,
+			})
+		case C_COMMAND:
+			insts = append(insts, lintInst{
+				line: parser.line(), column: parser.destColumn(), text: textOf(parser.line()),
+				word: res.Words[len(insts)], comp: canonical(compAliases, parser.comp()), reachable: labeled,
+			})
+		}
+		labeled = false
+	}
+	warn := func(line, column int, mnemonic, msg string) {
+		warnings = append(warnings, Diagnostic{Line: line, Column: column, Mnemonic: mnemonic, Message: msg, Warning: true})
+	}
+
+	for _, l := range labels {
+		if len(refs[l.name]) == 0 && !res.locals[l.name] {
+			warn(l.line, l.column, l.name, "unused label")
+		}
+	}
+	for _, sym := range res.Symbols {
+		if sym.Kind == Variable && len(refs[sym.Name]) == 1 {
+			inst := insts[refs[sym.Name][0]]
+			warn(inst.line, inst.column, sym.Name, "variable referenced only once (misspelled symbol?)")
+		}
+	}
+
+	// ラベルを使わずに数値で指定したジャンプ先 (@133, 0;JMP) も到達しうる。
+	for i := 1; i < len(insts); i++ {
+		if a := insts[i-1]; a.isA() && insts[i].jumps() && isDigit(a.symbol[0]) && int(a.word) < len(insts) {
+			insts[a.word].reachable = true
+		}
+	}
+
+	loaded := -1 // Aレジスタの値を決めたA命令の位置 (不明な場合は-1)
+	skipping := false
+	for i, inst := range insts {
+		if inst.reachable {
+			loaded, skipping = -1, false
+		} else if skipping {
+			continue
+		}
+		if i > 0 && insts[i-1].unconditional() && !inst.reachable {
+			warn(inst.line, inst.column, inst.text, "unreachable instruction")
+			skipping = true
+			continue
+		}
+		if inst.isA() {
+			loaded = i
+			continue
+		}
+		dest := inst.word >> 3 & 0x7
+		hazard := inst.jumps() && dest&0x5 != 0
+		if hazard {
+			warn(inst.line, inst.column, inst.text, "A or M assigned in a jump instruction (A holds the jump target)")
+		}
+		writes := dest&0x1 != 0 && !hazard // ジャンプと同時の書き込みは上で報告済み
+		if loaded >= 0 {
+			a := insts[loaded]
+			_, predefined := predefinedSymbols[a.symbol]
+			kind, defined := kinds[a.symbol]
+			switch {
+			case inst.jumps() && (predefined || defined && kind == Variable):
+				warn(a.line, a.column, a.symbol, "jump to a data address")
+			case writes && defined && kind == Label:
+				warn(inst.line, inst.column, inst.text, "write to RAM at a label (ROM) address")
+			case writes && a.word == kbdAddress:
+				warn(inst.line, inst.column, inst.text, "write to the read-only keyboard register")
+			case writes && a.word > kbdAddress:
+				warn(inst.line, inst.column, inst.text, "write beyond the memory map")
+			}
+		}
+		if dest&0x4 != 0 {
+			loaded = -1
+		}
+	}
+	if n := len(insts); n > 0 && !insts[n-1].unconditional() {
+		last := insts[n-1]
+		warn(last.line, last.column, last.text, "program does not end with an infinite loop")
+	}
+
+	warnings.locate(res.source)
+	return warnings, nil
+}
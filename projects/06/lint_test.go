@@ -0,0 +1,57 @@
+package assembler
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// lintEnd 警告の出ないプログラムの終わり方。
+const lintEnd = "(END)\n@END\n0;JMP\n"
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string // "行:列 メッセージ ニーモニック"
+	}{
+		{"unused label", "(UNUSED)\nD=0\n" + lintEnd, []string{`1:2 unused label "UNUSED"`}},
+		{"used label", "(L)\n@L\nD;JGT\n" + lintEnd, nil},
+		{"single-use variable", "@count\nM=0\n" + lintEnd, []string{`1:2 variable referenced only once (misspelled symbol?) "count"`}},
+		{"variable used twice", "@count\nM=0\n@count\nM=M+1\n" + lintEnd, nil},
+		{"jump to a data address", "@R5\nD;JGT\n" + lintEnd, []string{`1:2 jump to a data address "R5"`}},
+		{"jump to a label", "@SKIP\nD;JGT\n(SKIP)\n" + lintEnd, nil},
+		{"write to a label", "@END\nM=0\n" + lintEnd, []string{`2:1 write to RAM at a label (ROM) address "M=0"`}},
+		{"write to the keyboard", "@KBD\nM=0\n" + lintEnd, []string{`2:1 write to the read-only keyboard register "M=0"`}},
+		{"write to the screen", "@SCREEN\nM=-1\n@KBD\nD=M\n" + lintEnd, nil},
+		{"assignment in a jump", "@END\nAM=D;JGT\n" + lintEnd, []string{`2:1 A or M assigned in a jump instruction (A holds the jump target) "AM=D;JGT"`}},
+		{"D assigned in a jump", "@END\nD=D-1;JGT\n" + lintEnd, nil},
+		{"unreachable code", "@END\n0;JMP\nD=0 // 消し忘れ\n" + lintEnd, []string{`3:1 unreachable instruction "D=0"`}},
+		{"code after a conditional jump", "@END\nD;JGT\nD=0\n" + lintEnd, nil},
+		{"numeric jump target", "@2\n0;JMP\nD=0\n" + lintEnd, nil},
+		{"no infinite loop", "@END\nD;JGT\n(END)\nD=0\n", []string{`4:1 program does not end with an infinite loop "D=0"`}},
+		{"infinite loop", lintEnd, nil},
+	}
+	for _, tt := range tests {
+		diags, err := Lint("", strings.NewReader(tt.src), Options{})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var got []string
+		for _, d := range diags {
+			if !d.Warning {
+				t.Errorf("%s: %v is not a warning", tt.name, d)
+			}
+			got = append(got, fmt.Sprintf("%d:%d %s %q", d.Line, d.Column, d.Message, d.Mnemonic))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n got  %q\n want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := Lint("", strings.NewReader("D=M+2\n"), Options{}); err == nil {
+		t.Error("lint of an invalid program: want the assembly error")
+	}
+}
@@ -0,0 +1,335 @@
+package assembler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 再配置可能なオブジェクトファイル (.hobj) とリンカ。
+//
+// オブジェクトはROMアドレス0から置いたものとしてアセンブルした機械語と、
+// 公開するラベル, 再配置情報から成る。リンカはオブジェクトを順に並べ、
+// ラベルの参照にオブジェクトの先頭アドレスを足し、外部参照を他のオブジェクトの
+// ラベルか変数(RAM[16]から順に割り当て)に解決する。
+// 他のオブジェクトからは公開したラベルだけが見え、公開しないラベルは
+// オブジェクトごとのローカルなラベルになる (LOOPなどの名前を複数のオブジェクトで使える)。
+// 外部参照がすべて公開したラベルか変数であれば、1つの.asmとしてまとめてアセンブルした場合と同じ機械語になる。
+
+// ObjectExt オブジェクトファイルの拡張子。
+const ObjectExt = ".hobj"
+
+const objectMagic = "hackobj 1"
+
+// Reloc 1語分の再配置情報。
+type Reloc struct {
+	Index  int    // 再配置する語の位置
+	Symbol string // 外部参照のシンボル名 (空の場合は同じオブジェクト内のラベルの参照)
+	Jump   bool   // 直後の命令がジャンプ (ラベルであるべきシンボル)
+}
+
+// Object 再配置可能なオブジェクト。
+type Object struct {
+	Name    string
+	Code    []uint16 // ラベルの参照はオブジェクト先頭からのアドレス、外部参照は加える定数が入っている
+	Exports []Symbol // 公開するラベル (オブジェクト先頭からのアドレス)
+	Relocs  []Reloc
+
+	Warnings Diagnostics // Options.Strictで検出した警告 (ファイルには書き出さない)
+}
+
+// AssembleObject rのアセンブリを再配置可能なオブジェクトにする。
+// .globalで宣言したラベルと、VMの関数名と同じ"Xxx.yyy"の形のラベル (IsExportedName) を公開する。
+// それ以外のラベルとマクロ展開で生じたラベルはこのオブジェクトの中だけで使える。
+func AssembleObject(name string, r io.Reader, opts Options) (*Object, error) {
+	opts.Relocatable = true
+	res, err := AssembleWith(name, r, opts)
+	if err != nil {
+		return nil, err
+	}
+	obj := &Object{Name: name, Code: res.Words, Relocs: res.Relocs, Warnings: res.Warnings}
+	defined := make(map[string]bool)
+	for _, sym := range res.Symbols {
+		if sym.Kind != Label {
+			continue
+		}
+		defined[sym.Name] = true
+		if res.globals[sym.Name] || IsExportedName(sym.Name) && !res.locals[sym.Name] {
+			obj.Exports = append(obj.Exports, sym)
+		}
+	}
+	var undefined []string
+	for g := range res.globals {
+		if !defined[g] {
+			undefined = append(undefined, g)
+		}
+	}
+	if len(undefined) > 0 {
+		sort.Strings(undefined)
+		return nil, fmt.Errorf("%s: .global names undefined label(s): %s", name, strings.Join(undefined, ", "))
+	}
+	return obj, nil
+}
+
+// IsExportedName .globalで宣言しなくても公開するラベル名か。
+// VMトランスレータが関数に付ける"Xxx.yyy"の形 ("."を含み"$"を含まない) の名前を公開する。
+// "Xxx.yyy$LOOP"のような関数の中のラベルやマクロ展開で生じたラベルは公開しない。
+func IsExportedName(name string) bool {
+	return strings.Contains(name, ".") && !strings.Contains(name, "$")
+}
+
+// importBase 式の中の外部参照を仮に置く値。
+const importBase = 1 << 14
+
+// relocateExpr 再配置可能なオブジェクトの式を評価し、必要な再配置情報を記録する。
+// ラベルや外部参照の値をずらして評価し直し、値がちょうど同じだけずれる
+// "シンボル+定数"の形であれば再配置できる。外部参照の場合は定数部分を返す。
+func relocateExpr(res *Result, expr string, symbolT SymbolTable, labels map[string]int) (int, error) {
+	var imports []string
+	eval := func(labelShift, importValue int) (int, error) {
+		return evalExpr(expr, func(name string) (int, bool) {
+			if _, ok := labels[name]; ok {
+				return symbolT.getAddress(name) + labelShift, true
+			}
+			if symbolT.contains(name) {
+				return symbolT.getAddress(name), true
+			}
+			if len(imports) == 0 || imports[len(imports)-1] != name {
+				imports = append(imports, name)
+			}
+			return importValue, true
+		})
+	}
+	notRelocatable := &ExprError{0, "expression is not relocatable (use SYMBOL+constant)"}
+	v, err := eval(0, importBase)
+	if err != nil {
+		if len(imports) > 0 {
+			return 0, notRelocatable
+		}
+		return 0, err
+	}
+	shifted, err := eval(1, importBase)
+	if err != nil {
+		shifted = -1 // ずらすと範囲外になる (ラベルを含む)
+	}
+	switch {
+	case len(imports) == 0 && shifted == v:
+		return v, nil
+	case len(imports) == 0 && shifted == v+1:
+		res.Relocs = append(res.Relocs, Reloc{Index: len(res.Words)})
+		return v, nil
+	case len(imports) == 1 && shifted == v:
+		if moved, err := eval(0, importBase+1); err == nil && moved == v+1 {
+			res.Relocs = append(res.Relocs, Reloc{Index: len(res.Words), Symbol: imports[0]})
+			return v - importBase, nil
+		}
+	}
+	return 0, notRelocatable
+}
+
+// markJumps 外部参照のうち、直後がジャンプ命令のものに印を付ける。
+func markJumps(res *Result) {
+	for i := range res.Relocs {
+		r := &res.Relocs[i]
+		if r.Symbol == "" || r.Index+1 >= len(res.Words) {
+			continue
+		}
+		next := res.Words[r.Index+1]
+		r.Jump = next&0x8000 != 0 && next&0x7 != 0
+	}
+}
+
+// WriteObject オブジェクトをテキスト形式で書き出す。
+//
+//	hackobj 1
+//	name Foo.asm
+//	code 3
+//	0000000000000010
+//	...
+//	export LOOP 2
+//	reloc 0
+//	reloc 1 Bar.baz jump
+func WriteObject(w io.Writer, obj *Object) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, objectMagic)
+	fmt.Fprintf(bw, "name %s\n", obj.Name)
+	fmt.Fprintf(bw, "code %d\n", len(obj.Code))
+	for _, word := range obj.Code {
+		fmt.Fprintf(bw, "%016b\n", word)
+	}
+	for _, sym := range obj.Exports {
+		fmt.Fprintf(bw, "export %s %d\n", sym.Name, sym.Address)
+	}
+	for _, r := range obj.Relocs {
+		switch {
+		case r.Symbol == "":
+			fmt.Fprintf(bw, "reloc %d\n", r.Index)
+		case r.Jump:
+			fmt.Fprintf(bw, "reloc %d %s jump\n", r.Index, r.Symbol)
+		default:
+			fmt.Fprintf(bw, "reloc %d %s\n", r.Index, r.Symbol)
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadObject WriteObjectで書き出したオブジェクトを読み込む。
+func ReadObject(r io.Reader) (*Object, error) {
+	scanner := bufio.NewScanner(r)
+	n := 0
+	next := func() ([]string, bool) {
+		for scanner.Scan() {
+			n++
+			if f := strings.Fields(scanner.Text()); len(f) > 0 {
+				return f, true
+			}
+		}
+		return nil, false
+	}
+	bad := func(msg string) error { return fmt.Errorf("object line %d: %s", n, msg) }
+
+	f, ok := next()
+	if !ok || strings.Join(f, " ") != objectMagic {
+		return nil, bad("not a Hack object file")
+	}
+	obj := &Object{}
+	for {
+		f, ok := next()
+		if !ok {
+			break
+		}
+		switch {
+		case f[0] == "name" && len(f) == 2:
+			obj.Name = f[1]
+		case f[0] == "code" && len(f) == 2:
+			count, err := strconv.Atoi(f[1])
+			if err != nil || count < 0 {
+				return nil, bad("invalid code size")
+			}
+			for i := 0; i < count; i++ {
+				f, ok := next()
+				if !ok || len(f) != 1 {
+					return nil, bad("truncated code")
+				}
+				v, err := strconv.ParseUint(f[0], 2, 16)
+				if err != nil || len(f[0]) != 16 {
+					return nil, bad("invalid instruction")
+				}
+				obj.Code = append(obj.Code, uint16(v))
+			}
+		case f[0] == "export" && len(f) == 3:
+			addr, err := strconv.Atoi(f[2])
+			if err != nil || addr < 0 || addr > len(obj.Code) {
+				return nil, bad("invalid export address")
+			}
+			obj.Exports = append(obj.Exports, Symbol{Name: f[1], Address: addr, Kind: Label})
+		case f[0] == "reloc" && len(f) >= 2 && len(f) <= 4:
+			idx, err := strconv.Atoi(f[1])
+			if err != nil || idx < 0 || idx >= len(obj.Code) {
+				return nil, bad("invalid relocation index")
+			}
+			r := Reloc{Index: idx}
+			if len(f) >= 3 {
+				r.Symbol = f[2]
+			}
+			if len(f) == 4 {
+				if f[3] != "jump" {
+					return nil, bad("invalid relocation flag")
+				}
+				r.Jump = true
+			}
+			obj.Relocs = append(obj.Relocs, r)
+		default:
+			return nil, bad(fmt.Sprintf("unknown record %q", f[0]))
+		}
+	}
+	return obj, scanner.Err()
+}
+
+// LinkError リンク時に検出した1件のエラー。
+type LinkError struct {
+	Object  string // エラーのあるオブジェクト
+	Symbol  string
+	Message string
+}
+
+func (e LinkError) Error() string {
+	if e.Symbol == "" {
+		return fmt.Sprintf("%s: %s", e.Object, e.Message)
+	}
+	return fmt.Sprintf("%s: %s %q", e.Object, e.Message, e.Symbol)
+}
+
+// LinkErrors 1回のリンクで検出したすべてのエラー。
+type LinkErrors []LinkError
+
+func (es LinkErrors) Error() string {
+	lines := make([]string, len(es))
+	for i, e := range es {
+		lines[i] = e.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Link objsを順にROMに並べて1つのプログラムにする。
+// ラベルの重複定義, ジャンプ先の未定義シンボル, ROMの溢れをLinkErrorsとして返す。
+func Link(objs []*Object) (*Result, error) {
+	var errs LinkErrors
+	res := &Result{}
+	bases := make([]int, len(objs))
+	labels := make(map[string]int)
+	definedIn := make(map[string]string)
+	size := 0
+	for i, obj := range objs {
+		bases[i] = size
+		size += len(obj.Code)
+		for _, sym := range obj.Exports {
+			if first, ok := definedIn[sym.Name]; ok {
+				errs = append(errs, LinkError{obj.Name, sym.Name, fmt.Sprintf("duplicate symbol (also defined in %s)", first)})
+				continue
+			}
+			definedIn[sym.Name] = obj.Name
+			labels[sym.Name] = bases[i] + sym.Address
+			res.Symbols = append(res.Symbols, Symbol{Name: sym.Name, Address: labels[sym.Name], Kind: Label})
+		}
+	}
+	if size > maxAConstant+1 {
+		errs = append(errs, LinkError{Object: objs[len(objs)-1].Name, Message: fmt.Sprintf("program too large for ROM (%d words)", size)})
+	}
+
+	variables := make(map[string]int)
+	ramAddrCounter := 16
+	for i, obj := range objs {
+		code := append([]uint16(nil), obj.Code...)
+		for _, r := range obj.Relocs {
+			word := int(code[r.Index])
+			switch addr, ok := labels[r.Symbol]; {
+			case r.Symbol == "":
+				word += bases[i]
+			case ok:
+				word = addr + int(int16(word))
+			case r.Jump:
+				errs = append(errs, LinkError{obj.Name, r.Symbol, "undefined symbol"})
+			default:
+				if _, ok := variables[r.Symbol]; !ok {
+					variables[r.Symbol] = ramAddrCounter
+					res.Symbols = append(res.Symbols, Symbol{Name: r.Symbol, Address: ramAddrCounter, Kind: Variable})
+					ramAddrCounter++
+				}
+				word = variables[r.Symbol] + int(int16(word))
+			}
+			if word < 0 || word > maxAConstant {
+				errs = append(errs, LinkError{obj.Name, r.Symbol, fmt.Sprintf("relocated address %d out of range", word)})
+			}
+			code[r.Index] = uint16(word)
+		}
+		res.Words = append(res.Words, code...)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return res, nil
+}
@@ -0,0 +1,160 @@
+package assembler
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func assembleObject(t *testing.T, name, src string) *Object {
+	t.Helper()
+	obj, err := AssembleObject(name, strings.NewReader(src), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+func exportNames(obj *Object) []string {
+	var names []string
+	for _, sym := range obj.Exports {
+		names = append(names, sym.Name)
+	}
+	return names
+}
+
+func TestIsExportedName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"Main.main", true},
+		{"Sys.init", true},
+		{"Main.main$LOOP", false},
+		{"LOOP$WAIT.1", false},
+		{"LOOP", false},
+		{"RET_ADDRESS_CALL0", false},
+	}
+	for _, tt := range tests {
+		if got := IsExportedName(tt.name); got != tt.want {
+			t.Errorf("IsExportedName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAssembleObjectExports(t *testing.T) {
+	src := `.global START
+.macro WAIT
+(LOOP)
+    @LOOP
+    0;JMP
+.endm
+(START)
+    @Lib.f
+    0;JMP
+(Main.main)
+(Main.main$LOOP)
+(LOOP)
+    WAIT
+    @LOOP
+    0;JMP
+`
+	obj := assembleObject(t, "Main.asm", src)
+	if got, want := exportNames(obj), []string{"START", "Main.main"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("exports %v, want %v", got, want)
+	}
+
+	if _, err := AssembleObject("Bad.asm", strings.NewReader(".global MISSING\n(LOOP)\n@LOOP\n0;JMP\n"), Options{}); err == nil || !strings.Contains(err.Error(), "MISSING") {
+		t.Errorf("undefined .global: got %v", err)
+	}
+	_, err := AssembleObject("Bad.asm", strings.NewReader(".global\n.global 1X\n"), Options{})
+	var diags Diagnostics
+	if !errors.As(err, &diags) || len(diags) != 2 {
+		t.Errorf("malformed .global: got %v", err)
+	}
+}
+
+// TestLinkLocalLabels 公開しないラベルは同じ名前でも各オブジェクトの中で解決することを確かめる。
+func TestLinkLocalLabels(t *testing.T) {
+	main := assembleObject(t, "Main.asm", "(LOOP)\n@Lib.f\n0;JMP\n@LOOP\n0;JMP\n")
+	lib := assembleObject(t, "Lib.asm", "(Lib.f)\n@x\nM=M+1\n(LOOP)\n@LOOP\n0;JMP\n")
+	res, err := Link([]*Object{main, lib})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Main: @4 0;JMP @0 0;JMP / Lib (4から): @16 M=M+1 @6 0;JMP
+	want, err := Assemble(strings.NewReader("@4\n0;JMP\n@0\n0;JMP\n@16\nM=M+1\n@6\n0;JMP\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.Words, want) {
+		t.Errorf("got %v, want %v", res.Words, want)
+	}
+	wantSyms := []Symbol{{Name: "Lib.f", Address: 4, Kind: Label}, {Name: "x", Address: 16, Kind: Variable}}
+	if !reflect.DeepEqual(res.Symbols, wantSyms) {
+		t.Errorf("symbols %v, want %v", res.Symbols, wantSyms)
+	}
+}
+
+func TestLinkErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		srcs []string
+		want string
+	}{
+		{"duplicate export", []string{"(Lib.f)\n@Lib.f\n0;JMP\n", "(Lib.f)\n@Lib.f\n0;JMP\n"}, `duplicate symbol (also defined in 0.asm) "Lib.f"`},
+		{"duplicate .global", []string{".global A\n(A)\n@A\n0;JMP\n", ".global A\n(A)\n@A\n0;JMP\n"}, `duplicate symbol (also defined in 0.asm) "A"`},
+		{"jump to a local label", []string{"(LOOP)\n@LOOP\n0;JMP\n", "@LOOP\n0;JMP\n"}, `1.asm: undefined symbol "LOOP"`},
+	}
+	for _, tt := range tests {
+		objs := make([]*Object, len(tt.srcs))
+		for i, src := range tt.srcs {
+			objs[i] = assembleObject(t, string(rune('0'+i))+".asm", src)
+		}
+		_, err := Link(objs)
+		var errs LinkErrors
+		if !errors.As(err, &errs) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// TestLinkMatchesAssemble 8章の各ファイルを別々にオブジェクトにしてリンクした結果が、
+// 連結して1つの.asmとしてアセンブルした結果と同じことを確かめる (関数のラベルは公開される)。
+func TestLinkMatchesAssemble(t *testing.T) {
+	parts := []string{
+		"@256\nD=A\n@SP\nM=D\n@Sys.init\n0;JMP\n",
+		"(Sys.init)\n@Main.f\n0;JMP\n(Sys.init$END)\n@Sys.init$END\n0;JMP\n",
+		"(Main.f)\n@Main.0\nM=1\n@Main.f$L\n0;JMP\n(Main.f$L)\n@Main.f$L\n0;JMP\n",
+	}
+	want, err := Assemble(strings.NewReader(strings.Join(parts, "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var objs []*Object
+	for i, src := range parts {
+		obj := assembleObject(t, string(rune('0'+i))+".asm", src)
+		var buf bytes.Buffer
+		if err := WriteObject(&buf, obj); err != nil {
+			t.Fatal(err)
+		}
+		read, err := ReadObject(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		obj.Warnings = nil
+		if !reflect.DeepEqual(read, obj) {
+			t.Fatalf("object round trip: got %+v, want %+v", read, obj)
+		}
+		objs = append(objs, read)
+	}
+	res, err := Link(objs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.Words, want) {
+		t.Errorf("linked %v, assembled %v", res.Words, want)
+	}
+}
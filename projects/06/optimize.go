@@ -0,0 +1,450 @@
+package assembler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Hackアセンブリののぞき穴最適化。
+// マクロ展開後の命令列に次の書き換えを、変化がなくなるまで繰り返す。
+//
+//   - redundant-load: Aが既に同じ値の@Xxxを削除する (@SP, M=M+1, @SP, ...)
+//   - dead-load: 直後の@Yyyで上書きされる@Xxxを削除する
+//   - push-pop: M=M+1とM=M-1の組を打ち消す (AM=M-1の場合はA=Mにする)
+//   - jump-threading: 無条件ジャンプだけのラベルへのジャンプを、その飛び先へ付け替える
+//   - dead-label: 参照されないラベルを削除する
+//   - dead-code: 無条件ジャンプの後のラベルのない命令を削除する
+//
+// 命令を削除するとROMアドレスが変わるため、ジャンプ命令の直前の@123のような数値のジャンプ先は
+// その位置に置いた合成ラベル (ROM$123) に置き換えてから書き換える。本書のVMトランスレータが出力する
+// Pong.asmは共通のルーチンにこの形で飛ぶ。それ以外の数値はRAMアドレスか定数とみなすので、
+// ROMアドレスを数値のままデータとして扱うプログラムは正しく最適化できない。
+// LABEL+1のようにラベルを式で扱うプログラムと、@(1+5)や@R5のようなラベルでも数値でもないジャンプ先,
+// AやMを読むジャンプ命令の数値のジャンプ先は最適化しない。
+// 変数のRAMアドレスが変わらないよう、各変数を最初に参照するA命令は残す。
+
+// OptStat 1つの書き換え規則の結果。
+type OptStat struct {
+	Rule    string `json:"rule"`
+	Applied int    `json:"applied"` // 書き換えた箇所の数
+	Saved   int    `json:"saved"`   // 削除した命令の数
+}
+
+// OptReport 最適化の結果。
+type OptReport struct {
+	Before int       `json:"before"` // 最適化前の命令数
+	After  int       `json:"after"`  // 最適化後の命令数
+	Rules  []OptStat `json:"rules"`
+
+	// Warnings Options.Strictで検出した最適化前のソースの警告。最適化後のアセンブリは正規の表記になるので、ここで報告する。
+	Warnings Diagnostics `json:"-"`
+}
+
+// ErrNotOptimizable ROMアドレスをラベル以外で扱うため、安全に最適化できないプログラム。
+var ErrNotOptimizable = errors.New("program uses ROM addresses other than labels; cannot optimize safely")
+
+// optInst 最適化する命令列の1要素 (命令またはラベル)。
+type optInst struct {
+	label  string // ラベルの場合のラベル名
+	symbol string // A命令の@Xxxのxxx
+	dest   Mnemonic
+	comp   Mnemonic
+	jump   Mnemonic
+	isA    bool
+	pinned bool // 変数を最初に参照するA命令 (削除すると変数のアドレスが変わる)
+}
+
+func (in optInst) isLabel() bool { return in.label != "" }
+
+func (in optInst) isC() bool { return !in.isLabel() && !in.isA }
+
+func (in optInst) jumps() bool { return in.isC() && in.jump != "" && in.jump != "null" }
+
+// unconditional 必ずジャンプし、dest以外の副作用のないC命令かを返す。
+func (in optInst) unconditional() bool {
+	if !in.jumps() {
+		return false
+	}
+	j := jumpTable[in.jump]
+	switch in.comp {
+	case "0":
+		return j[1] == '1'
+	case "1":
+		return j[2] == '1'
+	case "-1":
+		return j[0] == '1'
+	}
+	return in.jump == "JMP"
+}
+
+func (in optInst) String() string {
+	switch {
+	case in.isLabel():
+		return "(" + in.label + ")"
+	case in.isA:
+		return "@" + in.symbol
+	}
+	s := string(in.comp)
+	if in.dest != "" && in.dest != "null" {
+		s = string(in.dest) + "=" + s
+	}
+	if in.jump != "" && in.jump != "null" {
+		s += ";" + string(in.jump)
+	}
+	return s
+}
+
+// Optimize rのアセンブリを最適化し、最適化後のアセンブリを返す。
+// 定数は先頭に.equとして出力し、マクロと.includeは展開済みになる。
+// アセンブルに失敗した場合はそのエラーを、安全に最適化できない場合はErrNotOptimizableを返す。
+func Optimize(name string, r io.Reader, opts Options) ([]byte, *OptReport, error) {
+	opts.Relocatable = false
+	res, err := AssembleWith(name, r, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	kinds := make(map[string]SymbolKind)
+	for _, sym := range res.Symbols {
+		kinds[sym.Name] = sym.Kind
+	}
+
+	expanded := make([]string, len(res.source))
+	for i, l := range res.source {
+		expanded[i] = l.text
+	}
+	var prog []optInst
+	seen := make(map[string]bool)
+	parser := NewParser(bytes.NewReader([]byte(strings.Join(expanded, "\n"))))
+	for parser.hasMoreCommands() {
+		parser.advance()
+		switch parser.commandType() {
+		case L_COMMAND:
+			prog = append(prog, optInst{label: parser.symbol()})
+		case A_COMMAND:
+			symbol := parser.symbol()
+			in := optInst{symbol: symbol, isA: true}
+			names := []string{symbol}
+			if isExpression(symbol) {
+				toks, _ := tokenizeExpr(symbol)
+				names = names[:0]
+				for _, t := range toks {
+					if kind, ok := kinds[t.text]; ok && kind == Label {
+						return nil, nil, ErrNotOptimizable
+					}
+					names = append(names, t.text)
+				}
+			}
+			for _, name := range names {
+				// 式の中で初めて参照する変数もここで割り当てられる
+				if kind, ok := kinds[name]; ok && kind == Variable && !seen[name] {
+					in.pinned, seen[name] = true, true
+				}
+			}
+			prog = append(prog, in)
+		case C_COMMAND:
+			in := optInst{
+				dest: canonical(destAliases, parser.dest()),
+				comp: canonical(compAliases, parser.comp()),
+				jump: parser.jump(),
+			}
+			prog = append(prog, in)
+		}
+	}
+	prog, err = labelROMAddresses(prog, kinds)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := &OptReport{Before: countInstructions(prog), Warnings: res.Warnings}
+	rules := []struct {
+		name  string
+		apply func([]optInst) ([]optInst, int)
+	}{
+		{"redundant-load", removeRedundantLoads},
+		{"dead-load", removeDeadLoads},
+		{"push-pop", cancelPushPop},
+		{"jump-threading", threadJumps},
+		{"dead-label", removeDeadLabels},
+		{"dead-code", removeDeadCode},
+	}
+	report.Rules = make([]OptStat, len(rules))
+	for i, rule := range rules {
+		report.Rules[i].Rule = rule.name
+	}
+	for changed := true; changed; {
+		changed = false
+		for i, rule := range rules {
+			before := countInstructions(prog)
+			var applied int
+			prog, applied = rule.apply(prog)
+			if applied > 0 {
+				changed = true
+				report.Rules[i].Applied += applied
+				report.Rules[i].Saved += before - countInstructions(prog)
+			}
+		}
+	}
+	report.After = countInstructions(prog)
+
+	var out bytes.Buffer
+	for _, sym := range res.Symbols {
+		if sym.Kind == Constant {
+			fmt.Fprintf(&out, ".equ %s %d\n", sym.Name, sym.Address)
+		}
+	}
+	for _, in := range prog {
+		if !in.isLabel() {
+			out.WriteString("    ")
+		}
+		out.WriteString(in.String() + "\n")
+	}
+	return out.Bytes(), report, nil
+}
+
+// labelROMAddresses ジャンプ命令の直前の数値のジャンプ先を、その位置に置いた合成ラベルに置き換える。
+// ラベルでも数値でもないジャンプ先 (式, 定数, 定義済みシンボル, 変数) はROMアドレスを書き換えられないのでエラーにする。
+func labelROMAddresses(prog []optInst, kinds map[string]SymbolKind) ([]optInst, error) {
+	targets := make(map[int]string) // ROMアドレス → 合成ラベル
+	size := countInstructions(prog)
+	for i, in := range prog {
+		if !in.isA || i+1 >= len(prog) || !prog[i+1].jumps() {
+			continue
+		}
+		if kind, ok := kinds[in.symbol]; ok && kind == Label {
+			continue
+		}
+		addr, err := strconv.Atoi(in.symbol)
+		if err != nil || addr >= size || readsA(prog[i+1].comp) {
+			return nil, ErrNotOptimizable
+		}
+		if _, ok := targets[addr]; !ok {
+			name := fmt.Sprintf("ROM$%d", addr)
+			for _, ok := kinds[name]; ok; _, ok = kinds[name] {
+				name += "_"
+			}
+			targets[addr] = name
+		}
+		prog[i].symbol = targets[addr]
+	}
+	if len(targets) == 0 {
+		return prog, nil
+	}
+	out := make([]optInst, 0, len(prog)+len(targets))
+	addr := 0
+	for _, in := range prog {
+		if !in.isLabel() {
+			if name, ok := targets[addr]; ok {
+				out = append(out, optInst{label: name})
+			}
+			addr++
+		}
+		out = append(out, in)
+	}
+	return out, nil
+}
+
+// readsA compの計算にAまたはM (Aの指すRAM) を使うかを返す。
+func readsA(comp Mnemonic) bool {
+	return strings.ContainsAny(string(comp), "AM")
+}
+
+func countInstructions(prog []optInst) int {
+	n := 0
+	for _, in := range prog {
+		if !in.isLabel() {
+			n++
+		}
+	}
+	return n
+}
+
+// removeRedundantLoads Aが既にXxxを指している@Xxxを削除する。
+// ラベルには他の場所からジャンプしてくるので、Aの値はラベルで分からなくなる。
+func removeRedundantLoads(prog []optInst) ([]optInst, int) {
+	out := prog[:0:0]
+	known := ""
+	removed := 0
+	for _, in := range prog {
+		switch {
+		case in.isLabel():
+			known = ""
+		case in.isA:
+			if in.symbol == known && !in.pinned {
+				removed++
+				continue
+			}
+			known = in.symbol
+		case strings.Contains(string(in.dest), "A"):
+			known = ""
+		}
+		out = append(out, in)
+	}
+	return out, removed
+}
+
+// removeDeadLoads 直後のA命令で上書きされるA命令を削除する。
+func removeDeadLoads(prog []optInst) ([]optInst, int) {
+	out := prog[:0:0]
+	removed := 0
+	for i, in := range prog {
+		if in.isA && !in.pinned && i+1 < len(prog) && prog[i+1].isA {
+			removed++
+			continue
+		}
+		out = append(out, in)
+	}
+	return out, removed
+}
+
+// cancelPushPop 同じアドレスに続けて行うM=M+1とM=M-1を打ち消す。
+// 後がAM=M∓1の場合はMを元に戻してAに読むので、A=Mと同じになる。
+func cancelPushPop(prog []optInst) ([]optInst, int) {
+	opposite := map[Mnemonic]Mnemonic{"M+1": "M-1", "M-1": "M+1"}
+	out := prog[:0:0]
+	applied := 0
+	for i := 0; i < len(prog); i++ {
+		in := prog[i]
+		if i+1 < len(prog) && in.isC() && !in.jumps() && in.dest == "M" && opposite[in.comp] != "" {
+			next := prog[i+1]
+			if next.isC() && !next.jumps() && next.comp == opposite[in.comp] {
+				switch next.dest {
+				case "M":
+					applied++
+					i++
+					continue
+				case "AM":
+					applied++
+					i++
+					out = append(out, optInst{dest: "A", comp: "M"})
+					continue
+				}
+			}
+		}
+		out = append(out, in)
+	}
+	return out, applied
+}
+
+// threadJumps "@L1, ジャンプ"のL1が"@L2, 無条件ジャンプ"だけの場合にL2へ直接ジャンプさせる。
+// ジャンプ命令がAの指すMに書き込む場合と、計算にAやMを使う場合 (@L1 / M;JNE など) は
+// Aの値が変わると結果が変わるので付け替えない。条件付きジャンプでは、
+// ジャンプしない場合にAの値を使わない(次がA命令の)ときに限る。
+func threadJumps(prog []optInst) ([]optInst, int) {
+	// ラベル → そこにある無条件ジャンプの飛び先
+	forward := make(map[string]string)
+	for i, in := range prog {
+		if !in.isLabel() {
+			continue
+		}
+		j := i
+		for j < len(prog) && prog[j].isLabel() {
+			j++
+		}
+		if j+1 < len(prog) && prog[j].isA && prog[j+1].unconditional() && prog[j+1].dest == "" && !isDigit(prog[j].symbol[0]) {
+			forward[in.label] = prog[j].symbol
+		}
+	}
+	final := func(label string) string {
+		visited := map[string]bool{label: true}
+		for {
+			next, ok := forward[label]
+			if !ok || visited[next] {
+				return label
+			}
+			visited[next] = true
+			label = next
+		}
+	}
+
+	applied := 0
+	for i := 0; i+1 < len(prog); i++ {
+		in := prog[i]
+		if !in.isA || !prog[i+1].jumps() || (prog[i+1].dest != "" && prog[i+1].dest != "null") || readsA(prog[i+1].comp) {
+			continue
+		}
+		target := final(in.symbol)
+		if target == in.symbol {
+			continue
+		}
+		if !prog[i+1].unconditional() && !(i+2 < len(prog) && prog[i+2].isA) {
+			continue
+		}
+		prog[i].symbol = target
+		applied++
+	}
+	return prog, applied
+}
+
+// removeDeadLabels どのA命令からも参照されないラベルを削除する。
+func removeDeadLabels(prog []optInst) ([]optInst, int) {
+	used := make(map[string]bool)
+	for _, in := range prog {
+		if in.isA {
+			used[in.symbol] = true
+		}
+	}
+	out := prog[:0:0]
+	removed := 0
+	for _, in := range prog {
+		if in.isLabel() && !used[in.label] {
+			removed++
+			continue
+		}
+		out = append(out, in)
+	}
+	return out, removed
+}
+
+// removeDeadCode 無条件ジャンプの後、次のラベルまでの命令を削除する。
+func removeDeadCode(prog []optInst) ([]optInst, int) {
+	out := prog[:0:0]
+	removed := 0
+	dead := false
+	for _, in := range prog {
+		if in.isLabel() {
+			dead = false
+		} else if dead && !in.pinned {
+			removed++
+			continue
+		}
+		out = append(out, in)
+		if in.unconditional() {
+			dead = true
+		}
+	}
+	return out, removed
+}
+
+// WriteOptReport 最適化の結果を表にして書き出す。
+//
+//	RULE            APPLIED  SAVED
+//	redundant-load       12     12
+//	...
+//	total: 300 -> 250 instructions (saved 50, 16.7%)
+func WriteOptReport(w io.Writer, report *OptReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RULE\tAPPLIED\tSAVED")
+	for _, s := range report.Rules {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", s.Rule, s.Applied, s.Saved)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	saved := report.Before - report.After
+	percent := 0.0
+	if report.Before > 0 {
+		percent = float64(saved) * 100 / float64(report.Before)
+	}
+	_, err := fmt.Fprintf(w, "total: %d -> %d instructions (saved %d, %.1f%%)\n", report.Before, report.After, saved, percent)
+	return err
+}
+
+// WriteOptReportJSON 最適化の結果をJSONで書き出す。
+func WriteOptReportJSON(w io.Writer, report *OptReport) error {
+	return writeJSON(w, report)
+}
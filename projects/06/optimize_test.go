@@ -0,0 +1,208 @@
+package assembler
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/momotaro98/nand2tetris/assembler/cpu"
+	"github.com/momotaro98/nand2tetris/assembler/tst"
+)
+
+// newOptSimulator テストスクリプトの.asmを(最適化して)アセンブルし、CPUエミュレータで実行するシミュレータを返す。
+// 最適化で削除した命令の数をsavedに足す。
+func newOptSimulator(optimize bool, saved *int) *tst.CPUSimulator {
+	return tst.NewCPUSimulator(func(path string) ([]uint16, error) {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if optimize {
+			var report *OptReport
+			src, report, err = Optimize(path, bytes.NewReader(src), Options{})
+			if err != nil {
+				return nil, err
+			}
+			*saved += report.Before - report.After
+		}
+		return Assemble(bytes.NewReader(src))
+	})
+}
+
+// runVMScript 7章, 8章のテストスクリプトを一時ディレクトリにコピーして実行する (.outを元の場所に書かないため)。
+func runVMScript(t *testing.T, script string, sim tst.Simulator) error {
+	t.Helper()
+	dir, name := filepath.Dir(script), strings.TrimSuffix(filepath.Base(script), ".tst")
+	tmp := t.TempDir()
+	for _, ext := range []string{".tst", ".cmp", ".asm"} {
+		b, err := os.ReadFile(filepath.Join(dir, name+ext))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(tmp, name+ext), b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tst.Run(filepath.Join(tmp, name+".tst"), sim)
+}
+
+// TestOptimizeVMPrograms 7章と8章のVMトランスレータの出力を最適化せずに/最適化して実行し、
+// どちらも.cmpと一致し、スタックの外のRAM (ポインタ, 一時領域, 静的変数, ヒープ) が同じになることを確かめる。
+// スタックとR13-R15にはリターンアドレスが残り、最適化でアドレスが変わるので比べない。
+func TestOptimizeVMPrograms(t *testing.T) {
+	scripts, err := filepath.Glob("../0[78]/*/*/*.tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := 0
+	n := 0
+	for _, script := range scripts {
+		if strings.HasSuffix(script, "VME.tst") {
+			continue
+		}
+		n++
+		t.Run(filepath.Base(script), func(t *testing.T) {
+			plain, opt := newOptSimulator(false, nil), newOptSimulator(true, &saved)
+			if err := runVMScript(t, script, plain); err != nil {
+				t.Fatalf("without -O: %v", err)
+			}
+			if err := runVMScript(t, script, opt); err != nil {
+				t.Fatalf("with -O: %v", err)
+			}
+			before, after := plain.CPU(), opt.CPU()
+			for addr := range before.RAM {
+				if addr >= 13 && addr < 16 || addr >= 256 && addr < 2048 {
+					continue
+				}
+				if before.RAM[addr] != after.RAM[addr] {
+					t.Errorf("RAM[%d] = %d with -O, %d without", addr, int16(after.RAM[addr]), int16(before.RAM[addr]))
+				}
+			}
+		})
+	}
+	if n != 11 {
+		t.Errorf("ran %d scripts, want 11", n)
+	}
+	if saved == 0 {
+		t.Error("the optimizer saved no instructions on the VM programs")
+	}
+}
+
+// ramWrites ROMのプログラムをcyclesサイクル実行し、addrに当てはまるRAMへの書き込みを順に返す。
+func ramWrites(t *testing.T, words []uint16, cycles int, addr func(uint16) bool) [][2]uint16 {
+	t.Helper()
+	c, err := cpu.New(words)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var writes [][2]uint16
+	for i := 0; i < cycles; i++ {
+		inst, a := c.ROM[c.PC], c.A
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+		if inst&0x8008 == 0x8008 && addr(a) {
+			writes = append(writes, [2]uint16{a, c.RAM[a]})
+		}
+	}
+	return writes
+}
+
+// TestOptimizePong 本書のVMトランスレータが出力したPong.asmは数値のジャンプ先を合成ラベルにして最適化する。
+// 静的変数, ヒープ, スクリーンへの書き込みの順序と値が最適化の前後で同じことを確かめる。
+func TestOptimizePong(t *testing.T) {
+	src, err := os.ReadFile("pong/Pong.asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt, report, err := Optimize("Pong.asm", bytes.NewReader(src), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.After >= report.Before {
+		t.Fatalf("saved nothing: %d -> %d", report.Before, report.After)
+	}
+	before, err := Assemble(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := Assemble(bytes.NewReader(opt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	outsideStack := func(a uint16) bool { return a >= 16 && a < 256 || a >= 2048 }
+	const cycles = 5000000
+	want := ramWrites(t, before, cycles, outsideStack)
+	got := ramWrites(t, after, cycles, outsideStack)
+	if len(got) < len(want) {
+		t.Fatalf("%d writes with -O, %d without", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("write %d: RAM[%d]=%d with -O, RAM[%d]=%d without", i, got[i][0], got[i][1], want[i][0], want[i][1])
+		}
+	}
+}
+
+func optimizeString(t *testing.T, src string) (string, error) {
+	t.Helper()
+	out, _, err := Optimize("", strings.NewReader(src), Options{})
+	return strings.Join(strings.Fields(string(out)), " "), err
+}
+
+func TestOptimizeRules(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"redundant-load", "@SP\nM=M+1\n@SP\nA=M\nM=D", "@SP M=M+1 A=M M=D"},
+		{"redundant-load after label", "@SP\nM=M+1\n(L)\n@SP\nM=M+1\n@L\n0;JMP", "@SP M=M+1 (L) @SP M=M+1 @L 0;JMP"},
+		{"dead-load", "@R13\n@R14\nM=D", "@R14 M=D"},
+		{"push-pop", "@SP\nM=M+1\nM=M-1\nD=M", "@SP D=M"},
+		{"push-pop AM", "@SP\nM=M+1\nAM=M-1\nD=M", "@SP A=M D=M"},
+		{"jump-threading", "@L1\n0;JMP\n(L1)\n@L2\n0;JMP\n(L2)\n@L2\n0;JMP", "@L2 0;JMP (L2) @L2 0;JMP"},
+		{"jump-threading conditional", "@L1\nD;JNE\n@R0\nM=D\n(L1)\n@L2\n0;JMP\n(L2)\n@L2\n0;JMP", "@L2 D;JNE @R0 M=D @L2 0;JMP (L2) @L2 0;JMP"},
+		// Mを読むジャンプは、付け替えるとRAM[L1]ではなくRAM[L2]を読むことになる
+		{"jump-threading reads M", "@L1\nM;JNE\n@R0\nM=D\n(L1)\n@L2\n0;JMP\n(L2)\n@L2\n0;JMP", "@L1 M;JNE @R0 M=D (L1) @L2 0;JMP (L2) @L2 0;JMP"},
+		{"jump-threading reads A", "@L1\nA-1;JGT\n@R0\nM=D\n(L1)\n@L2\n0;JMP\n(L2)\n@L2\n0;JMP", "@L1 A-1;JGT @R0 M=D (L1) @L2 0;JMP (L2) @L2 0;JMP"},
+		{"dead-code", "@END\n0;JMP\nD=M\n(END)\n@END\n0;JMP", "@END 0;JMP (END) @END 0;JMP"},
+		{"pinned variable", "@END\n0;JMP\n@x\nM=0\n(END)\n@x\nM=1\n@END\n0;JMP", "@END 0;JMP @x (END) @x M=1 @END 0;JMP"},
+		{"pinned variable in expression", "@END\n0;JMP\n@ARR+1\nM=0\n(END)\n@y\nM=1\n@ARR\nM=1\n@END\n0;JMP", "@END 0;JMP @ARR+1 (END) @y M=1 @ARR M=1 @END 0;JMP"},
+		// 数値のジャンプ先は合成ラベルにして、その後の命令が消えても同じ命令に飛ぶ
+		{"numeric jump target", "@3\n0;JMP\nD=M\n@3\n0;JMP", "@ROM$3 0;JMP (ROM$3) @ROM$3 0;JMP"},
+		{"numeric data", "@5\nD=A\n@R0\nM=D\n@5\nD=A", "@5 D=A @R0 M=D @5 D=A"},
+	}
+	for _, tt := range tests {
+		got, err := optimizeString(t, tt.src)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s:\n got  %s\n want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOptimizeNotOptimizable(t *testing.T) {
+	for _, src := range []string{
+		"(L)\n@L+2\n0;JMP\nD=M",
+		"@2\nM;JMP\nD=M",
+		"@2\nA;JNE\nD=M",
+		"@9\n0;JMP\nD=M",
+		"@1+1\n0;JMP\nD=M",
+		// ラベルを含まない式や定数のジャンプ先も、削除でROMアドレスがずれるので書き換えられない
+		"@(1+5)\n0;JMP\nD=M\n@3\n@4\n@5\n(END)\n@END\n0;JMP",
+		".equ TARGET 2\n@TARGET\n0;JMP\nD=M",
+		"@R2\nD;JGT\nD=M",
+		"@i\n0;JMP\nD=M",
+	} {
+		if _, err := optimizeString(t, src); !errors.Is(err, ErrNotOptimizable) {
+			t.Errorf("%q: got %v, want ErrNotOptimizable", src, err)
+		}
+	}
+}
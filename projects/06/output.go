@@ -0,0 +1,117 @@
+package assembler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteHack 機械語を.hack形式(1行に16桁の2進数)で書き出す。
+func WriteHack(w io.Writer, words []uint16) error {
+	bw := bufio.NewWriter(w)
+	for _, word := range words {
+		if _, err := fmt.Fprintf(bw, "%016b\n", word); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteSymbols シンボルテーブルを "名前 アドレス 種類" の形式で1行ずつ書き出す。
+// ラベルのアドレスはROM, 変数のアドレスはRAM(16から順に割り当て)を指す。
+func WriteSymbols(w io.Writer, symbols []Symbol) error {
+	bw := bufio.NewWriter(w)
+	for _, sym := range symbols {
+		if _, err := fmt.Fprintf(bw, "%s %d %s\n", sym.Name, sym.Address, sym.Kind); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteSymbolsJSON シンボルテーブルを {"name", "address", "kind"} の配列として書き出す。
+func WriteSymbolsJSON(w io.Writer, symbols []Symbol) error {
+	if symbols == nil {
+		symbols = []Symbol{}
+	}
+	return writeJSON(w, symbols)
+}
+
+// ListingEntry リスティングの1命令。
+type ListingEntry struct {
+	Address int    `json:"address"`
+	Binary  string `json:"binary"`
+	Hex     string `json:"hex"`
+	File    string `json:"file,omitempty"` // マクロ本体や.includeしたファイルの命令の場合のファイル
+	Line    int    `json:"line"`
+	Source  string `json:"source"`
+}
+
+// Listing 命令ごとにROMアドレス, 機械語, 元のソース行を対応付ける。
+// 位置はアセンブルで記録したPositionsを使うので、実際のアドレスとずれない。
+func (res *Result) Listing() []ListingEntry {
+	entries := make([]ListingEntry, len(res.wordLines))
+	for i, src := range res.wordLines {
+		w, pos := res.Words[i], res.Positions[i]
+		entries[i] = ListingEntry{
+			Address: i,
+			Binary:  fmt.Sprintf("%016b", w),
+			Hex:     fmt.Sprintf("%04X", w),
+			File:    res.fileOf(pos),
+			Line:    pos.Line,
+			Source:  strings.TrimRight(res.source[src].raw, " \t\r"),
+		}
+	}
+	return entries
+}
+
+// fileOf アセンブルしたファイル以外(.includeやマクロ本体)の位置の場合にそのファイル名を返す。
+func (res *Result) fileOf(pos Position) string {
+	if len(res.source) > 0 && pos.File == res.source[0].pos.File && len(pos.Trace) == 0 {
+		return ""
+	}
+	return pos.File
+}
+
+// WriteListing マクロ展開後のすべての行を、命令になった行にはROMアドレスと機械語を付けて書き出す。
+// マクロ展開や.includeで生じた行は行番号の後ろに"+"を付ける。
+//
+//	ROM  BINARY            HEX   LINE  SOURCE
+//	  0  0000000000000010  0002     7  @2
+func WriteListing(w io.Writer, res *Result) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%5s  %-16s  %-4s  %5s  %s\n", "ROM", "BINARY", "HEX", "LINE", "SOURCE")
+	entries := res.Listing()
+	next := 0
+	for i, l := range res.source {
+		line := strconv.Itoa(l.pos.Line)
+		if res.fileOf(l.pos) != "" {
+			line += "+"
+		} else {
+			line += " "
+		}
+		raw := strings.TrimRight(l.raw, " \t\r")
+		if next < len(entries) && res.wordLines[next] == i {
+			e := entries[next]
+			fmt.Fprintf(bw, "%5d  %s  %s  %5s  %s\n", e.Address, e.Binary, e.Hex, line, raw)
+			next++
+			continue
+		}
+		fmt.Fprintf(bw, "%5s  %16s  %4s  %5s  %s\n", "", "", "", line, raw)
+	}
+	return bw.Flush()
+}
+
+// WriteListingJSON 命令ごとのリスティングをJSONの配列として書き出す。
+func WriteListingJSON(w io.Writer, res *Result) error {
+	return writeJSON(w, res.Listing())
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,155 @@
+package assembler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// listingResult .includeとマクロ, 変数を使うプログラムをアセンブルし、その結果と一時ディレクトリを返す。
+func listingResult(t *testing.T) (*Result, string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "lib.asm"), []byte("// lib\n@7\nD=A\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src := `// test
+.include "lib.asm"
+.macro INC x
+    @x
+    M=M+1
+.endm
+(START)
+    @i   // counter
+    M=0
+    INC i
+    INC j
+    @(2+3)
+    @START
+    0;JMP
+`
+	main := filepath.Join(dir, "main.asm")
+	res, err := AssembleSource(main, strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, dir
+}
+
+func TestWriteListing(t *testing.T) {
+	res, dir := listingResult(t)
+	var b strings.Builder
+	if err := WriteListing(&b, res); err != nil {
+		t.Fatal(err)
+	}
+	// ")"で終わる@(2+3)もラベルではなく命令として扱う
+	want := `  ROM  BINARY            HEX    LINE  SOURCE
+                                  1   // test
+                                  2   .include "lib.asm"
+                                  1+  // lib
+    0  0000000000000111  0007     2+  @7
+    1  1110110000010000  EC10     3+  D=A
+                                  3   .macro INC x
+                                  4       @x
+                                  5       M=M+1
+                                  6   .endm
+                                  7   (START)
+    2  0000000000010000  0010     8       @i   // counter
+    3  1110101010001000  EA88     9       M=0
+                                 10       INC i
+    4  0000000000010000  0010     4+      @i
+    5  1111110111001000  FDC8     5+      M=M+1
+                                 11       INC j
+    6  0000000000010001  0011     4+      @j
+    7  1111110111001000  FDC8     5+      M=M+1
+    8  0000000000000101  0005    12       @(2+3)
+    9  0000000000000010  0002    13       @START
+   10  1110101010000111  EA87    14       0;JMP
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	if err := WriteListingJSON(&b, res); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.ReplaceAll(b.String(), filepath.ToSlash(dir), "DIR")
+	for _, entry := range []string{`{
+    "address": 0,
+    "binary": "0000000000000111",
+    "hex": "0007",
+    "file": "DIR/lib.asm",
+    "line": 2,
+    "source": "@7"
+  },`, `{
+    "address": 2,
+    "binary": "0000000000010000",
+    "hex": "0010",
+    "line": 8,
+    "source": "    @i   // counter"
+  },`, `{
+    "address": 6,
+    "binary": "0000000000010001",
+    "hex": "0011",
+    "file": "DIR/main.asm",
+    "line": 4,
+    "source": "    @j"
+  },`, `{
+    "address": 10,
+    "binary": "1110101010000111",
+    "hex": "EA87",
+    "line": 14,
+    "source": "    0;JMP"
+  }
+]`} {
+		if !strings.Contains(got, entry) {
+			t.Errorf("JSON listing lacks\n%s\ngot\n%s", entry, got)
+		}
+	}
+	if n := strings.Count(got, `"address"`); n != len(res.Words) {
+		t.Errorf("%d entries for %d words", n, len(res.Words))
+	}
+}
+
+func TestWriteSymbols(t *testing.T) {
+	res, _ := listingResult(t)
+	var b strings.Builder
+	if err := WriteSymbols(&b, res.Symbols); err != nil {
+		t.Fatal(err)
+	}
+	if want := "START 2 label\ni 16 variable\nj 17 variable\n"; b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	if err := WriteSymbolsJSON(&b, res.Symbols); err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+  {
+    "name": "START",
+    "address": 2,
+    "kind": "label"
+  },
+  {
+    "name": "i",
+    "address": 16,
+    "kind": "variable"
+  },
+  {
+    "name": "j",
+    "address": 17,
+    "kind": "variable"
+  }
+]
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+	b.Reset()
+	if err := WriteSymbolsJSON(&b, nil); err != nil || b.String() != "[]\n" {
+		t.Errorf("no symbols: %q, %v", b.String(), err)
+	}
+}
@@ -1,8 +1,8 @@
-package main
+package assembler
 
 import (
 	"bufio"
-	"os"
+	"io"
 	"strings"
 )
 
@@ -20,10 +20,16 @@ type Parser interface {
 	dest() Mnemonic
 	comp() Mnemonic
 	jump() Mnemonic
+	line() int
+	symbolColumn() int
+	labelBalanced() bool
+	destColumn() int
+	compColumn() int
+	jumpColumn() int
 }
 
-func NewParser(file *os.File) Parser {
-	scanner := bufio.NewScanner(file)
+func NewParser(r io.Reader) Parser {
+	scanner := bufio.NewScanner(r)
 	return &parser{
 		scanner:        scanner,
 		currentCommand: "",
@@ -35,6 +41,11 @@ type parser struct {
 	scanner        *bufio.Scanner
 	currentCommand string
 	nextCommand    string
+	lineNum        int // 読み込んだ行数
+	currentLine    int // 現コマンドの行番号
+	nextLine       int
+	currentColumn  int // 現コマンドの行内での開始位置
+	nextColumn     int
 }
 
 // hasMoreCommands implements Parser
@@ -44,14 +55,17 @@ func (p *parser) hasMoreCommands() bool {
 		if !p.scanner.Scan() {
 			return false
 		}
-		line := p.scanner.Text()
-		line = strings.SplitN(line, "//", 2)[0] // コメント文除去
-		line = strings.TrimSpace(line)          // 端空白削除
-		strings.ReplaceAll(line, " ", "")       // 中間空白除去
-		if len(line) < 1 {                      // 空行スキップ
+		p.lineNum++
+		raw := p.scanner.Text()
+		line := strings.SplitN(raw, "//", 2)[0] // コメント文除去
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		line = strings.TrimSpace(line) // 端空白削除 (C命令の中間空白はdest/comp/jumpで除去する)
+		if len(line) < 1 {             // 空行スキップ
 			continue
 		}
 		p.nextCommand = line
+		p.nextLine = p.lineNum
+		p.nextColumn = indent + 1
 		return true
 	}
 }
@@ -62,6 +76,8 @@ func (p *parser) hasMoreCommands() bool {
 // 最初は現コマンドは空である。
 func (p *parser) advance() {
 	p.currentCommand = p.nextCommand
+	p.currentLine = p.nextLine
+	p.currentColumn = p.nextColumn
 }
 
 // commandType implements Parser
@@ -71,7 +87,8 @@ func (p *parser) commandType() Command {
 	if strings.HasPrefix(cmd, "@") {
 		return A_COMMAND
 	}
-	if strings.HasPrefix(cmd, "(") && strings.HasSuffix(cmd, ")") {
+	// 括弧の閉じ忘れ等も疑似コマンドとして扱い、labelBalanced()で検出する。
+	if strings.HasPrefix(cmd, "(") || strings.HasSuffix(cmd, ")") {
 		return L_COMMAND
 	}
 	return C_COMMAND
@@ -96,7 +113,7 @@ func (p *parser) symbol() string {
 func (p *parser) dest() Mnemonic {
 	s := strings.Split(p.currentCommand, "=")
 	if len(s) > 1 {
-		return Mnemonic(s[0])
+		return Mnemonic(removeSpaces(s[0]))
 	}
 	return ""
 }
@@ -111,7 +128,7 @@ func (p *parser) comp() Mnemonic {
 	if strings.Contains(p.currentCommand, ";") {
 		s = strings.Split(s, ";")[0]
 	}
-	return Mnemonic(s)
+	return Mnemonic(removeSpaces(s))
 }
 
 // jump implements Parser
@@ -119,7 +136,68 @@ func (p *parser) comp() Mnemonic {
 func (p *parser) jump() Mnemonic {
 	s := strings.Split(p.currentCommand, ";")
 	if len(s) > 1 {
-		return Mnemonic(s[1])
+		return Mnemonic(removeSpaces(s[1]))
 	}
 	return ""
 }
+
+// removeSpaces "D + M"のようにニーモニック中の空白を除去する。
+func removeSpaces(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
+
+// skipSpaces 現コマンドのi文字目から空白を読み飛ばした位置を返す。
+func (p *parser) skipSpaces(i int) int {
+	for i < len(p.currentCommand) && (p.currentCommand[i] == ' ' || p.currentCommand[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// line implements Parser
+// 現コマンドの行番号(1始まり)を返す。
+func (p *parser) line() int {
+	return p.currentLine
+}
+
+// symbolColumn implements Parser
+// 現コマンド@Xxxまたは(Xxx)のXxxの行内での位置(1始まり)を返す。
+func (p *parser) symbolColumn() int {
+	if strings.HasPrefix(p.currentCommand, "@") || strings.HasPrefix(p.currentCommand, "(") {
+		return p.currentColumn + 1
+	}
+	return p.currentColumn
+}
+
+// labelBalanced implements Parser
+// 現疑似コマンドの括弧が正しく対応しているかを返す。
+// このルーチンはcommandType()がL_COMMANDのときだけ呼ぶようにする。
+func (p *parser) labelBalanced() bool {
+	cmd := p.currentCommand
+	return strings.HasPrefix(cmd, "(") && strings.HasSuffix(cmd, ")") &&
+		strings.Count(cmd, "(") == 1 && strings.Count(cmd, ")") == 1
+}
+
+// destColumn implements Parser
+// 現C命令のdestニーモニックの行内での位置(1始まり)を返す。
+func (p *parser) destColumn() int {
+	return p.currentColumn
+}
+
+// compColumn implements Parser
+// 現C命令のcompニーモニックの行内での位置(1始まり)を返す。
+func (p *parser) compColumn() int {
+	if i := strings.Index(p.currentCommand, "="); i >= 0 {
+		return p.currentColumn + p.skipSpaces(i+1)
+	}
+	return p.currentColumn
+}
+
+// jumpColumn implements Parser
+// 現C命令のjumpニーモニックの行内での位置(1始まり)を返す。
+func (p *parser) jumpColumn() int {
+	if i := strings.Index(p.currentCommand, ";"); i >= 0 {
+		return p.currentColumn + p.skipSpaces(i+1)
+	}
+	return p.currentColumn + len(p.currentCommand)
+}
@@ -0,0 +1,475 @@
+package assembler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 2つのパスの前に、ディレクティブとマクロを展開する。
+//
+//	.equ NAME expr            名前付き定数 (@NAMEで参照できる。式は定数と数値から成る)
+//	.include "file.asm"       ファイルの取り込み (取り込み元のファイルからの相対パス)
+//	.macro NAME p1, p2 ... .endm
+//	                          引数付きマクロ。本体中の引数名は呼び出し時の値に置き換わる。
+//	                          レジスタ名 (A, D, M, AMなど) は引数名に使えない。
+//	                          本体で定義したラベルは展開ごとに別名になる (NAME$MACRO.n)。
+//	NAME a1, a2               マクロの呼び出し
+//	.if 式 / .ifdef NAME / .ifndef NAME ... .else ... .endif
+//	                          条件付きアセンブル。式は"値"または"値 比較演算子 値"。
+//	.global NAME1, NAME2      オブジェクトとしてアセンブルするとき公開するラベル (AssembleObjectを参照)
+
+// maxExpansionDepth マクロ展開と.includeの入れ子の上限。再帰の検出に使う。
+const maxExpansionDepth = 64
+
+// Frame マクロ展開または.includeの呼び出し元。
+type Frame struct {
+	Macro string // マクロ名 (.includeの場合は空)
+	File  string // 呼び出し元のファイル
+	Line  int    // 呼び出し元の行番号
+}
+
+func (f Frame) String() string {
+	if f.Macro == "" {
+		return fmt.Sprintf("included from %s", position(f.File, f.Line))
+	}
+	return fmt.Sprintf("in expansion of macro %s at %s", f.Macro, position(f.File, f.Line))
+}
+
+func position(file string, line int) string {
+	if file == "" {
+		return fmt.Sprintf("line %d", line)
+	}
+	return fmt.Sprintf("%s:%d", file, line)
+}
+
+// Position 命令の元になったソースの位置。
+// マクロで展開された命令はマクロ本体の行を指し、Traceに呼び出し元を持つ。
+type Position struct {
+	File  string  `json:"file,omitempty"`
+	Line  int     `json:"line"`
+	Trace []Frame `json:"-"`
+}
+
+// srcLine 展開後の1行。
+type srcLine struct {
+	text string // パーサーに渡す内容 (ディレクティブの行は空)
+	raw  string // リスティングに表示する内容
+	pos  Position
+}
+
+type macro struct {
+	name   string
+	params []string
+	body   []srcLine
+	pos    Position
+}
+
+// condState .if ... .endifの1段。
+type condState struct {
+	active bool // 現在の分岐を出力するか
+	parent bool // 外側が出力中か
+	taken  bool // いずれかの分岐を出力したか
+	inElse bool
+	pos    Position
+}
+
+type preprocessor struct {
+	constants  map[string]int
+	constOrder []string
+	macros     map[string]*macro
+	defining   *macro          // .macro ... .endmの収集中
+	locals     map[string]bool // マクロ展開で改名したラベル
+	globals    map[string]bool // .globalで公開を宣言したラベル
+	depth      int
+	expansions int
+	out        []srcLine
+	diags      Diagnostics
+}
+
+// preprocess srcのディレクティブとマクロを展開した行, .equで定義した定数,
+// マクロ展開で改名したラベル, .globalで宣言したラベルを返す。
+// 誤ったディレクティブは読み飛ばし、その位置をDiagnosticsとして返す。
+func preprocess(name string, src []byte, opts Options) ([]srcLine, []Symbol, map[string]bool, map[string]bool, Diagnostics) {
+	pp := &preprocessor{
+		constants: make(map[string]int),
+		macros:    make(map[string]*macro),
+		locals:    make(map[string]bool),
+		globals:   make(map[string]bool),
+	}
+	for k, v := range opts.Defines {
+		pp.constants[k] = v
+		pp.constOrder = append(pp.constOrder, k)
+	}
+	sort.Strings(pp.constOrder)
+	pp.process(splitSource(name, string(src), nil))
+	if pp.defining != nil {
+		pp.errorf(pp.defining.pos, 1, pp.defining.name, "unterminated macro (missing .endm)")
+	}
+	var constants []Symbol
+	for _, k := range pp.constOrder {
+		constants = append(constants, Symbol{Name: k, Address: pp.constants[k], Kind: Constant})
+	}
+	return pp.out, constants, pp.locals, pp.globals, pp.diags
+}
+
+func splitSource(file, src string, trace []Frame) []srcLine {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1] // 末尾の改行
+	}
+	out := make([]srcLine, len(lines))
+	for i, l := range lines {
+		out[i] = srcLine{text: l, raw: l, pos: Position{File: file, Line: i + 1, Trace: trace}}
+	}
+	return out
+}
+
+func (pp *preprocessor) errorf(pos Position, col int, mnemonic, format string, args ...interface{}) {
+	pp.diags = append(pp.diags, Diagnostic{
+		File: pos.File, Line: pos.Line, Column: col, Mnemonic: mnemonic,
+		Message: fmt.Sprintf(format, args...), Trace: pos.Trace,
+	})
+}
+
+// emit パーサーに渡さない行をリスティング用に残す。
+func (pp *preprocessor) emit(l srcLine) {
+	pp.out = append(pp.out, srcLine{raw: l.raw, pos: l.pos})
+}
+
+// process 1ファイルまたは1回のマクロ展開分の行を処理する。
+func (pp *preprocessor) process(lines []srcLine) {
+	var conds []condState
+	active := func() bool { return len(conds) == 0 || conds[len(conds)-1].active }
+
+	for _, l := range lines {
+		code := strings.SplitN(l.text, "//", 2)[0]
+		fields := strings.Fields(strings.ReplaceAll(code, ",", " "))
+		col := len(code) - len(strings.TrimLeft(code, " \t")) + 1
+		directive := ""
+		if len(fields) > 0 && strings.HasPrefix(fields[0], ".") {
+			directive = fields[0]
+		}
+
+		if pp.defining != nil {
+			switch directive {
+			case ".endm":
+				pp.macros[pp.defining.name] = pp.defining
+				pp.defining = nil
+			case ".macro":
+				pp.errorf(l.pos, col, directive, "nested macro definition")
+			default:
+				pp.defining.body = append(pp.defining.body, l)
+			}
+			pp.emit(l)
+			continue
+		}
+
+		switch directive {
+		case ".if", ".ifdef", ".ifndef":
+			c := condState{parent: active(), pos: l.pos}
+			if c.parent {
+				c.active = pp.cond(directive, fields[1:], l.pos, col)
+			}
+			c.taken = c.active
+			conds = append(conds, c)
+			pp.emit(l)
+			continue
+		case ".else":
+			if len(conds) == 0 || conds[len(conds)-1].inElse {
+				pp.errorf(l.pos, col, directive, ".else without .if")
+			} else {
+				c := &conds[len(conds)-1]
+				c.active = c.parent && !c.taken
+				c.inElse = true
+			}
+			pp.emit(l)
+			continue
+		case ".endif":
+			if len(conds) == 0 {
+				pp.errorf(l.pos, col, directive, ".endif without .if")
+			} else {
+				conds = conds[:len(conds)-1]
+			}
+			pp.emit(l)
+			continue
+		}
+		if !active() {
+			pp.emit(l)
+			continue
+		}
+
+		switch {
+		case directive == ".equ":
+			pp.emit(l)
+			pp.define(fields[1:], l.pos, col)
+		case directive == ".include":
+			pp.emit(l)
+			pp.include(code, l.pos, col)
+		case directive == ".global":
+			pp.emit(l)
+			pp.global(fields[1:], l.pos, col)
+		case directive == ".macro":
+			pp.emit(l)
+			pp.startMacro(code, fields[1:], l.pos, col)
+		case directive == ".endm":
+			pp.emit(l)
+			pp.errorf(l.pos, col, directive, ".endm without .macro")
+		case directive != "":
+			pp.emit(l)
+			pp.errorf(l.pos, col, directive, "unknown directive")
+		case len(fields) > 0 && pp.macros[fields[0]] != nil:
+			pp.emit(l)
+			pp.expand(pp.macros[fields[0]], code, l.pos, col)
+		default:
+			pp.out = append(pp.out, l)
+		}
+	}
+	for _, c := range conds {
+		pp.errorf(c.pos, 1, ".if", "unterminated conditional (missing .endif)")
+	}
+}
+
+// define ".equ NAME value"
+func (pp *preprocessor) define(args []string, pos Position, col int) {
+	if len(args) < 2 {
+		pp.errorf(pos, col, ".equ", "want .equ NAME value")
+		return
+	}
+	name := args[0]
+	if msg := checkSymbolName(name); msg != "" {
+		pp.errorf(pos, col, name, "%s", msg)
+		return
+	}
+	if _, ok := predefinedSymbols[name]; ok {
+		pp.errorf(pos, col, name, "constant redefines predefined symbol")
+		return
+	}
+	if _, ok := pp.constants[name]; ok {
+		pp.errorf(pos, col, name, "constant already defined")
+		return
+	}
+	expr := strings.Join(args[1:], " ")
+	v, err := pp.value(expr)
+	if err != nil {
+		pp.errorf(pos, col, expr, "%v", err)
+		return
+	}
+	pp.constants[name] = v
+	pp.constOrder = append(pp.constOrder, name)
+}
+
+// value 数値, 定義済みの定数またはそれらの式の値を返す。
+func (pp *preprocessor) value(s string) (int, error) {
+	return evalExpr(s, func(name string) (int, bool) {
+		if v, ok := pp.constants[name]; ok {
+			return v, true
+		}
+		v, ok := predefinedSymbols[name]
+		return v, ok
+	})
+}
+
+// cond .if/.ifdef/.ifndefの条件を評価する。
+func (pp *preprocessor) cond(directive string, args []string, pos Position, col int) bool {
+	if directive != ".if" {
+		if len(args) != 1 {
+			pp.errorf(pos, col, directive, "want %s NAME", directive)
+			return false
+		}
+		_, isConst := pp.constants[args[0]]
+		defined := isConst || pp.macros[args[0]] != nil
+		return defined == (directive == ".ifdef")
+	}
+	if len(args) != 1 && len(args) != 3 {
+		pp.errorf(pos, col, directive, "want .if value or .if value op value")
+		return false
+	}
+	lhs, err := pp.value(args[0])
+	if err != nil {
+		pp.errorf(pos, col, args[0], "%v", err)
+		return false
+	}
+	if len(args) == 1 {
+		return lhs != 0
+	}
+	rhs, err := pp.value(args[2])
+	if err != nil {
+		pp.errorf(pos, col, args[2], "%v", err)
+		return false
+	}
+	switch args[1] {
+	case "==":
+		return lhs == rhs
+	case "!=":
+		return lhs != rhs
+	case "<":
+		return lhs < rhs
+	case ">":
+		return lhs > rhs
+	case "<=":
+		return lhs <= rhs
+	case ">=":
+		return lhs >= rhs
+	}
+	pp.errorf(pos, col, args[1], "invalid comparison operator")
+	return false
+}
+
+// include ".include "file.asm""
+func (pp *preprocessor) include(code string, pos Position, col int) {
+	arg := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(code), ".include"))
+	if len(arg) < 2 || arg[0] != '"' || arg[len(arg)-1] != '"' {
+		pp.errorf(pos, col, ".include", "want .include \"file.asm\"")
+		return
+	}
+	arg = arg[1 : len(arg)-1]
+	path := arg
+	if !filepath.IsAbs(path) && pos.File != "" && !strings.HasPrefix(pos.File, "<") {
+		path = filepath.Join(filepath.Dir(pos.File), path)
+	}
+	files := []string{pos.File}
+	for _, f := range pos.Trace {
+		files = append(files, f.File)
+	}
+	for _, f := range files {
+		if filepath.Clean(f) == filepath.Clean(path) {
+			pp.errorf(pos, col, arg, "cyclic include")
+			return
+		}
+	}
+	if pp.depth >= maxExpansionDepth {
+		pp.errorf(pos, col, arg, "include nested too deeply")
+		return
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		pp.errorf(pos, col, arg, "cannot include: %v", err)
+		return
+	}
+	trace := append([]Frame{{File: pos.File, Line: pos.Line}}, pos.Trace...)
+	pp.depth++
+	pp.process(splitSource(path, string(b), trace))
+	pp.depth--
+}
+
+// global ".global NAME1, NAME2"
+func (pp *preprocessor) global(args []string, pos Position, col int) {
+	if len(args) == 0 {
+		pp.errorf(pos, col, ".global", "want .global NAME")
+	}
+	for _, name := range args {
+		if msg := checkSymbolName(name); msg != "" {
+			pp.errorf(pos, col, name, "%s", msg)
+			continue
+		}
+		pp.globals[name] = true
+	}
+}
+
+// startMacro ".macro NAME p1, p2"
+// 引数の名前の誤りは、codeの中のその引数の位置で報告する。
+func (pp *preprocessor) startMacro(code string, args []string, pos Position, col int) {
+	if len(args) == 0 {
+		pp.errorf(pos, col, ".macro", "missing macro name")
+		args = []string{""}
+	}
+	m := &macro{name: args[0], params: args[1:], pos: pos}
+	if msg := checkSymbolName(m.name); m.name != "" && msg != "" {
+		pp.errorf(pos, col, m.name, "%s", msg)
+	} else if _, ok := compTable[canonical(compAliases, Mnemonic(m.name))]; ok {
+		pp.errorf(pos, col, m.name, "macro name conflicts with comp mnemonic")
+	} else if pp.macros[m.name] != nil {
+		pp.errorf(pos, col, m.name, "macro already defined")
+	}
+	off := col - 1 + len(".macro") + strings.Index(code[col-1+len(".macro"):], m.name) + len(m.name)
+	for _, p := range m.params {
+		i := strings.Index(code[off:], p)
+		pcol := off + i + 1
+		off += i + len(p)
+		// レジスタ名の引数は本体のdestやcompの中の同じ文字まで置き換えてしまう。
+		if _, ok := destTable[canonical(destAliases, Mnemonic(p))]; ok && p != "null" {
+			pp.errorf(pos, pcol, p, "macro parameter name conflicts with register")
+		} else if msg := checkSymbolName(p); msg != "" {
+			pp.errorf(pos, pcol, p, "illegal macro parameter name")
+		}
+	}
+	// 名前が不正でも.endmまでは本体として読み飛ばす。
+	pp.defining = m
+}
+
+// expand マクロ呼び出し "NAME a1, a2" を展開する。
+func (pp *preprocessor) expand(m *macro, code string, pos Position, col int) {
+	argText := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(code), m.name))
+	var args []string
+	if argText != "" {
+		for _, a := range strings.Split(argText, ",") {
+			args = append(args, strings.TrimSpace(a))
+		}
+	}
+	if len(args) != len(m.params) {
+		pp.errorf(pos, col, m.name, "macro takes %d argument(s), got %d", len(m.params), len(args))
+		return
+	}
+	if pp.depth >= maxExpansionDepth {
+		pp.errorf(pos, col, m.name, "macro expansion nested too deeply (recursive macro?)")
+		return
+	}
+
+	// 引数の置き換えと、本体で定義したラベルの改名 (展開ごとに一意にする)。
+	pp.expansions++
+	repl := make(map[string]string)
+	for i, p := range m.params {
+		repl[p] = args[i]
+	}
+	for _, l := range m.body {
+		s := strings.TrimSpace(strings.SplitN(l.text, "//", 2)[0])
+		if !strings.HasPrefix(s, "(") || !strings.HasSuffix(s, ")") {
+			continue
+		}
+		// 引数で渡されたラベルは呼び出し側のものなので改名しない。
+		if label := s[1 : len(s)-1]; repl[label] == "" {
+			repl[label] = fmt.Sprintf("%s$%s.%d", label, m.name, pp.expansions)
+			pp.locals[repl[label]] = true
+		}
+	}
+	trace := append([]Frame{{Macro: m.name, File: pos.File, Line: pos.Line}}, pos.Trace...)
+	body := make([]srcLine, len(m.body))
+	for i, l := range m.body {
+		text := replaceWords(strings.SplitN(l.text, "//", 2)[0], repl)
+		body[i] = srcLine{text: text, raw: text, pos: Position{File: l.pos.File, Line: l.pos.Line, Trace: trace}}
+	}
+	pp.depth++
+	pp.process(body)
+	pp.depth--
+}
+
+// replaceWords sの中のシンボル(英数字と_.$:の並び)のうちreplにあるものを置き換える。
+func replaceWords(s string, repl map[string]string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if !isSymbolChar(s[i]) {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && isSymbolChar(s[j]) {
+			j++
+		}
+		if r, ok := repl[s[i:j]]; ok {
+			b.WriteString(r)
+		} else {
+			b.WriteString(s[i:j])
+		}
+		i = j
+	}
+	return b.String()
+}
+
+func isSymbolChar(c byte) bool {
+	return c == '_' || c == '.' || c == '$' || c == ':' || isDigit(c) ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
@@ -0,0 +1,46 @@
+package assembler
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMacroParameterNames(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []Diagnostic // Line, Column, Mnemonic, Messageだけを比べる
+	}{
+		{".macro SET D, x\n@x\nM=D\n.endm\n", []Diagnostic{{Line: 1, Column: 12, Mnemonic: "D", Message: "macro parameter name conflicts with register"}}},
+		{".macro SET a, AM\n.endm\n", []Diagnostic{{Line: 1, Column: 15, Mnemonic: "AM", Message: "macro parameter name conflicts with register"}}},
+		{"  .macro SET MA,DMA , 1x\n.endm\n", []Diagnostic{
+			{Line: 1, Column: 14, Mnemonic: "MA", Message: "macro parameter name conflicts with register"},
+			{Line: 1, Column: 17, Mnemonic: "DMA", Message: "macro parameter name conflicts with register"},
+			{Line: 1, Column: 23, Mnemonic: "1x", Message: "illegal macro parameter name"},
+		}},
+		// 名前の一部にレジスタ名を含むだけなら使える
+		{".macro SET ADDR, DM1, null\n@ADDR\n.endm\nSET 1, 2, 3\n", nil},
+	}
+	for _, tt := range tests {
+		_, err := Assemble(strings.NewReader(tt.src))
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%q: %v", tt.src, err)
+			}
+			continue
+		}
+		var diags Diagnostics
+		if !errors.As(err, &diags) {
+			t.Errorf("%q: got %v, want diagnostics", tt.src, err)
+			continue
+		}
+		var got []Diagnostic
+		for _, d := range diags {
+			got = append(got, Diagnostic{Line: d.Line, Column: d.Column, Mnemonic: d.Mnemonic, Message: d.Message})
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q:\n got  %+v\n want %+v", tt.src, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package profile
+
+import (
+	"compress/gzip"
+	"io"
+	"sort"
+)
+
+// WritePprof 呼び出しの木をpprof形式 (gzipしたprofile.proto) で書き出す。
+// go tool pprofで表示できる。サンプルの値は各呼び出しの並びで実行したサイクル数。
+func (p *Profiler) WritePprof(w io.Writer) error {
+	var b protoBuf
+	strs := map[string]int{}
+	str := func(s string) uint64 {
+		if i, ok := strs[s]; ok {
+			return uint64(i)
+		}
+		strs[s] = len(strs)
+		return uint64(len(strs) - 1)
+	}
+	str("") // string_tableの0番目は空文字列
+
+	// sample_type, period_type
+	valueType := func(field int) {
+		var vt protoBuf
+		vt.uint(1, str("cycles"))
+		vt.uint(2, str("count"))
+		b.bytes(field, vt)
+	}
+	valueType(1)
+
+	// sample: 葉から根へのロケーション (ロケーションIDは関数の添字+1)
+	var walk func(n *node, stack []uint64)
+	walk = func(n *node, stack []uint64) {
+		if n != p.root {
+			stack = append([]uint64{uint64(n.fn) + 1}, stack...)
+		}
+		if n.self > 0 {
+			locs := stack
+			if n == p.root {
+				locs = []uint64{1}
+			}
+			var s protoBuf
+			s.packed(1, locs)
+			s.packed(2, []uint64{n.self})
+			b.bytes(2, s)
+		}
+		for _, fn := range sortedKeys(n.children) {
+			walk(n.children[fn], stack)
+		}
+	}
+	walk(p.root, nil)
+
+	// location, function
+	for i, f := range p.funcs {
+		id := uint64(i) + 1
+		var line protoBuf
+		line.uint(1, id)
+		var loc protoBuf
+		loc.uint(1, id)
+		loc.uint(3, uint64(f.addr))
+		loc.bytes(4, line)
+		b.bytes(4, loc)
+
+		var fn protoBuf
+		fn.uint(1, id)
+		fn.uint(2, str(f.name))
+		fn.uint(3, str(f.name))
+		b.bytes(5, fn)
+	}
+
+	valueType(11)
+	b.uint(12, 1)
+
+	table := make([]string, len(strs))
+	for s, i := range strs {
+		table[i] = s
+	}
+	for _, s := range table {
+		b.bytes(6, protoBuf(s))
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func sortedKeys(m map[int]*node) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// protoBuf Protocol Buffersのメッセージを組み立てる。pprofに必要な型だけを扱う。
+type protoBuf []byte
+
+func (b *protoBuf) varint(v uint64) {
+	for v >= 0x80 {
+		*b = append(*b, byte(v)|0x80)
+		v >>= 7
+	}
+	*b = append(*b, byte(v))
+}
+
+// uint varintのフィールドを追加する。0は省略する。
+func (b *protoBuf) uint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.varint(uint64(field)<<3 | 0)
+	b.varint(v)
+}
+
+// bytes 長さ付きのフィールド (文字列, 埋め込みメッセージ) を追加する。
+func (b *protoBuf) bytes(field int, v []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+// packed 数値の繰り返しフィールドを追加する。
+func (b *protoBuf) packed(field int, vs []uint64) {
+	var p protoBuf
+	for _, v := range vs {
+		p.varint(v)
+	}
+	b.bytes(field, p)
+}
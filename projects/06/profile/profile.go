@@ -0,0 +1,318 @@
+// Package profile はHack CPUエミュレータで実行したプログラムのサイクル数を、
+// ラベルと関数ごとに集計する。
+//
+// 関数はVMトランスレータが出力する "Class.function" 形式のラベル (IsFunction) とし、
+// その先頭へのジャンプを呼び出し、VMの呼び出し規約でLCL-5に保存されるリターンアドレスへの
+// ジャンプを戻りとみなして、実行時の呼び出しスタックを追跡する。
+package profile
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/momotaro98/nand2tetris/assembler"
+	"github.com/momotaro98/nand2tetris/assembler/cpu"
+)
+
+// maxDepth 呼び出しスタックの深さの上限。呼び出し規約に従わないプログラムで際限なく深くならないようにする。
+const maxDepth = 4096
+
+// topName どの関数にも入っていない(ブートストラップなど)コードの名前。
+const topName = "(top)"
+
+// IsFunction ラベルがVMの関数名かを返す。
+// "LOOP_math.multiply" のように大文字の接頭辞と'_'で始まるラベルはトランスレータの内部ラベルとみなす。
+func IsFunction(label string) bool {
+	if !strings.Contains(label, ".") || strings.ContainsAny(label, "$:") {
+		return false
+	}
+	prefix, _, found := strings.Cut(label, "_")
+	return !found || prefix == "" || strings.ToUpper(prefix) != prefix
+}
+
+// node 呼び出しの木の1つの節 (根からの呼び出しの並びごとに1つ)。
+type node struct {
+	fn       int // funcs[fn]
+	parent   *node
+	children map[int]*node
+	self     uint64 // この呼び出しの並びで実行したサイクル数
+	calls    uint64
+	ret      uint16 // 呼び出しから戻るアドレス
+}
+
+func (n *node) child(fn int) *node {
+	if c, ok := n.children[fn]; ok {
+		return c
+	}
+	if n.children == nil {
+		n.children = make(map[int]*node)
+	}
+	c := &node{fn: fn, parent: n}
+	n.children[fn] = c
+	return c
+}
+
+func (n *node) total() uint64 {
+	t := n.self
+	for _, c := range n.children {
+		t += c.total()
+	}
+	return t
+}
+
+// function 関数またはラベルの情報。
+type function struct {
+	name string
+	addr int
+}
+
+// Profiler 実行したサイクル数を集計する。
+type Profiler struct {
+	cpu *cpu.CPU
+
+	labels     []function // アドレス順のラベル
+	labelAt    []int32    // ROMアドレス → そこを含むラベル (labelsの添字, 無ければ-1)
+	labelSelf  []uint64
+	funcs      []function // funcs[0]はtopName
+	entry      map[uint16]int
+	root       *node
+	cur        *node
+	depth      int
+	lastCycles uint64
+}
+
+// New cで実行するプログラムのProfilerを返す。symbolsのラベルで集計する。
+func New(c *cpu.CPU, symbols []assembler.Symbol) *Profiler {
+	p := &Profiler{
+		cpu:     c,
+		labelAt: make([]int32, c.Size),
+		funcs:   []function{{topName, 0}},
+		entry:   make(map[uint16]int),
+	}
+	for _, sym := range symbols {
+		if sym.Kind == assembler.Label {
+			p.labels = append(p.labels, function{sym.Name, sym.Address})
+		}
+	}
+	// 同じアドレスのラベルは関数を優先する (リターンアドレスのラベルと関数が並ぶ場合など)。
+	sort.SliceStable(p.labels, func(i, j int) bool {
+		if p.labels[i].addr != p.labels[j].addr {
+			return p.labels[i].addr < p.labels[j].addr
+		}
+		return !IsFunction(p.labels[i].name) && IsFunction(p.labels[j].name)
+	})
+	p.labelSelf = make([]uint64, len(p.labels))
+	li := -1
+	for addr := range p.labelAt {
+		for li+1 < len(p.labels) && p.labels[li+1].addr <= addr {
+			li++
+		}
+		p.labelAt[addr] = int32(li)
+	}
+	for _, l := range p.labels {
+		if IsFunction(l.name) {
+			p.entry[uint16(l.addr)] = len(p.funcs)
+			p.funcs = append(p.funcs, l)
+		}
+	}
+	p.root = &node{fn: 0, calls: 1}
+	p.cur = p.root
+	p.lastCycles = c.Cycles
+	return p
+}
+
+// Observe pcの命令を実行した直後に呼び、そのサイクルを集計して呼び出しスタックを更新する。
+func (p *Profiler) Observe(pc uint16) {
+	n := p.cpu.Cycles - p.lastCycles
+	p.lastCycles = p.cpu.Cycles
+	p.cur.self += n
+	if int(pc) < len(p.labelAt) {
+		if li := p.labelAt[pc]; li >= 0 {
+			p.labelSelf[li] += n
+		}
+	}
+
+	// 関数がジャンプの直後から始まる場合 (ブートストラップの後にSys.initが続く場合など) もあるので、
+	// 次のアドレスに進んだかではなくジャンプ命令かで判断する。
+	next := p.cpu.PC
+	if int(pc) >= len(p.cpu.ROM) || !isJump(p.cpu.ROM[pc]) {
+		return
+	}
+	// 呼び出し: 関数の先頭へのジャンプで、呼び出し規約どおりLCL==SPになっている
+	// (戻りでは戻り値が積まれているのでLCL<SP)。リターンアドレスと関数が同じアドレスの場合があるので先に調べる。
+	fn, isEntry := p.entry[next]
+	if isEntry && p.cpu.RAM[0] == p.cpu.RAM[1] && p.depth < maxDepth {
+		p.call(fn)
+		return
+	}
+	// 戻り: 呼び出し元のリターンアドレスへのジャンプ (途中を飛ばした戻りも含めて最も近いものまで戻る)
+	for n := p.cur; n != p.root; n = n.parent {
+		if n.ret == next {
+			p.depth -= depthBetween(p.cur, n.parent)
+			p.cur = n.parent
+			return
+		}
+	}
+	// 呼び出し規約に従わない関数へのジャンプも呼び出しとみなす
+	if isEntry && p.depth < maxDepth {
+		p.call(fn)
+	}
+}
+
+func (p *Profiler) call(fn int) {
+	child := p.cur.child(fn)
+	child.calls++
+	child.ret = p.returnAddress()
+	p.cur = child
+	p.depth++
+}
+
+// isJump instがジャンプするC命令かを返す。
+func isJump(inst uint16) bool {
+	return inst&0x8000 != 0 && inst&0x7 != 0
+}
+
+func depthBetween(from, to *node) int {
+	d := 0
+	for n := from; n != to; n = n.parent {
+		d++
+	}
+	return d
+}
+
+// returnAddress 呼び出された関数の先頭でのリターンアドレス (VMの呼び出し規約ではRAM[LCL-5])。
+func (p *Profiler) returnAddress() uint16 {
+	lcl := int(p.cpu.RAM[1])
+	if lcl < 5 || lcl >= cpu.RAMSize {
+		return 0xffff
+	}
+	return p.cpu.RAM[lcl-5]
+}
+
+// Total 集計したサイクル数。
+func (p *Profiler) Total() uint64 {
+	return p.root.total()
+}
+
+// funcStat 関数ごとの集計。
+type funcStat struct {
+	name  string
+	self  uint64
+	cum   uint64 // 呼び出した関数を含む (再帰は二重に数えない)
+	calls uint64
+}
+
+func (p *Profiler) funcStats() []funcStat {
+	stats := make([]funcStat, len(p.funcs))
+	for i, f := range p.funcs {
+		stats[i].name = f.name
+	}
+	active := make([]int, len(p.funcs)) // 根からの経路上にあるその関数の数
+	var walk func(n *node) uint64
+	walk = func(n *node) uint64 {
+		active[n.fn]++
+		t := n.self
+		for _, c := range n.children {
+			t += walk(c)
+		}
+		active[n.fn]--
+		st := &stats[n.fn]
+		st.self += n.self
+		st.calls += n.calls
+		if active[n.fn] == 0 {
+			st.cum += t
+		}
+		return t
+	}
+	walk(p.root)
+	stats[0].calls = 0
+	return stats
+}
+
+func percent(n, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+// WriteFlat 関数ごとのサイクル数をSELFの多い順に書き出す。
+// CUMは呼び出した関数のサイクルを含む。
+func (p *Profiler) WriteFlat(w io.Writer) error {
+	stats := p.funcStats()
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].self > stats[j].self })
+	total := p.Total()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SELF\tSELF%\tCUM\tCUM%\tCALLS\tFUNCTION")
+	for _, s := range stats {
+		if s.self == 0 && s.cum == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "%d\t%.2f%%\t%d\t%.2f%%\t%d\t%s\n", s.self, percent(s.self, total), s.cum, percent(s.cum, total), s.calls, s.name)
+	}
+	fmt.Fprintf(tw, "%d\t\t\t\t\ttotal\n", total)
+	return tw.Flush()
+}
+
+// WriteLabels ラベルごと(次のラベルまでの命令)のサイクル数を多い順に書き出す。
+func (p *Profiler) WriteLabels(w io.Writer) error {
+	order := make([]int, len(p.labels))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return p.labelSelf[order[i]] > p.labelSelf[order[j]] })
+	total := p.Total()
+	var unlabeled uint64 = total
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CYCLES\tPERCENT\tADDRESS\tLABEL")
+	for _, i := range order {
+		n := p.labelSelf[i]
+		unlabeled -= n
+		if n == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "%d\t%.2f%%\t%d\t%s\n", n, percent(n, total), p.labels[i].addr, p.labels[i].name)
+	}
+	if unlabeled > 0 {
+		fmt.Fprintf(tw, "%d\t%.2f%%\t0\t%s\n", unlabeled, percent(unlabeled, total), topName)
+	}
+	return tw.Flush()
+}
+
+// WriteTree 呼び出しの木を、呼び出した関数を含むサイクル数とともに字下げして書き出す。
+// 全体のminPercent%未満の枝は省略する。
+func (p *Profiler) WriteTree(w io.Writer, minPercent float64) error {
+	total := p.Total()
+	var walk func(n *node, depth int) error
+	walk = func(n *node, depth int) error {
+		t := n.total()
+		if n != p.root && percent(t, total) < minPercent {
+			return nil
+		}
+		if _, err := fmt.Fprintf(w, "%s%s  %d (%.2f%%) self=%d calls=%d\n",
+			strings.Repeat("  ", depth), p.funcs[n.fn].name, t, percent(t, total), n.self, n.calls); err != nil {
+			return err
+		}
+		children := make([]*node, 0, len(n.children))
+		for _, c := range n.children {
+			children = append(children, c)
+		}
+		sort.Slice(children, func(i, j int) bool {
+			ti, tj := children[i].total(), children[j].total()
+			if ti != tj {
+				return ti > tj
+			}
+			return children[i].fn < children[j].fn
+		})
+		for _, c := range children {
+			if err := walk(c, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(p.root, 0)
+}
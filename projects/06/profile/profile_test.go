@@ -0,0 +1,280 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/momotaro98/nand2tetris/assembler"
+	"github.com/momotaro98/nand2tetris/assembler/cpu"
+)
+
+func TestIsFunction(t *testing.T) {
+	tests := []struct {
+		label string
+		want  bool
+	}{
+		{"Main.main", true},
+		{"Main.get_value", true},
+		{"_private.f", true},
+		{"Sys.init$WHILE", false},
+		{"LOOP_math.multiply", false},
+		{"RET_ADDRESS_CALL3", false},
+		{"END", false},
+		{"Foo.bar:1", false},
+	}
+	for _, tt := range tests {
+		if got := IsFunction(tt.label); got != tt.want {
+			t.Errorf("IsFunction(%q) = %v", tt.label, got)
+		}
+	}
+}
+
+// callSrc VMの呼び出し規約に従って Sys.init → Math.twice → Main.leaf ×2, Sys.init → Main.leaf と呼び出す。
+// CALLとRETURNはどちらも36命令で、Main.leafは1命令の本体とRETURNを実行する。
+const callSrc = `
+.macro PUSH_D
+    @SP
+    AM=M+1
+    A=A-1
+    M=D
+.endm
+
+.macro PUSH_REG reg
+    @reg
+    D=M
+    PUSH_D
+.endm
+
+.macro CALL f
+    @RET
+    D=A
+    PUSH_D
+    PUSH_REG LCL
+    PUSH_REG ARG
+    PUSH_REG THIS
+    PUSH_REG THAT
+    @SP
+    D=M
+    @LCL
+    M=D
+    @f
+    0;JMP
+(RET)
+.endm
+
+.macro POP_FRAME reg
+    @R13
+    AM=M-1
+    D=M
+    @reg
+    M=D
+.endm
+
+.macro RETURN
+    @LCL
+    D=M
+    @R13
+    M=D
+    @5
+    A=D-A
+    D=M
+    @R14
+    M=D
+    POP_FRAME THAT
+    POP_FRAME THIS
+    POP_FRAME ARG
+    POP_FRAME LCL
+    @R13
+    D=M-1
+    @SP
+    M=D
+    @R14
+    A=M
+    0;JMP
+.endm
+
+    @256
+    D=A
+    @SP
+    M=D
+    CALL Sys.init
+(Sys.init)
+    CALL Math.twice
+    CALL Main.leaf
+(Sys.init$HALT)
+    @Sys.init$HALT
+    0;JMP
+(Math.twice)
+    CALL Main.leaf
+    CALL Main.leaf
+    RETURN
+(Main.leaf)
+    D=0
+    RETURN
+`
+
+// runProfile srcを停止ループに入るまで実行し、そのProfilerを返す。
+func runProfile(t *testing.T, src string) *Profiler {
+	t.Helper()
+	res, err := assembler.AssembleSource("", strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cpu.New(res.Words)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := New(c, res.Symbols)
+	for !c.IsHalted() {
+		if c.Cycles > 10000 {
+			t.Fatal("program did not halt")
+		}
+		pc := c.PC
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+		p.Observe(pc)
+	}
+	return p
+}
+
+func TestCallTracking(t *testing.T) {
+	p := runProfile(t, callSrc)
+	if p.Total() != 331 {
+		t.Errorf("total %d, want 331", p.Total())
+	}
+	want := map[string]funcStat{
+		// ブートストラップ (4命令) とSys.initの呼び出し
+		"(top)":      {"(top)", 40, 331, 0},
+		"Sys.init":   {"Sys.init", 72, 291, 1},
+		"Math.twice": {"Math.twice", 108, 182, 1},
+		"Main.leaf":  {"Main.leaf", 111, 111, 3},
+	}
+	for _, s := range p.funcStats() {
+		if s != want[s.name] {
+			t.Errorf("got %+v, want %+v", s, want[s.name])
+		}
+	}
+
+	var b strings.Builder
+	if err := p.WriteTree(&b, 0); err != nil {
+		t.Fatal(err)
+	}
+	tree := `(top)  331 (100.00%) self=40 calls=1
+  Sys.init  291 (87.92%) self=72 calls=1
+    Math.twice  182 (54.98%) self=108 calls=1
+      Main.leaf  74 (22.36%) self=74 calls=2
+    Main.leaf  37 (11.18%) self=37 calls=1
+`
+	if b.String() != tree {
+		t.Errorf("tree\n%s\nwant\n%s", b.String(), tree)
+	}
+	b.Reset()
+	p.WriteTree(&b, 20)
+	if strings.Contains(b.String(), "self=37") || !strings.Contains(b.String(), "self=74") {
+		t.Errorf("tree with -prof-min 20\n%s", b.String())
+	}
+
+	b.Reset()
+	if err := p.WriteFlat(&b); err != nil {
+		t.Fatal(err)
+	}
+	flat := `SELF  SELF%   CUM  CUM%     CALLS  FUNCTION
+111   33.53%  111  33.53%   3      Main.leaf
+108   32.63%  182  54.98%   1      Math.twice
+72    21.75%  291  87.92%   1      Sys.init
+40    12.08%  331  100.00%  0      (top)
+331                                total
+`
+	if b.String() != flat {
+		t.Errorf("flat\n%s\nwant\n%s", b.String(), flat)
+	}
+}
+
+func TestRecursion(t *testing.T) {
+	// Main.downはR15が0になるまで自分を呼ぶ。再帰した分をCUMに二重に数えない。
+	src := strings.Replace(callSrc, "    CALL Math.twice\n", "    @3\n    D=A\n    @R15\n    M=D\n    CALL Main.down\n", 1) + `
+(Main.down)
+    @R15
+    MD=M-1
+    @Main.down$BASE
+    D;JEQ
+    CALL Main.down
+(Main.down$BASE)
+    RETURN
+`
+	p := runProfile(t, src)
+	for _, s := range p.funcStats() {
+		switch s.name {
+		case "Main.down":
+			// 3回の呼び出し (R15=2, 1, 0) のうち2回がさらに呼び出す
+			if s.calls != 3 || s.self != 3*(4+36)+2*36 || s.cum != s.self {
+				t.Errorf("Main.down: %+v", s)
+			}
+		case "Sys.init":
+			if s.cum != p.Total()-40 {
+				t.Errorf("Sys.init: %+v, total %d", s, p.Total())
+			}
+		}
+	}
+	var b strings.Builder
+	p.WriteTree(&b, 0)
+	if !strings.Contains(b.String(), "    Main.down  ") || !strings.Contains(b.String(), "        Main.down  ") {
+		t.Errorf("recursive calls should nest in the tree:\n%s", b.String())
+	}
+}
+
+func TestJumpWithoutCall(t *testing.T) {
+	// 呼び出し規約に従わない (LCL != SP) 関数へのジャンプも呼び出しとみなす
+	p := runProfile(t, "@5\nD=A\n@SP\nM=D\n@Main.main\n0;JMP\n(Main.main)\n@Main.main$END\n(Main.main$END)\n@Main.main$END\n0;JMP\n")
+	var b strings.Builder
+	p.WriteTree(&b, 0)
+	if b.String() != "(top)  7 (100.00%) self=6 calls=1\n  Main.main  1 (14.29%) self=1 calls=1\n" {
+		t.Errorf("tree\n%s", b.String())
+	}
+}
+
+func TestWriteLabels(t *testing.T) {
+	p := runProfile(t, callSrc)
+	var b strings.Builder
+	if err := p.WriteLabels(&b); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if lines[0] != "CYCLES  PERCENT  ADDRESS  LABEL" {
+		t.Errorf("header %q", lines[0])
+	}
+	// 関数と同じアドレスのリターンアドレスのラベルには数えない。ブートストラップとSys.initの呼び出し (40サイクル) はどのラベルにも入らない。
+	for _, want := range []string{"  Main.leaf", "  Math.twice", "(top)"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("labels output lacks %q:\n%s", want, b.String())
+		}
+	}
+	if !strings.HasPrefix(lines[len(lines)-1], "40 ") {
+		t.Errorf("unlabeled cycles: %q", lines[len(lines)-1])
+	}
+}
+
+func TestWritePprof(t *testing.T) {
+	p := runProfile(t, callSrc)
+	var buf bytes.Buffer
+	if err := p.WritePprof(&buf); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"cycles", "Sys.init", "Math.twice", "Main.leaf"} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("profile lacks the string %q", s)
+		}
+	}
+}
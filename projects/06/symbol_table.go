@@ -1,4 +1,4 @@
-package main
+package assembler
 
 type SymbolTable interface {
 	addEntry(symbol string, address int)
@@ -8,35 +8,46 @@ type SymbolTable interface {
 
 type symbolTable map[string]int
 
-var st = make(symbolTable)
-
-func init() {
-	st["SP"] = 0
-	st["LCL"] = 1
-	st["ARG"] = 2
-	st["THIS"] = 3
-	st["THAT"] = 4
-	st["R0"] = 0
-	st["R1"] = 1
-	st["R2"] = 2
-	st["R3"] = 3
-	st["R4"] = 4
-	st["R5"] = 5
-	st["R6"] = 6
-	st["R7"] = 7
-	st["R8"] = 8
-	st["R9"] = 9
-	st["R10"] = 10
-	st["R11"] = 11
-	st["R12"] = 12
-	st["R13"] = 13
-	st["R14"] = 14
-	st["R15"] = 15
-	st["SCREEN"] = 16384
-	st["KBD"] = 24576
+// predefinedSymbols 定義済みシンボル。各アセンブルのテーブルにコピーして使い、書き換えない。
+var predefinedSymbols = map[string]int{
+	"SP":     0,
+	"LCL":    1,
+	"ARG":    2,
+	"THIS":   3,
+	"THAT":   4,
+	"R0":     0,
+	"R1":     1,
+	"R2":     2,
+	"R3":     3,
+	"R4":     4,
+	"R5":     5,
+	"R6":     6,
+	"R7":     7,
+	"R8":     8,
+	"R9":     9,
+	"R10":    10,
+	"R11":    11,
+	"R12":    12,
+	"R13":    13,
+	"R14":    14,
+	"R15":    15,
+	"SCREEN": 16384,
+	"KBD":    24576,
 }
 
+// Predefined 定義済みシンボル(SP, R0〜R15, SCREEN, KBDなど)のアドレスを返す。
+func Predefined(name string) (int, bool) {
+	v, ok := predefinedSymbols[name]
+	return v, ok
+}
+
+// NewSymbolTable 定義済みシンボルだけを持つ新しいテーブルを返す。
+// アセンブルごとに作るため、ラベルや変数が別のアセンブルに漏れることはない。
 func NewSymbolTable() SymbolTable {
+	st := make(symbolTable, len(predefinedSymbols))
+	for k, v := range predefinedSymbols {
+		st[k] = v
+	}
 	return st
 }
 
@@ -0,0 +1,231 @@
+// Package trace はHack CPUエミュレータの実行をサイクルごとに記録し、
+// JSONLまたはVCD (GTKWaveなどの波形ビューアで読める形式) で書き出す。
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/momotaro98/nand2tetris/assembler"
+	"github.com/momotaro98/nand2tetris/assembler/cpu"
+)
+
+// Entry 1サイクル分の実行記録。A, Dは命令を実行した後の値。
+type Entry struct {
+	Cycle uint64 // 0始まりのサイクル番号
+	PC    uint16 // 実行した命令のアドレス
+	Inst  uint16
+	A     uint16
+	D     uint16
+	Write *Write // メモリへの書き込み (無い場合はnil)
+}
+
+// Write 1回のメモリへの書き込み。
+type Write struct {
+	Addr  uint16 `json:"addr"`
+	Value uint16 `json:"value"`
+}
+
+// Step cの命令を1つ実行し、その記録を返す。
+func Step(c *cpu.CPU) (Entry, error) {
+	e := Entry{Cycle: c.Cycles, PC: c.PC}
+	if int(c.PC) < cpu.ROMSize {
+		e.Inst = c.ROM[c.PC]
+	}
+	addr := c.A
+	writes := e.Inst&0x8000 != 0 && e.Inst&0x8 != 0 && addr != cpu.KBDAddr
+	if err := c.Step(); err != nil {
+		return e, err
+	}
+	e.A, e.D = c.A, c.D
+	if writes {
+		e.Write = &Write{Addr: addr, Value: c.RAM[addr]}
+	}
+	return e, nil
+}
+
+// Range 閉区間 [Lo, Hi]。
+type Range struct {
+	Lo, Hi uint64
+}
+
+func (r Range) contains(v uint64) bool { return r.Lo <= v && v <= r.Hi }
+
+// ParseRange "lo-hi", "lo-" または "n" 形式の範囲を解釈する。
+func ParseRange(s string) (Range, error) {
+	loS, hiS, found := strings.Cut(s, "-")
+	lo, err := strconv.ParseUint(loS, 10, 64)
+	if err != nil {
+		return Range{}, fmt.Errorf("invalid range %q", s)
+	}
+	if !found {
+		return Range{lo, lo}, nil
+	}
+	if hiS == "" {
+		return Range{lo, ^uint64(0)}, nil
+	}
+	hi, err := strconv.ParseUint(hiS, 10, 64)
+	if err != nil || hi < lo {
+		return Range{}, fmt.Errorf("invalid range %q", s)
+	}
+	return Range{lo, hi}, nil
+}
+
+// Filter 記録するサイクルの条件。nilの条件はすべてに一致する。
+type Filter struct {
+	Cycles *Range // サイクル番号の範囲
+	PC     *Range // 実行した命令のROMアドレスの範囲
+	Writes *Range // 書き込み先のRAMアドレスの範囲 (指定するとこの範囲に書き込んだサイクルだけを記録する)
+}
+
+// Match eを記録するかを返す。
+func (f Filter) Match(e Entry) bool {
+	if f.Cycles != nil && !f.Cycles.contains(e.Cycle) {
+		return false
+	}
+	if f.PC != nil && !f.PC.contains(uint64(e.PC)) {
+		return false
+	}
+	if f.Writes != nil && (e.Write == nil || !f.Writes.contains(uint64(e.Write.Addr))) {
+		return false
+	}
+	return true
+}
+
+// Done これ以降のサイクルがFilterに一致しないかを返す。長い実行を早く打ち切るのに使う。
+func (f Filter) Done(cycle uint64) bool {
+	return f.Cycles != nil && cycle > f.Cycles.Hi
+}
+
+// Tracer 実行記録の書き出し先。
+type Tracer interface {
+	// Trace 1サイクル分を書く。
+	Trace(e Entry) error
+	// Close 書きかけのデータを書き出す。出力先は閉じない。
+	Close() error
+}
+
+// NewJSONL 1サイクルを1行のJSONで書くTracerを返す。
+//
+//	{"cycle":5,"pc":5,"inst":"1110001100001000","asm":"M=D","a":0,"d":7,"write":{"addr":0,"value":7}}
+func NewJSONL(w io.Writer) Tracer {
+	return &jsonlTracer{w: bufio.NewWriter(w)}
+}
+
+type jsonlTracer struct {
+	w *bufio.Writer
+}
+
+type jsonlEntry struct {
+	Cycle uint64 `json:"cycle"`
+	PC    uint16 `json:"pc"`
+	Inst  string `json:"inst"`
+	Asm   string `json:"asm"`
+	A     int16  `json:"a"`
+	D     int16  `json:"d"`
+	Write *Write `json:"write,omitempty"`
+}
+
+// Trace implements Tracer
+func (t *jsonlTracer) Trace(e Entry) error {
+	asm, err := assembler.DisassembleWord(e.Inst)
+	if err != nil {
+		asm = "?"
+	}
+	b, err := json.Marshal(jsonlEntry{e.Cycle, e.PC, fmt.Sprintf("%016b", e.Inst), asm, int16(e.A), int16(e.D), e.Write})
+	if err != nil {
+		return err
+	}
+	t.w.Write(b)
+	return t.w.WriteByte('\n')
+}
+
+// Close implements Tracer
+func (t *jsonlTracer) Close() error {
+	return t.w.Flush()
+}
+
+// vcdSignals VCDに書き出す信号 (識別子, 名前, ビット幅)。
+var vcdSignals = []struct {
+	id    string
+	name  string
+	width int
+}{
+	{"!", "pc", 16},
+	{"\"", "inst", 16},
+	{"#", "a", 16},
+	{"$", "d", 16},
+	{"%", "we", 1},
+	{"&", "addr", 16},
+	{"'", "wdata", 16},
+}
+
+// NewVCD 各サイクルの値をVCD (Value Change Dump) で書くTracerを返す。
+// 時刻はサイクル番号で、値が変わった信号だけを書く。weはメモリに書き込んだサイクルで1になる。
+func NewVCD(w io.Writer) Tracer {
+	return &vcdTracer{w: bufio.NewWriter(w)}
+}
+
+type vcdTracer struct {
+	w       *bufio.Writer
+	started bool
+	last    []uint16
+	time    uint64 // 最後に書いた時刻
+}
+
+// Trace implements Tracer
+func (t *vcdTracer) Trace(e Entry) error {
+	values := []uint16{e.PC, e.Inst, e.A, e.D, 0, 0, 0}
+	if e.Write != nil {
+		values[4], values[5], values[6] = 1, e.Write.Addr, e.Write.Value
+	} else if t.last != nil {
+		values[5], values[6] = t.last[5], t.last[6] // 書き込まないサイクルは前の値を保つ
+	}
+	if !t.started {
+		t.header()
+	}
+	changed := false
+	for i, s := range vcdSignals {
+		if t.last != nil && t.last[i] == values[i] {
+			continue
+		}
+		if !changed {
+			fmt.Fprintf(t.w, "#%d\n", e.Cycle)
+			changed = true
+		}
+		if s.width == 1 {
+			fmt.Fprintf(t.w, "%d%s\n", values[i], s.id)
+		} else {
+			fmt.Fprintf(t.w, "b%b %s\n", values[i], s.id)
+		}
+	}
+	t.last, t.time = values, e.Cycle
+	return nil
+}
+
+func (t *vcdTracer) header() {
+	t.started = true
+	fmt.Fprintln(t.w, "$version Hack CPU emulator $end")
+	fmt.Fprintln(t.w, "$timescale 1ns $end")
+	fmt.Fprintln(t.w, "$scope module hack $end")
+	for _, s := range vcdSignals {
+		fmt.Fprintf(t.w, "$var wire %d %s %s $end\n", s.width, s.id, s.name)
+	}
+	fmt.Fprintln(t.w, "$upscope $end")
+	fmt.Fprintln(t.w, "$enddefinitions $end")
+}
+
+// Close implements Tracer
+// 最後のサイクルの値が表示されるよう、終了時刻を1つ後ろに書く。
+func (t *vcdTracer) Close() error {
+	if !t.started {
+		t.header()
+	} else {
+		fmt.Fprintf(t.w, "#%d\n", t.time+1)
+	}
+	return t.w.Flush()
+}
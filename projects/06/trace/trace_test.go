@@ -0,0 +1,189 @@
+package trace
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/momotaro98/nand2tetris/assembler/cpu"
+)
+
+// program @7 D=A @0 M=D (END) @4 0;JMP
+var program = []uint16{0x0007, 0xec10, 0x0000, 0xe308, 0x0004, 0xea87}
+
+// record programをnサイクル実行した記録を返す。
+func record(t *testing.T, n int) []Entry {
+	t.Helper()
+	c, err := cpu.New(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []Entry
+	for i := 0; i < n; i++ {
+		e, err := Step(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestStep(t *testing.T) {
+	got := record(t, 6)
+	want := []Entry{
+		{Cycle: 0, PC: 0, Inst: 0x0007, A: 7, D: 0},
+		{Cycle: 1, PC: 1, Inst: 0xec10, A: 7, D: 7},
+		{Cycle: 2, PC: 2, Inst: 0x0000, A: 0, D: 7},
+		{Cycle: 3, PC: 3, Inst: 0xe308, A: 0, D: 7, Write: &Write{Addr: 0, Value: 7}},
+		{Cycle: 4, PC: 4, Inst: 0x0004, A: 4, D: 7},
+		{Cycle: 5, PC: 5, Inst: 0xea87, A: 4, D: 7},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Range
+		err  bool
+	}{
+		{"5", Range{5, 5}, false},
+		{"2-8", Range{2, 8}, false},
+		{"3-", Range{3, ^uint64(0)}, false},
+		{"8-2", Range{}, true},
+		{"-4", Range{}, true},
+		{"x", Range{}, true},
+		{"1-y", Range{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRange(tt.s)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseRange(%q) = %v, %v", tt.s, got, err)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	entries := record(t, 6)
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []uint64 // 一致するサイクル
+	}{
+		{"all", Filter{}, []uint64{0, 1, 2, 3, 4, 5}},
+		{"cycles", Filter{Cycles: &Range{1, 2}}, []uint64{1, 2}},
+		{"pc", Filter{PC: &Range{4, 5}}, []uint64{4, 5}},
+		{"writes", Filter{Writes: &Range{0, 0}}, []uint64{3}},
+		{"writes elsewhere", Filter{Writes: &Range{1, 15}}, nil},
+		{"combined", Filter{Cycles: &Range{0, 3}, PC: &Range{2, 5}}, []uint64{2, 3}},
+	}
+	for _, tt := range tests {
+		var got []uint64
+		for _, e := range entries {
+			if tt.filter.Match(e) {
+				got = append(got, e.Cycle)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: matched %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	f := Filter{Cycles: &Range{0, 3}}
+	if f.Done(3) || !f.Done(4) || (Filter{}).Done(1<<40) {
+		t.Error("Done")
+	}
+}
+
+func TestJSONL(t *testing.T) {
+	var b strings.Builder
+	tr := NewJSONL(&b)
+	for _, e := range record(t, 4)[2:] {
+		if err := tr.Trace(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tr.Trace(Entry{Cycle: 9, Inst: 0xffff, A: 0xffff})
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"cycle":2,"pc":2,"inst":"0000000000000000","asm":"@0","a":0,"d":7}
+{"cycle":3,"pc":3,"inst":"1110001100001000","asm":"M=D","a":0,"d":7,"write":{"addr":0,"value":7}}
+{"cycle":9,"pc":0,"inst":"1111111111111111","asm":"?","a":-1,"d":0}
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+const vcdHeader = `$version Hack CPU emulator $end
+$timescale 1ns $end
+$scope module hack $end
+$var wire 16 ! pc $end
+$var wire 16 " inst $end
+$var wire 16 # a $end
+$var wire 16 $ d $end
+$var wire 1 % we $end
+$var wire 16 & addr $end
+$var wire 16 ' wdata $end
+$upscope $end
+$enddefinitions $end
+`
+
+func TestVCD(t *testing.T) {
+	entries := record(t, 6)
+	// 何も変わらないサイクルは時刻ごと書かない
+	entries = append(entries, Entry{Cycle: 6, PC: 5, Inst: 0xea87, A: 4, D: 7})
+	var b strings.Builder
+	tr := NewVCD(&b)
+	for _, e := range entries {
+		if err := tr.Trace(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := vcdHeader + `#0
+b0 !
+b111 "
+b111 #
+b0 $
+0%
+b0 &
+b0 '
+#1
+b1 !
+b1110110000010000 "
+b111 $
+#2
+b10 !
+b0 "
+b0 #
+#3
+b11 !
+b1110001100001000 "
+1%
+b111 '
+#4
+b100 !
+b100 "
+b100 #
+0%
+#5
+b101 !
+b1110101010000111 "
+#7
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+
+	// 1サイクルも記録しなくてもヘッダは書く
+	b.Reset()
+	if err := NewVCD(&b).Close(); err != nil || b.String() != vcdHeader {
+		t.Errorf("empty trace: %q, %v", b.String(), err)
+	}
+}
@@ -0,0 +1,109 @@
+package tst
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/momotaro98/nand2tetris/assembler/cpu"
+)
+
+// CPUSimulator CPUエミュレータ用テストスクリプトの対象。
+// 変数はRAM[n], ROM[n], PC, A, D, timeを扱い、ticktockで1命令を実行する。
+type CPUSimulator struct {
+	load func(path string) ([]uint16, error)
+	cpu  *cpu.CPU
+}
+
+// NewCPUSimulator loadコマンドのファイルをloadProgramで機械語にして実行するCPUSimulatorを返す。
+// .asmのアセンブルや.hackの読み込みは呼び出し側が与える (tstはassemblerのテストからも使うので、assemblerに依存しない)。
+func NewCPUSimulator(loadProgram func(path string) ([]uint16, error)) *CPUSimulator {
+	return &CPUSimulator{load: loadProgram}
+}
+
+// CPU 読み込んだプログラムを実行しているCPUを返す。スクリプトを実行した後のメモリを調べるのに使う。
+func (s *CPUSimulator) CPU() *cpu.CPU {
+	if s.cpu == nil {
+		s.cpu, _ = cpu.New(nil)
+	}
+	return s.cpu
+}
+
+// Load implements Simulator
+func (s *CPUSimulator) Load(path string) error {
+	if path == "" {
+		return errors.New("missing program file")
+	}
+	program, err := s.load(path)
+	if err != nil {
+		return err
+	}
+	s.cpu, err = cpu.New(program)
+	return err
+}
+
+// Set implements Simulator
+func (s *CPUSimulator) Set(name string, value int) error {
+	p, err := s.register(name)
+	if err != nil {
+		return err
+	}
+	*p = uint16(value)
+	return nil
+}
+
+// Get implements Simulator
+func (s *CPUSimulator) Get(name string) (string, error) {
+	if name == "time" {
+		return strconv.FormatUint(s.CPU().Cycles, 10), nil
+	}
+	p, err := s.register(name)
+	if err != nil {
+		return "", err
+	}
+	if name == "PC" || strings.HasPrefix(name, "ROM[") {
+		return strconv.Itoa(int(*p)), nil
+	}
+	return strconv.Itoa(int(int16(*p))), nil
+}
+
+// Exec implements Simulator
+func (s *CPUSimulator) Exec(cmd Command) error {
+	switch cmd.Name {
+	case "ticktock":
+		if s.cpu == nil {
+			return errors.New("no program loaded")
+		}
+		return s.cpu.Step()
+	}
+	return ErrUnsupported
+}
+
+// register 変数名に対応するレジスタまたはメモリのワードを返す。
+func (s *CPUSimulator) register(name string) (*uint16, error) {
+	c := s.CPU()
+	switch name {
+	case "PC":
+		return &c.PC, nil
+	case "A":
+		return &c.A, nil
+	case "D":
+		return &c.D, nil
+	}
+	for _, mem := range []string{"RAM", "ROM"} {
+		idx, found := strings.CutPrefix(name, mem+"[")
+		if !found || !strings.HasSuffix(idx, "]") {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(idx, "]"))
+		if err != nil || n < 0 || mem == "RAM" && n >= cpu.RAMSize || mem == "ROM" && n >= cpu.ROMSize {
+			return nil, fmt.Errorf("invalid address %q", name)
+		}
+		if mem == "RAM" {
+			return &c.RAM[n], nil
+		}
+		return &c.ROM[n], nil
+	}
+	return nil, fmt.Errorf("unknown variable %q", name)
+}
@@ -0,0 +1,61 @@
+package tst
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCPUSimulator(t *testing.T) {
+	var loaded string
+	sim := NewCPUSimulator(func(path string) ([]uint16, error) {
+		loaded = path
+		if strings.HasSuffix(path, "bad.asm") {
+			return nil, errors.New("assembly failed")
+		}
+		return []uint16{0x0000, 0xfc10, 0x0001, 0xe308}, nil // @0 D=M @1 M=D
+	})
+	if err := sim.Exec(Command{Name: "ticktock"}); err == nil {
+		t.Error("ticktock before load: want an error")
+	}
+	if err := sim.Load("dir/bad.asm"); err == nil || loaded != "dir/bad.asm" {
+		t.Errorf("load failure: %v", err)
+	}
+	if err := sim.Load("dir/copy.asm"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.Set("RAM[0]", -3); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if err := sim.Exec(Command{Name: "ticktock"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range map[string]string{
+		"RAM[1]": "-3",
+		"D":      "-3",
+		"A":      "1",
+		"PC":     "4",
+		"ROM[1]": "64528", // ROMとPCは符号なし
+		"time":   "4",
+	} {
+		if got, err := sim.Get(name); err != nil || got != want {
+			t.Errorf("%s = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if sim.CPU().RAM[1] != 0xfffd {
+		t.Errorf("CPU().RAM[1] = %#x", sim.CPU().RAM[1])
+	}
+	for _, name := range []string{"RAM[32768]", "ROM[-1]", "RAM[x]", "M"} {
+		if _, err := sim.Get(name); err == nil {
+			t.Errorf("Get(%q): want an error", name)
+		}
+	}
+	if err := sim.Exec(Command{Name: "eval"}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("eval: %v", err)
+	}
+	if err := sim.Load(""); err == nil {
+		t.Error("load without a file: want an error")
+	}
+}
@@ -0,0 +1,120 @@
+package tst
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Column output-listの1列。"RAM[0]%D2.6.2" のように
+// 変数名と書式(B:2進, D:10進, X:16進, S:文字列)と左余白.幅.右余白から成る。
+type Column struct {
+	Name   string
+	Format byte
+	PadL   int
+	Width  int
+	PadR   int
+}
+
+// ParseColumn output-listの1要素を解釈する。書式省略時は%B1.16.1になる。
+func ParseColumn(s string) (Column, error) {
+	name, spec, found := strings.Cut(s, "%")
+	col := Column{Name: name, Format: 'B', PadL: 1, Width: 16, PadR: 1}
+	if !found {
+		return col, nil
+	}
+	if len(spec) < 1 || strings.IndexByte("BDXS", spec[0]) < 0 {
+		return col, fmt.Errorf("invalid output format %q", s)
+	}
+	col.Format = spec[0]
+	nums := strings.Split(spec[1:], ".")
+	if len(nums) != 3 {
+		return col, fmt.Errorf("invalid output format %q", s)
+	}
+	var vals [3]int
+	for i, n := range nums {
+		v, err := strconv.Atoi(n)
+		if err != nil || v < 0 {
+			return col, fmt.Errorf("invalid output format %q", s)
+		}
+		vals[i] = v
+	}
+	col.PadL, col.Width, col.PadR = vals[0], vals[1], vals[2]
+	return col, nil
+}
+
+// Header 列見出しを返す。名前は列幅の中央に寄せ、収まらない部分は切り詰める。
+func (c Column) Header() string {
+	name := c.Name
+	total := c.PadL + c.Width + c.PadR
+	if len(name) > total {
+		name = name[:total]
+	}
+	left := (total - len(name)) / 2
+	return strings.Repeat(" ", left) + name + strings.Repeat(" ", total-left-len(name))
+}
+
+// Cell 値valueを列の書式で整形する。
+// valueはSimulator.Getが返す文字列で、S以外の書式では10進数である。
+func (c Column) Cell(value string) (string, error) {
+	var s string
+	if c.Format == 'S' {
+		s = value
+		if len(s) > c.Width {
+			s = s[:c.Width]
+		}
+		s += strings.Repeat(" ", c.Width-len(s))
+	} else {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return "", fmt.Errorf("%s: non-numeric value %q", c.Name, value)
+		}
+		switch c.Format {
+		case 'D':
+			s = strconv.Itoa(n)
+			if len(s) > c.Width {
+				s = s[len(s)-c.Width:]
+			}
+			s = strings.Repeat(" ", c.Width-len(s)) + s
+		case 'B':
+			s = lastDigits(fmt.Sprintf("%016b", uint16(n)), c.Width)
+		case 'X':
+			s = lastDigits(fmt.Sprintf("%04X", uint16(n)), c.Width)
+		}
+	}
+	return strings.Repeat(" ", c.PadL) + s + strings.Repeat(" ", c.PadR), nil
+}
+
+// lastDigits sの下位width桁を返す。足りない場合は0で埋める。
+func lastDigits(s string, width int) string {
+	if len(s) >= width {
+		return s[len(s)-width:]
+	}
+	return strings.Repeat("0", width-len(s)) + s
+}
+
+// ParseValue setコマンドの値を解釈する。
+// "%B0101", "%XFF", "%D-1" および接頭辞なしの10進数を受け付ける。
+func ParseValue(s string) (int, error) {
+	base := 10
+	if strings.HasPrefix(s, "%") && len(s) >= 2 {
+		switch s[1] {
+		case 'B':
+			base = 2
+		case 'X':
+			base = 16
+		case 'D':
+		default:
+			return 0, fmt.Errorf("invalid value %q", s)
+		}
+		s = s[2:]
+	}
+	n, err := strconv.ParseInt(s, base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if base != 10 && n > 0xffff {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return int(n), nil
+}
@@ -0,0 +1,73 @@
+package tst
+
+import "testing"
+
+func TestColumn(t *testing.T) {
+	tests := []struct {
+		spec   string
+		value  string
+		header string
+		cell   string
+	}{
+		{"RAM[0]%D2.6.2", "15", "  RAM[0]  ", "      15  "},
+		{"RAM[0]%D2.6.2", "-1", "  RAM[0]  ", "      -1  "},
+		{"RAM[0]%D1.3.1", "12345", "RAM[0", " 345 "},
+		{"PC%B1.16.1", "5", "        PC        ", " 0000000000000101 "},
+		{"PC%B1.16.1", "-1", "        PC        ", " 1111111111111111 "},
+		{"out%B1.4.1", "5", " out  ", " 0101 "},
+		{"a%X1.4.1", "255", "  a   ", " 00FF "},
+		{"a%X0.2.0", "4660", "a ", "34"},
+		{"name%S1.3.1", "hello", "name ", " hel "},
+		{"name%S0.6.0", "hi", " name ", "hi    "},
+		{"in", "1", "        in        ", " 0000000000000001 "},
+	}
+	for _, tt := range tests {
+		col, err := ParseColumn(tt.spec)
+		if err != nil {
+			t.Errorf("%s: %v", tt.spec, err)
+			continue
+		}
+		if got := col.Header(); got != tt.header {
+			t.Errorf("%s: header %q, want %q", tt.spec, got, tt.header)
+		}
+		if got, err := col.Cell(tt.value); err != nil || got != tt.cell {
+			t.Errorf("%s: cell(%s) = %q, %v, want %q", tt.spec, tt.value, got, err, tt.cell)
+		}
+	}
+
+	for _, spec := range []string{"a%", "a%Q1.2.3", "a%D1.2", "a%D1.x.3", "a%D1.-2.3"} {
+		if _, err := ParseColumn(spec); err == nil {
+			t.Errorf("%s: want an error", spec)
+		}
+	}
+	if _, err := (Column{Name: "a", Format: 'D', Width: 6}).Cell("abc"); err == nil {
+		t.Error("non-numeric value in a %D column: want an error")
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+		ok   bool
+	}{
+		{"12", 12, true},
+		{"-3", -3, true},
+		{"%D-1", -1, true},
+		{"%B0101", 5, true},
+		{"%B1111111111111111", 0xffff, true},
+		{"%XFF", 255, true},
+		{"%Xffff", 0xffff, true},
+		{"%X10000", 0, false},
+		{"%Q1", 0, false},
+		{"%B2", 0, false},
+		{"abc", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseValue(tt.s)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseValue(%q) = %d, %v", tt.s, got, err)
+		}
+	}
+}
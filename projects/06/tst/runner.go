@@ -0,0 +1,288 @@
+package tst
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Simulator テストスクリプトから操作されるシミュレータ。
+type Simulator interface {
+	// Load プログラムまたはチップを読み込む。pathはスクリプトのディレクトリからの相対パスを解決済み。
+	Load(path string) error
+	// Set 変数(RAM[3], PC, a, in[2]など)に値を設定する。
+	Set(name string, value int) error
+	// Get 変数の値を返す。数値は10進数の文字列で返す。
+	Get(name string) (string, error)
+	// Exec シミュレータ固有のコマンド(ticktock, tick, tock, evalなど)を実行する。
+	Exec(cmd Command) error
+}
+
+// MaxWhileIterations whileループの最大繰り返し回数。
+// キー入力待ちのような対話的なループがヘッドレス実行で止まらなくなるのを防ぐ。
+var MaxWhileIterations = 1000000
+
+// ErrUnsupported Simulator.Execが知らないコマンドを受け取ったときに返すエラー。
+var ErrUnsupported = errors.New("unsupported command")
+
+// MismatchError 出力が比較ファイルと一致しなかった最初の行。
+type MismatchError struct {
+	Line     int    // 比較ファイル上の行番号 (1始まり)
+	Column   string // 一致しなかった列の変数名 (行全体の場合は空)
+	Expected string
+	Actual   string
+}
+
+func (e *MismatchError) Error() string {
+	s := fmt.Sprintf("comparison failure at line %d", e.Line)
+	if e.Column != "" {
+		s += fmt.Sprintf(" (%s)", e.Column)
+	}
+	return fmt.Sprintf("%s:\n  expected: %s\n  actual:   %s", s, e.Expected, e.Actual)
+}
+
+// Runner 1本のスクリプトを実行する。
+type Runner struct {
+	dir     string
+	sim     Simulator
+	columns []Column
+	out     *bufio.Writer
+	outFile *os.File
+	cmp     []string
+	lines   int // 出力した行数
+}
+
+// Run scriptPathのスクリプトをsimで実行する。
+// 比較ファイルと一致しない場合は*MismatchErrorを返す。
+func Run(scriptPath string, sim Simulator) error {
+	f, err := os.Open(scriptPath)
+	if err != nil {
+		return err
+	}
+	cmds, err := Parse(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", scriptPath, err)
+	}
+
+	r := &Runner{dir: filepath.Dir(scriptPath), sim: sim}
+	defer r.close()
+	if err := r.exec(cmds); err != nil {
+		return err
+	}
+	if r.cmp != nil && r.lines < len(r.cmp) {
+		return &MismatchError{Line: r.lines + 1, Expected: r.cmp[r.lines], Actual: "(no output)"}
+	}
+	return nil
+}
+
+func (r *Runner) close() {
+	if r.out != nil {
+		r.out.Flush()
+		r.outFile.Close()
+	}
+}
+
+func (r *Runner) exec(cmds []Command) error {
+	for _, cmd := range cmds {
+		if err := r.execOne(cmd); err != nil {
+			if _, ok := err.(*MismatchError); ok {
+				return err
+			}
+			return fmt.Errorf("line %d: %s: %w", cmd.Line, cmd.Name, err)
+		}
+	}
+	return nil
+}
+
+func (r *Runner) execOne(cmd Command) error {
+	switch cmd.Name {
+	case "repeat":
+		if cmd.Count < 0 {
+			return errors.New("infinite repeat cannot run headless")
+		}
+		for i := 0; i < cmd.Count; i++ {
+			if err := r.exec(cmd.Body); err != nil {
+				return err
+			}
+		}
+	case "while":
+		for i := 0; ; i++ {
+			ok, err := r.cond(cmd.Args)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				break
+			}
+			if i >= MaxWhileIterations {
+				return fmt.Errorf("condition %q still holds after %d iterations (interactive loop?)", strings.Join(cmd.Args, " "), i)
+			}
+			if err := r.exec(cmd.Body); err != nil {
+				return err
+			}
+		}
+	case "load":
+		path := ""
+		if len(cmd.Args) > 0 {
+			path = filepath.Join(r.dir, cmd.Args[0])
+		}
+		return r.sim.Load(path)
+	case "output-file":
+		if len(cmd.Args) != 1 {
+			return errors.New("want 1 argument")
+		}
+		f, err := os.Create(filepath.Join(r.dir, cmd.Args[0]))
+		if err != nil {
+			return err
+		}
+		r.close()
+		r.outFile, r.out = f, bufio.NewWriter(f)
+	case "compare-to":
+		if len(cmd.Args) != 1 {
+			return errors.New("want 1 argument")
+		}
+		b, err := os.ReadFile(filepath.Join(r.dir, cmd.Args[0]))
+		if err != nil {
+			return err
+		}
+		r.cmp = strings.Split(strings.TrimRight(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n"), "\n")
+	case "output-list":
+		r.columns = r.columns[:0]
+		for _, a := range cmd.Args {
+			col, err := ParseColumn(a)
+			if err != nil {
+				return err
+			}
+			r.columns = append(r.columns, col)
+		}
+		cells := make([]string, len(r.columns))
+		for i, col := range r.columns {
+			cells[i] = col.Header()
+		}
+		return r.writeRow(cells)
+	case "output":
+		cells := make([]string, len(r.columns))
+		for i, col := range r.columns {
+			v, err := r.sim.Get(col.Name)
+			if err != nil {
+				return err
+			}
+			if cells[i], err = col.Cell(v); err != nil {
+				return err
+			}
+		}
+		return r.writeRow(cells)
+	case "set":
+		if len(cmd.Args) != 2 {
+			return errors.New("want 2 arguments")
+		}
+		v, err := ParseValue(cmd.Args[1])
+		if err != nil {
+			return err
+		}
+		return r.sim.Set(cmd.Args[0], v)
+	case "echo", "clear-echo", "breakpoint", "clear-breakpoints":
+		// 表示のみのコマンドはヘッドレス実行では何もしない
+	default:
+		return r.sim.Exec(cmd)
+	}
+	return nil
+}
+
+// cond whileの条件 "変数 演算子 値" を評価する。
+func (r *Runner) cond(args []string) (bool, error) {
+	s, err := r.sim.Get(args[0])
+	if err != nil {
+		return false, err
+	}
+	lhs, err := ParseValue(s)
+	if err != nil {
+		return false, err
+	}
+	rhs, err := ParseValue(args[2])
+	if err != nil {
+		return false, err
+	}
+	switch args[1] {
+	case "=":
+		return lhs == rhs, nil
+	case "<>":
+		return lhs != rhs, nil
+	case "<":
+		return lhs < rhs, nil
+	case ">":
+		return lhs > rhs, nil
+	case "<=":
+		return lhs <= rhs, nil
+	case ">=":
+		return lhs >= rhs, nil
+	}
+	return false, fmt.Errorf("invalid operator %q", args[1])
+}
+
+// writeRow 1行を出力ファイルに書き、比較ファイルの対応する行と比較する。
+func (r *Runner) writeRow(cells []string) error {
+	line := "|" + strings.Join(cells, "|") + "|"
+	if r.out != nil {
+		if _, err := r.out.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	r.lines++
+	if r.cmp == nil {
+		return nil
+	}
+	if r.lines > len(r.cmp) {
+		return &MismatchError{Line: r.lines, Expected: "(end of file)", Actual: line}
+	}
+	if expected := r.cmp[r.lines-1]; !matchLine(expected, line) {
+		return &MismatchError{
+			Line: r.lines, Column: r.mismatchColumn(expected, line),
+			Expected: expected, Actual: line,
+		}
+	}
+	return nil
+}
+
+// matchLine 比較ファイルの行と出力行が一致するかを返す。
+// 各セルは前後の空白を無視して比較し、'*'だけのセルは任意の値に一致する。
+func matchLine(expected, actual string) bool {
+	e := strings.Split(strings.TrimSpace(expected), "|")
+	a := strings.Split(strings.TrimSpace(actual), "|")
+	if len(e) != len(a) {
+		return false
+	}
+	for i := range e {
+		if !matchCell(e[i], a[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchCell(expected, actual string) bool {
+	e := strings.TrimSpace(expected)
+	if e != "" && strings.Trim(e, "*") == "" {
+		return true
+	}
+	return e == strings.TrimSpace(actual)
+}
+
+// mismatchColumn 最初に一致しなかった列の変数名を返す。
+func (r *Runner) mismatchColumn(expected, actual string) string {
+	e := strings.Split(strings.TrimSpace(expected), "|")
+	a := strings.Split(strings.TrimSpace(actual), "|")
+	if len(e) != len(a) {
+		return ""
+	}
+	for i := 1; i < len(e)-1 && i-1 < len(r.columns); i++ {
+		if !matchCell(e[i], a[i]) {
+			return r.columns[i-1].Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+package tst
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// counter 変数xとyを持ち、tickでxを1増やすテスト用のシミュレータ。
+type counter struct {
+	loaded string
+	vars   map[string]int
+}
+
+func (c *counter) Load(path string) error {
+	c.loaded = path
+	c.vars = map[string]int{"x": 0, "y": 0}
+	return nil
+}
+
+func (c *counter) Set(name string, value int) error {
+	if _, ok := c.vars[name]; !ok {
+		return fmt.Errorf("unknown variable %q", name)
+	}
+	c.vars[name] = value
+	return nil
+}
+
+func (c *counter) Get(name string) (string, error) {
+	v, ok := c.vars[name]
+	if !ok {
+		return "", fmt.Errorf("unknown variable %q", name)
+	}
+	return strconv.Itoa(v), nil
+}
+
+func (c *counter) Exec(cmd Command) error {
+	if cmd.Name != "tick" {
+		return ErrUnsupported
+	}
+	c.vars["x"]++
+	return nil
+}
+
+// runScript スクリプトと比較ファイルを一時ディレクトリに置いて実行する。
+func runScript(t *testing.T, script, cmp string) (*counter, string, error) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "T.tst"), []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "T.cmp"), []byte(cmp), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sim := &counter{}
+	err := Run(filepath.Join(dir, "T.tst"), sim)
+	out, _ := os.ReadFile(filepath.Join(dir, "T.out"))
+	return sim, string(out), err
+}
+
+const header = "load C.hdl, output-file T.out, compare-to T.cmp, output-list x%D1.3.1 y%D1.3.1;\n"
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		cmp    string
+		out    string
+		err    string // 空なら成功
+	}{
+		{"pass", header + "set y 7, output; tick, tick, output;",
+			"|  x  |  y  |\n|   0 |   7 |\n|   2 |   7 |\n", "|  x  |  y  |\n|   0 |   7 |\n|   2 |   7 |\n", ""},
+		{"repeat", header + "repeat 3 { tick; } output;",
+			"|  x  |  y  |\n|   3 |   0 |\n", "", ""},
+		{"while", header + "while x < 5 { tick; } output;",
+			"|  x  |  y  |\n|   5 |   0 |\n", "", ""},
+		{"wildcard and spaces", header + "set y %B101, output;",
+			"|x|y|\r\n|  * |5|\r\n", "", ""},
+		{"mismatch", header + "tick, output;",
+			"|  x  |  y  |\n|   2 |   0 |\n", "|  x  |  y  |\n|   1 |   0 |\n", "comparison failure at line 2 (x)"},
+		{"missing output", header + "output;",
+			"|  x  |  y  |\n|   0 |   0 |\n|   1 |   0 |\n", "", "comparison failure at line 3"},
+		{"extra output", header + "output, output;",
+			"|  x  |  y  |\n|   0 |   0 |\n", "", "comparison failure at line 3"},
+		{"unsupported", header + "\neval;", "|  x  |  y  |\n", "", "line 3: eval: unsupported command"},
+		{"unknown variable", header + "set z 1;", "|  x  |  y  |\n", "", `set: unknown variable "z"`},
+		{"infinite repeat", header + "repeat { tick; }", "|  x  |  y  |\n", "", "infinite repeat cannot run headless"},
+		{"bad value", header + "set x %Q1;", "|  x  |  y  |\n", "", `invalid value "%Q1"`},
+	}
+	for _, tt := range tests {
+		sim, out, err := runScript(t, tt.script, tt.cmp)
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.err)
+			continue
+		}
+		if tt.out != "" && out != tt.out {
+			t.Errorf("%s: wrote %q, want %q", tt.name, out, tt.out)
+		}
+		if !strings.HasSuffix(sim.loaded, "C.hdl") {
+			t.Errorf("%s: loaded %q", tt.name, sim.loaded)
+		}
+	}
+
+	_, _, err := runScript(t, header+"tick, output;", "|  x  |  y  |\n|   2 |   0 |\n")
+	var mismatch *MismatchError
+	if !errors.As(err, &mismatch) || mismatch.Line != 2 || mismatch.Column != "x" || mismatch.Actual != "|   1 |   0 |" {
+		t.Errorf("got %#v", err)
+	}
+}
+
+func TestRunWhileLimit(t *testing.T) {
+	defer func(n int) { MaxWhileIterations = n }(MaxWhileIterations)
+	MaxWhileIterations = 10
+	_, _, err := runScript(t, header+"while y = 0 { tick; }", "|  x  |  y  |\n")
+	if err == nil || !strings.Contains(err.Error(), "still holds after 10 iterations") {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+// Package tst はnand2tetrisのテストスクリプト(.tst)を解釈し、
+// 出力(.out)を比較ファイル(.cmp)と突き合わせる。
+// シミュレータ固有の部分はSimulatorインターフェースとして切り離している。
+package tst
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Command スクリプト中の1コマンド。
+// repeatの場合はCountとBodyを持つ (Count < 0 は無限回)。
+// whileの場合はArgsに条件 "変数 比較演算子 値" を、Bodyに本体を持つ。
+type Command struct {
+	Name  string
+	Args  []string
+	Count int
+	Body  []Command
+	Line  int
+}
+
+type token struct {
+	text   string
+	line   int
+	quoted bool
+}
+
+// Parse スクリプトを読み込んでコマンド列に変換する。
+func Parse(r io.Reader) ([]Command, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	toks, err := tokenize(string(b))
+	if err != nil {
+		return nil, err
+	}
+	cmds, rest, err := parseBlock(toks, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("line %d: unexpected %q", rest[0].line, rest[0].text)
+	}
+	return cmds, nil
+}
+
+// parseBlock '}'またはトークン末尾までのコマンドを読む。
+func parseBlock(toks []token, inBlock bool) ([]Command, []token, error) {
+	var cmds []Command
+	for len(toks) > 0 {
+		t := toks[0]
+		if !t.quoted {
+			switch t.text {
+			case "}":
+				if !inBlock {
+					return nil, nil, fmt.Errorf("line %d: unexpected '}'", t.line)
+				}
+				return cmds, toks[1:], nil
+			case ",", ";", "!":
+				toks = toks[1:]
+				continue
+			case "repeat", "while":
+				cmd, rest, err := parseLoop(toks)
+				if err != nil {
+					return nil, nil, err
+				}
+				cmds = append(cmds, cmd)
+				toks = rest
+				continue
+			}
+		}
+
+		cmd := Command{Name: t.text, Line: t.line}
+		toks = toks[1:]
+		for len(toks) > 0 && (toks[0].quoted || !isTerminator(toks[0].text)) {
+			cmd.Args = append(cmd.Args, toks[0].text)
+			toks = toks[1:]
+		}
+		if len(toks) == 0 || toks[0].text == "}" {
+			return nil, nil, fmt.Errorf("line %d: missing terminator after %q", cmd.Line, cmd.Name)
+		}
+		toks = toks[1:]
+		cmds = append(cmds, cmd)
+	}
+	if inBlock {
+		return nil, nil, fmt.Errorf("unexpected end of script: missing '}'")
+	}
+	return cmds, nil, nil
+}
+
+// parseLoop "repeat [n] { ... }" または "while 変数 演算子 値 { ... }" を読む。
+func parseLoop(toks []token) (Command, []token, error) {
+	cmd := Command{Name: toks[0].text, Count: -1, Line: toks[0].line}
+	toks = toks[1:]
+	if cmd.Name == "while" {
+		for len(toks) > 0 && toks[0].text != "{" {
+			cmd.Args = append(cmd.Args, toks[0].text)
+			toks = toks[1:]
+		}
+		if len(cmd.Args) != 3 {
+			return cmd, nil, fmt.Errorf("line %d: invalid while condition %q", cmd.Line, strings.Join(cmd.Args, " "))
+		}
+	} else if len(toks) > 0 && toks[0].text != "{" {
+		n, err := strconv.Atoi(toks[0].text)
+		if err != nil || n < 0 {
+			return cmd, nil, fmt.Errorf("line %d: invalid repeat count %q", toks[0].line, toks[0].text)
+		}
+		cmd.Count = n
+		toks = toks[1:]
+	}
+	if len(toks) == 0 || toks[0].text != "{" {
+		return cmd, nil, fmt.Errorf("line %d: missing '{' after %s", cmd.Line, cmd.Name)
+	}
+	body, rest, err := parseBlock(toks[1:], true)
+	if err != nil {
+		return cmd, nil, err
+	}
+	cmd.Body = body
+	return cmd, rest, nil
+}
+
+func isTerminator(s string) bool {
+	return s == "," || s == ";" || s == "!" || s == "{" || s == "}"
+}
+
+// tokenize コメントを除去し、単語, 文字列, 区切り記号に分割する。
+func tokenize(src string) ([]token, error) {
+	var toks []token
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+		case c == '"':
+			end := strings.IndexByte(src[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			toks = append(toks, token{text: src[i+1 : i+1+end], line: line, quoted: true})
+			i += end + 2
+		case strings.IndexByte(",;!{}", c) >= 0:
+			toks = append(toks, token{text: string(c), line: line})
+			i++
+		default:
+			start := i
+			for i < len(src) && strings.IndexByte(" \t\r\n,;!{}\"", src[i]) < 0 &&
+				!strings.HasPrefix(src[i:], "//") && !strings.HasPrefix(src[i:], "/*") {
+				i++
+			}
+			toks = append(toks, token{text: src[start:i], line: line})
+		}
+	}
+	return toks, nil
+}
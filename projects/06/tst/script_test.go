@@ -0,0 +1,77 @@
+package tst
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []Command
+	}{
+		{"commands", "load Max.asm,\noutput-file Max.out,\nset RAM[0] 3;\n",
+			[]Command{
+				{Name: "load", Args: []string{"Max.asm"}, Line: 1},
+				{Name: "output-file", Args: []string{"Max.out"}, Line: 2},
+				{Name: "set", Args: []string{"RAM[0]", "3"}, Line: 3},
+			}},
+		{"comments", "// header\n/* multi\nline */ ticktock; // trailing\noutput;",
+			[]Command{{Name: "ticktock", Line: 3}, {Name: "output", Line: 4}}},
+		{"repeat", "repeat 2 {\n  ticktock;\n}\noutput;",
+			[]Command{
+				{Name: "repeat", Count: 2, Line: 1, Body: []Command{{Name: "ticktock", Line: 2}}},
+				{Name: "output", Line: 4},
+			}},
+		{"infinite repeat", "repeat { tick, tock; }",
+			[]Command{{Name: "repeat", Count: -1, Line: 1, Body: []Command{{Name: "tick", Line: 1}, {Name: "tock", Line: 1}}}}},
+		{"while", "while RAM[0] <> 0 { ticktock; }",
+			[]Command{{Name: "while", Args: []string{"RAM[0]", "<>", "0"}, Count: -1, Line: 1, Body: []Command{{Name: "ticktock", Line: 1}}}}},
+		{"nested", "repeat 3 { repeat 2 { tick; } output; }",
+			[]Command{{Name: "repeat", Count: 3, Line: 1, Body: []Command{
+				{Name: "repeat", Count: 2, Line: 1, Body: []Command{{Name: "tick", Line: 1}}},
+				{Name: "output", Line: 1},
+			}}}},
+		{"quoted", "echo \"press a key; then wait\";",
+			[]Command{{Name: "echo", Args: []string{"press a key; then wait"}, Line: 1}}},
+		{"output-list", "output-list RAM[0]%D2.6.2 RAM[1]%B1.16.1;",
+			[]Command{{Name: "output-list", Args: []string{"RAM[0]%D2.6.2", "RAM[1]%B1.16.1"}, Line: 1}}},
+		{"breakpoint terminator", "ticktock!",
+			[]Command{{Name: "ticktock", Line: 1}}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(strings.NewReader(tt.src))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n got  %+v\n want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"load Max.asm", `line 1: missing terminator after "load"`},
+		{"ticktock;\n}", "line 2: unexpected '}'"},
+		{"repeat 2 { ticktock;", "missing '}'"},
+		{"repeat x { ticktock; }", `line 1: invalid repeat count "x"`},
+		{"repeat -1 { ticktock; }", `line 1: invalid repeat count "-1"`},
+		{"\nrepeat 2 ticktock;", "line 2: missing '{' after repeat"},
+		{"while RAM[0] { tick; }", `line 1: invalid while condition "RAM[0]"`},
+		{"/* open\n", "line 1: unterminated comment"},
+		{"echo \"open;\n", "line 1: unterminated string"},
+		{"repeat 2 { ticktock }", `line 1: missing terminator after "ticktock"`},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(strings.NewReader(tt.src)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: got %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}
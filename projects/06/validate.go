@@ -0,0 +1,59 @@
+package assembler
+
+import (
+	"strconv"
+	"strings"
+)
+
+// maxAConstant A命令で扱える最大値 (15bit)
+const maxAConstant = 1<<15 - 1
+
+// checkAValue @Xxxのxxx部分が数値またはシンボルとして正しいかを検査する。
+// 問題がある場合はその内容を、問題がない場合は空文字を返す。
+func checkAValue(s string) string {
+	if s == "" {
+		return "missing value in A-instruction"
+	}
+	if strings.HasPrefix(s, "-") {
+		if _, err := strconv.Atoi(s[1:]); err == nil {
+			return "negative constant in A-instruction"
+		}
+	}
+	if isDigit(s[0]) {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			if strings.Trim(s, "0123456789") == "" {
+				return "constant out of range (max 32767)"
+			}
+			return "illegal symbol name"
+		}
+		if n > maxAConstant {
+			return "constant out of range (max 32767)"
+		}
+		return ""
+	}
+	return checkSymbolName(s)
+}
+
+// checkSymbolName シンボル名として正しいかを検査する。
+// シンボルは英字, 数字, '_', '.', '$', ':' から成り、数字で始まらない。
+func checkSymbolName(s string) string {
+	if s == "" {
+		return "empty symbol name"
+	}
+	if isDigit(s[0]) {
+		return "symbol must not start with a digit"
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(isDigit(c) || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+			strings.IndexByte("_.$:", c) >= 0) {
+			return "illegal symbol name"
+		}
+	}
+	return ""
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,90 @@
+package assembler
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckAValue(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"0", ""},
+		{"32767", ""},
+		{"LOOP", ""},
+		{"a.b$c:d_1", ""},
+		{"", "missing value in A-instruction"},
+		{"-5", "negative constant in A-instruction"},
+		{"32768", "constant out of range (max 32767)"},
+		{"40000", "constant out of range (max 32767)"},
+		{"99999999999999999999", "constant out of range (max 32767)"},
+		{"12ab", "illegal symbol name"},
+		{"foo!", "illegal symbol name"},
+		{"a@b", "illegal symbol name"},
+	}
+	for _, tt := range tests {
+		if got := checkAValue(tt.s); got != tt.want {
+			t.Errorf("checkAValue(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSymbolName(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"LOOP", ""},
+		{"_x.y$z:1", ""},
+		{"", "empty symbol name"},
+		{"1LOOP", "symbol must not start with a digit"},
+		{"LO-OP", "illegal symbol name"},
+		{"ラベル", "illegal symbol name"},
+	}
+	for _, tt := range tests {
+		if got := checkSymbolName(tt.s); got != tt.want {
+			t.Errorf("checkSymbolName(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestInvalidAValuesAndLabels(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []Diagnostic
+	}{
+		{"@-5", []Diagnostic{{Line: 1, Column: 2, Mnemonic: "-5", Message: "negative constant in A-instruction"}}},
+		{"  @40000", []Diagnostic{{Line: 1, Column: 4, Mnemonic: "40000", Message: "constant out of range (max 32767)"}}},
+		{"@", []Diagnostic{{Line: 1, Column: 2, Mnemonic: "", Message: "missing value in A-instruction"}}},
+		{"@foo!", []Diagnostic{{Line: 1, Column: 2, Mnemonic: "foo!", Message: "illegal symbol name"}}},
+		{"(LOOP\n@LOOP", []Diagnostic{{Line: 1, Column: 2, Mnemonic: "LOOP", Message: "unbalanced parentheses in label"}}},
+		{"(LOOP)\n@LOOP\n(LOOP)", []Diagnostic{{Line: 3, Column: 2, Mnemonic: "LOOP", Message: "duplicate label (first defined at line 1)"}}},
+		{"(1ST)", []Diagnostic{{Line: 1, Column: 2, Mnemonic: "1ST", Message: "symbol must not start with a digit"}}},
+		{"(A-B)", []Diagnostic{{Line: 1, Column: 2, Mnemonic: "A-B", Message: "illegal symbol name"}}},
+		{"(SCREEN)", []Diagnostic{{Line: 1, Column: 2, Mnemonic: "SCREEN", Message: "label redefines predefined symbol"}}},
+		{".equ N 3\n(N)", []Diagnostic{{Line: 2, Column: 2, Mnemonic: "N", Message: "label redefines constant"}}},
+	}
+	for _, tt := range tests {
+		got := diagnose(t, "", tt.src, Options{})
+		if !reflect.DeepEqual([]Diagnostic(got), tt.want) {
+			t.Errorf("%q:\n got  %+v\n want %+v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestDuplicateLabelInclude(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.asm")
+	if err := os.WriteFile(lib, []byte("// lib\n(LOOP)\n@LOOP\n0;JMP\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	main := filepath.Join(dir, "main.asm")
+	got := diagnose(t, main, ".include \"lib.asm\"\n(LOOP)\n", Options{})
+	want := []Diagnostic{{File: main, Line: 2, Column: 2, Mnemonic: "LOOP", Message: "duplicate label (first defined at " + lib + ":2)"}}
+	if !reflect.DeepEqual([]Diagnostic(got), want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+}
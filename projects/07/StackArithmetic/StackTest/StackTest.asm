@@ -20,14 +20,14 @@ D=M
 M=M-1
 A=M
 D=M-D
-@LABEL1
+@IF_LABEL_1
 D;JEQ
 D=0
-@LABEL2
+@IF_LABEL_2
 0;JMP
-(LABEL1)
+(IF_LABEL_1)
 D=-1
-(LABEL2)
+(IF_LABEL_2)
 @SP
 A=M
 M=D
@@ -55,14 +55,14 @@ D=M
 M=M-1
 A=M
 D=M-D
-@LABEL3
+@IF_LABEL_3
 D;JEQ
 D=0
-@LABEL4
+@IF_LABEL_4
 0;JMP
-(LABEL3)
+(IF_LABEL_3)
 D=-1
-(LABEL4)
+(IF_LABEL_4)
 @SP
 A=M
 M=D
@@ -90,14 +90,14 @@ D=M
 M=M-1
 A=M
 D=M-D
-@LABEL5
+@IF_LABEL_5
 D;JEQ
 D=0
-@LABEL6
+@IF_LABEL_6
 0;JMP
-(LABEL5)
+(IF_LABEL_5)
 D=-1
-(LABEL6)
+(IF_LABEL_6)
 @SP
 A=M
 M=D
@@ -125,14 +125,14 @@ D=M
 M=M-1
 A=M
 D=M-D
-@LABEL7
+@IF_LABEL_7
 D;JLT
 D=0
-@LABEL8
+@IF_LABEL_8
 0;JMP
-(LABEL7)
+(IF_LABEL_7)
 D=-1
-(LABEL8)
+(IF_LABEL_8)
 @SP
 A=M
 M=D
@@ -160,14 +160,14 @@ D=M
 M=M-1
 A=M
 D=M-D
-@LABEL9
+@IF_LABEL_9
 D;JLT
 D=0
-@LABEL10
+@IF_LABEL_10
 0;JMP
-(LABEL9)
+(IF_LABEL_9)
 D=-1
-(LABEL10)
+(IF_LABEL_10)
 @SP
 A=M
 M=D
@@ -195,14 +195,14 @@ D=M
 M=M-1
 A=M
 D=M-D
-@LABEL11
+@IF_LABEL_11
 D;JLT
 D=0
-@LABEL12
+@IF_LABEL_12
 0;JMP
-(LABEL11)
+(IF_LABEL_11)
 D=-1
-(LABEL12)
+(IF_LABEL_12)
 @SP
 A=M
 M=D
@@ -230,14 +230,14 @@ D=M
 M=M-1
 A=M
 D=M-D
-@LABEL13
+@IF_LABEL_13
 D;JGT
 D=0
-@LABEL14
+@IF_LABEL_14
 0;JMP
-(LABEL13)
+(IF_LABEL_13)
 D=-1
-(LABEL14)
+(IF_LABEL_14)
 @SP
 A=M
 M=D
@@ -265,14 +265,14 @@ D=M
 M=M-1
 A=M
 D=M-D
-@LABEL15
+@IF_LABEL_15
 D;JGT
 D=0
-@LABEL16
+@IF_LABEL_16
 0;JMP
-(LABEL15)
+(IF_LABEL_15)
 D=-1
-(LABEL16)
+(IF_LABEL_16)
 @SP
 A=M
 M=D
@@ -300,14 +300,14 @@ D=M
 M=M-1
 A=M
 D=M-D
-@LABEL17
+@IF_LABEL_17
 D;JGT
 D=0
-@LABEL18
+@IF_LABEL_18
 0;JMP
-(LABEL17)
+(IF_LABEL_17)
 D=-1
-(LABEL18)
+(IF_LABEL_18)
 @SP
 A=M
 M=D
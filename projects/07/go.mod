@@ -1,3 +0,0 @@
-module github.com/momotaro98/nand2tetris/vmm1
-
-go 1.20
@@ -367,60 +367,6 @@ M=D
 @R14
 A=M
 0;JMP
-@256
-D=A
-@SP
-M=D
-@RETURN_LABEL_4
-D=A
-@SP
-A=M
-M=D
-@SP
-M=M+1
-@LCL
-D=M
-@SP
-A=M
-M=D
-@SP
-M=M+1
-@ARG
-D=M
-@SP
-A=M
-M=D
-@SP
-M=M+1
-@THIS
-D=M
-@SP
-A=M
-M=D
-@SP
-M=M+1
-@THAT
-D=M
-@SP
-A=M
-M=D
-@SP
-M=M+1
-@SP
-D=M
-@5
-D=D-A
-@0
-D=D-A
-@ARG
-M=D
-@SP
-D=M
-@LCL
-M=D
-@Sys.init
-0;JMP
-(RETURN_LABEL_4)
 (Sys.init)
 D=0
 @6
@@ -430,7 +376,7 @@ A=M
 M=D
 @SP
 M=M+1
-@RETURN_LABEL_5
+@RETURN_LABEL_4
 D=A
 @SP
 A=M
@@ -479,7 +425,7 @@ D=M
 M=D
 @Main.fibonacci
 0;JMP
-(RETURN_LABEL_5)
+(RETURN_LABEL_4)
 (Sys.init:WHILE)
 @Sys.init:WHILE
 0;JMP
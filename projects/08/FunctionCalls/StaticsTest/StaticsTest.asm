@@ -209,60 +209,6 @@ M=D
 @R14
 A=M
 0;JMP
-@256
-D=A
-@SP
-M=D
-@RETURN_LABEL_2
-D=A
-@SP
-A=M
-M=D
-@SP
-M=M+1
-@LCL
-D=M
-@SP
-A=M
-M=D
-@SP
-M=M+1
-@ARG
-D=M
-@SP
-A=M
-M=D
-@SP
-M=M+1
-@THIS
-D=M
-@SP
-A=M
-M=D
-@SP
-M=M+1
-@THAT
-D=M
-@SP
-A=M
-M=D
-@SP
-M=M+1
-@SP
-D=M
-@5
-D=D-A
-@0
-D=D-A
-@ARG
-M=D
-@SP
-D=M
-@LCL
-M=D
-@Sys.init
-0;JMP
-(RETURN_LABEL_2)
 (Class2.set)
 D=0
 @ARG
@@ -420,60 +366,6 @@ M=D
 @R14
 A=M
 0;JMP
-@256
-D=A
-@SP
-M=D
-@RETURN_LABEL_3
-D=A
-@SP
-A=M
-M=D
-@SP
-M=M+1
-@LCL
-D=M
-@SP
-A=M
-M=D
-@SP
-M=M+1
-@ARG
-D=M
-@SP
-A=M
-M=D
-@SP
-M=M+1
-@THIS
-D=M
-@SP
-A=M
-M=D
-@SP
-M=M+1
-@THAT
-D=M
-@SP
-A=M
-M=D
-@SP
-M=M+1
-@SP
-D=M
-@5
-D=D-A
-@0
-D=D-A
-@ARG
-M=D
-@SP
-D=M
-@LCL
-M=D
-@Sys.init
-0;JMP
-(RETURN_LABEL_3)
 (Sys.init)
 D=0
 @6
@@ -490,7 +382,7 @@ A=M
 M=D
 @SP
 M=M+1
-@RETURN_LABEL_4
+@RETURN_LABEL_2
 D=A
 @SP
 A=M
@@ -539,7 +431,7 @@ D=M
 M=D
 @Class1.set
 0;JMP
-(RETURN_LABEL_4)
+(RETURN_LABEL_2)
 @SP
 M=M-1
 A=M
@@ -560,7 +452,7 @@ A=M
 M=D
 @SP
 M=M+1
-@RETURN_LABEL_5
+@RETURN_LABEL_3
 D=A
 @SP
 A=M
@@ -609,14 +501,14 @@ D=M
 M=D
 @Class2.set
 0;JMP
-(RETURN_LABEL_5)
+(RETURN_LABEL_3)
 @SP
 M=M-1
 A=M
 D=M
 @5
 M=D
-@RETURN_LABEL_6
+@RETURN_LABEL_4
 D=A
 @SP
 A=M
@@ -665,8 +557,8 @@ D=M
 M=D
 @Class1.get
 0;JMP
-(RETURN_LABEL_6)
-@RETURN_LABEL_7
+(RETURN_LABEL_4)
+@RETURN_LABEL_5
 D=A
 @SP
 A=M
@@ -715,7 +607,7 @@ D=M
 M=D
 @Class2.get
 0;JMP
-(RETURN_LABEL_7)
+(RETURN_LABEL_5)
 (Sys.init:WHILE)
 @Sys.init:WHILE
 0;JMP
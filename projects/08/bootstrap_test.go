@@ -0,0 +1,134 @@
+package vmtranslator
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/momotaro98/nand2tetris/assembler"
+	"github.com/momotaro98/nand2tetris/assembler/cpu"
+	"github.com/momotaro98/nand2tetris/assembler/tst"
+)
+
+// TestBootstrapModes 8章の各プログラムを3つのモードで変換し、.tstを実行して.cmpと比べる。
+// Sys.vmの無いプログラムはブートストラップがあると存在しないSys.initに飛ぶので失敗し、
+// Sys.vmのあるプログラムはブートストラップが無いとスタックが用意されないので失敗する。
+// NestedCallのスクリプトはブートストラップの有無にかかわらず通るように作られている。
+func TestBootstrapModes(t *testing.T) {
+	tests := []struct {
+		dir            string
+		on, off        bool // BootstrapOn, BootstrapOffで.cmpと一致するか
+		autoBootstraps bool
+	}{
+		{"ProgramFlow/BasicLoop", false, true, false},
+		{"ProgramFlow/FibonacciSeries", false, true, false},
+		{"FunctionCalls/SimpleFunction", false, true, false},
+		{"FunctionCalls/FibonacciElement", true, false, true},
+		{"FunctionCalls/NestedCall", true, true, true},
+		{"FunctionCalls/StaticsTest", true, false, true},
+	}
+	for _, tt := range tests {
+		name := filepath.Base(tt.dir)
+		for _, mode := range []struct {
+			name string
+			b    Bootstrap
+			pass bool
+		}{
+			{"auto", BootstrapAuto, true},
+			{"on", BootstrapOn, tt.on},
+			{"off", BootstrapOff, tt.off},
+		} {
+			t.Run(name+"/"+mode.name, func(t *testing.T) {
+				files, _, err := Sources(tt.dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				asm := translate(t, files, Options{Bootstrap: mode.b})
+				want := 0
+				if mode.b == BootstrapOn || mode.b == BootstrapAuto && tt.autoBootstraps {
+					want = 1
+				}
+				if got := strings.Count(asm, bootstrapCode); got != want {
+					t.Fatalf("bootstrap written %d times, want %d", got, want)
+				}
+
+				err = runScript(t, tt.dir, name, asm)
+				var mismatch *tst.MismatchError
+				switch {
+				case mode.pass && err != nil:
+					t.Fatalf("script failed: %v", err)
+				case !mode.pass && err == nil:
+					t.Fatal("script passed, want a failure")
+				case err != nil && !errors.As(err, &mismatch) && !errors.Is(err, cpu.ErrBadAddress):
+					t.Fatalf("unexpected error: %v", err)
+				}
+			})
+		}
+	}
+}
+
+// bootstrapCode WriteInitが書くSP=256の部分。
+const bootstrapCode = "@256\nD=A\n@SP\nM=D\n"
+
+// runScript asmをdirのテストスクリプトと比較ファイルとともに一時ディレクトリに置いて実行する。
+func runScript(t *testing.T, dir, name, asm string) error {
+	t.Helper()
+	tmp := t.TempDir()
+	for _, ext := range []string{".tst", ".cmp"} {
+		b, err := os.ReadFile(filepath.Join(dir, name+ext))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(tmp, name+ext), b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tmp, name+".asm"), []byte(asm), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sim := tst.NewCPUSimulator(func(path string) ([]uint16, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return assembler.Assemble(f)
+	})
+	return tst.Run(filepath.Join(tmp, name+".tst"), sim)
+}
+
+// initCounter WriteInitの呼び出しを数えるCodeWriter。
+type initCounter struct {
+	CodeWriter
+	inits int
+}
+
+func (c *initCounter) WriteInit() {
+	c.inits++
+	c.CodeWriter.WriteInit()
+}
+
+// TestBootstrapOnce 複数のファイルを変換してもブートストラップはプログラムの先頭に1度だけ書くことを確かめる。
+func TestBootstrapOnce(t *testing.T) {
+	for _, dir := range []string{"FunctionCalls/FibonacciElement", "FunctionCalls/NestedCall", "FunctionCalls/StaticsTest"} {
+		files, _, err := Sources(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, b := range []Bootstrap{BootstrapAuto, BootstrapOn} {
+			var buf strings.Builder
+			cw := &initCounter{CodeWriter: NewCodeWriter(&buf)}
+			if err := Translate(cw, files, Options{Bootstrap: b}); err != nil {
+				t.Fatal(err)
+			}
+			if cw.inits != 1 {
+				t.Errorf("%s (%d files, mode %d): WriteInit called %d times", dir, len(files), b, cw.inits)
+			}
+			if !strings.HasPrefix(buf.String(), bootstrapCode) {
+				t.Errorf("%s: output does not start with the bootstrap", dir)
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/momotaro98/nand2tetris/vmtranslator"
+)
+
+var (
+	pathName    = flag.String("path", "", "file name or dir name where vm file exists (or give them as arguments)")
+	outPath     = flag.String("o", "", "write the assembly to this file (\"-\" for stdout); only with a single path")
+	bootstrap   = flag.Bool("bootstrap", false, "always write the bootstrap code (SP=256, call Sys.init) at the start of the program")
+	noBootstrap = flag.Bool("no-bootstrap", false, "never write the bootstrap code (default: write it only when Sys.vm is translated)")
+	check       = flag.Bool("check", false, "do not write; compare the translation with the existing .asm files (golden files) and fail on differences")
+)
+
+func main() {
+	flag.Parse()
+	paths := flag.Args()
+	if *pathName != "" {
+		paths = append([]string{*pathName}, paths...)
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	if *outPath != "" && len(paths) != 1 {
+		fmt.Fprintln(os.Stderr, "-o needs exactly one path")
+		os.Exit(2)
+	}
+
+	if *bootstrap && *noBootstrap {
+		fmt.Fprintln(os.Stderr, "-bootstrap and -no-bootstrap cannot be used together")
+		os.Exit(2)
+	}
+	opts := vmtranslator.Options{Bootstrap: vmtranslator.BootstrapAuto}
+	if *bootstrap {
+		opts.Bootstrap = vmtranslator.BootstrapOn
+	} else if *noBootstrap {
+		opts.Bootstrap = vmtranslator.BootstrapOff
+	}
+
+	failed := false
+	for _, path := range paths {
+		if err := run(path, opts); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// run pathの.vmファイルを1つのアセンブリに変換して書き出す。-checkの場合は既存の出力と比べる。
+func run(path string, opts vmtranslator.Options) error {
+	files, output, err := vmtranslator.Sources(path)
+	if err != nil {
+		return err
+	}
+	if *outPath != "" {
+		output = *outPath
+	}
+	var buf bytes.Buffer
+	if err := vmtranslator.Translate(vmtranslator.NewCodeWriter(&buf), files, opts); err != nil {
+		return err
+	}
+
+	if *check {
+		want, err := os.ReadFile(output)
+		if err != nil {
+			return err
+		}
+		if err := compare(buf.String(), string(want)); err != nil {
+			return fmt.Errorf("%s: %w", output, err)
+		}
+		fmt.Println("ok", output)
+		return nil
+	}
+	if output == "-" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	if err := os.WriteFile(output, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	fmt.Println("Translated to", output)
+	return nil
+}
+
+// compare 変換結果gotと既存の出力wantを行ごとに比べ、最初に異なる行を返す。
+func compare(got, want string) error {
+	g, w := strings.Split(got, "\n"), strings.Split(want, "\n")
+	for i := 0; i < len(g) || i < len(w); i++ {
+		var gl, wl string
+		if i < len(g) {
+			gl = g[i]
+		}
+		if i < len(w) {
+			wl = w[i]
+		}
+		if gl != wl {
+			return fmt.Errorf("differs at line %d: got %q, want %q", i+1, gl, wl)
+		}
+	}
+	return nil
+}
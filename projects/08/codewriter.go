@@ -1,10 +1,9 @@
-package main
+package vmtranslator
 
 import (
 	"bufio"
 	"fmt"
 	"io"
-	"os"
 	"strings"
 )
 
@@ -13,8 +12,10 @@ const (
 	POINTER_BASE_ADDRESS = 3
 )
 
+// CodeWriter VMコマンドをHackのアセンブリに変換して書き出す。
+// Translateはこのインターフェースだけを通して出力するので、別の出力(最適化したコードなど)に差し替えられる。
+// 書き込みのエラーはFlushで返す。
 type CodeWriter interface {
-	Close() error
 	Flush() error
 	SetFileName(filename string)
 	WriteArithmetic(command string)
@@ -30,27 +31,20 @@ type CodeWriter interface {
 
 type codeWriter struct {
 	currentTranslatedFileName string
-	oFile                     *os.File
 	writer                    *bufio.Writer
 	ifLabelNum                int // 重複しないラベルを生成するためのカウンター
 	returnLabelNum            int
 	currentFunctionName       string
 }
 
-func NewCodeWriter(oFilePath string) CodeWriter {
-	oFile, _ := os.Create(oFilePath)
-	writer := bufio.NewWriter(oFile)
+// NewCodeWriter wに書き出すCodeWriterを返す。
+func NewCodeWriter(w io.Writer) CodeWriter {
 	return &codeWriter{
-		oFile:      oFile,
-		writer:     writer,
+		writer:     bufio.NewWriter(w),
 		ifLabelNum: 0,
 	}
 }
 
-func (cw *codeWriter) Close() error {
-	return cw.oFile.Close()
-}
-
 func (cw *codeWriter) Flush() error {
 	return cw.writer.Flush()
 }
@@ -1,3 +1,7 @@
-module github.com/momotaro98/nand2tetris/vmm2
+module github.com/momotaro98/nand2tetris/vmtranslator
 
 go 1.20
+
+require github.com/momotaro98/nand2tetris/assembler v0.0.0
+
+replace github.com/momotaro98/nand2tetris/assembler => ../06
@@ -1,8 +1,9 @@
-package main
+package vmtranslator
 
 import (
 	"bufio"
-	"os"
+	"fmt"
+	"io"
 	"strconv"
 	"strings"
 )
@@ -21,43 +22,65 @@ const (
 	C_CALL       CommandType = "C_CALL"
 )
 
+// commandArgs コマンドごとの引数の数。ここに無いコマンドは算術コマンド。
+var commandArgs = map[string]struct {
+	typ  CommandType
+	args int
+}{
+	"push":     {C_PUSH, 2},
+	"pop":      {C_POP, 2},
+	"label":    {C_LABEL, 1},
+	"goto":     {C_GOTO, 1},
+	"if-goto":  {C_IF, 1},
+	"function": {C_FUNCTION, 2},
+	"return":   {C_RETURN, 0},
+	"call":     {C_CALL, 2},
+}
+
+var arithmeticCommands = map[string]bool{
+	"add": true, "sub": true, "neg": true, "eq": true, "gt": true,
+	"lt": true, "and": true, "or": true, "not": true,
+}
+
+var segments = map[string]bool{
+	"argument": true, "local": true, "static": true, "constant": true,
+	"this": true, "that": true, "pointer": true, "temp": true,
+}
+
+// segmentSizes 大きさが決まっているセグメントの要素数。
+var segmentSizes = map[string]int{"pointer": 2, "temp": 8}
+
 type Parser interface {
 	hasMoreCommands() bool
 	advance()
 	commandType() CommandType
 	arg1() string
 	arg2() int
-	Close() error
+	err() error
 }
 
-func NewParser(filePath string) Parser {
-	file, err := os.Open(filePath)
-	if err != nil {
-		panic(err)
-	}
-	scanner := bufio.NewScanner(file)
-	return &parser{
-		iFile:          file,
-		scanner:        scanner,
-		currentCommand: nil,
-		nextCommand:    nil,
-	}
+func NewParser(r io.Reader) Parser {
+	return &parser{scanner: bufio.NewScanner(r)}
 }
 
 type parser struct {
-	iFile          *os.File
 	scanner        *bufio.Scanner
 	currentCommand []string
 	nextCommand    []string
+	lineNum        int // 読み込んだ行数
+	error          error
 }
 
 // hasMoreCommands implements Parser
 // 入力にまだコマンドが存在するかを確認する。
+// 正しくないコマンドがあった場合はfalseを返し、err()でその内容を返す。
 func (p *parser) hasMoreCommands() bool {
-	for {
+	for p.error == nil {
 		if !p.scanner.Scan() {
+			p.error = p.scanner.Err()
 			return false
 		}
+		p.lineNum++
 		line := p.scanner.Text()
 		line = strings.SplitN(line, "//", 2)[0] // コメント文除去
 		line = strings.TrimSpace(line)          // 端空白削除
@@ -65,9 +88,48 @@ func (p *parser) hasMoreCommands() bool {
 		if len(line) < 1 { // 空行スキップ
 			continue
 		}
-		p.nextCommand = strings.Fields(line)
+		fields := strings.Fields(line)
+		if err := validate(fields); err != nil {
+			p.error = fmt.Errorf("line %d: %w", p.lineNum, err)
+			return false
+		}
+		p.nextCommand = fields
 		return true
 	}
+	return false
+}
+
+// validate コマンドの名前, 引数の数と値を確かめる。
+func validate(fields []string) error {
+	name := fields[0]
+	spec, ok := commandArgs[name]
+	if !ok {
+		if !arithmeticCommands[name] {
+			return fmt.Errorf("unknown command %q", name)
+		}
+		spec.args = 0
+	}
+	if len(fields)-1 != spec.args {
+		return fmt.Errorf("%s takes %d argument(s), got %d", name, spec.args, len(fields)-1)
+	}
+	if spec.typ == C_PUSH || spec.typ == C_POP {
+		if !segments[fields[1]] {
+			return fmt.Errorf("unknown segment %q", fields[1])
+		}
+		if spec.typ == C_POP && fields[1] == "constant" {
+			return fmt.Errorf("cannot pop to constant")
+		}
+	}
+	if spec.args == 2 {
+		n, err := strconv.Atoi(fields[2])
+		if err != nil || n < 0 || n > 32767 {
+			return fmt.Errorf("invalid number %q", fields[2])
+		}
+		if size, ok := segmentSizes[fields[1]]; ok && (spec.typ == C_PUSH || spec.typ == C_POP) && n >= size {
+			return fmt.Errorf("%s index %d out of range (0-%d)", fields[1], n, size-1)
+		}
+	}
+	return nil
 }
 
 // advance implements Parser
@@ -82,49 +144,33 @@ func (p *parser) advance() {
 // 現VMコマンドの種類を返す。
 // 算術コマンドはすべて C_ARITHMETIC が返される。
 func (p *parser) commandType() CommandType {
-	switch p.currentCommand[0] {
-	case "push":
-		return C_PUSH
-	case "pop":
-		return C_POP
-	case "label":
-		return C_LABEL
-	case "goto":
-		return C_GOTO
-	case "if-goto":
-		return C_IF
-	case "function":
-		return C_FUNCTION
-	case "return":
-		return C_RETURN
-	case "call":
-		return C_CALL
-	default:
-		return C_ARITHMETIC
+	if spec, ok := commandArgs[p.currentCommand[0]]; ok {
+		return spec.typ
 	}
+	return C_ARITHMETIC
 }
 
+// arg1 implements Parser
 // 現コマンドの最初の引数が返される。
 // C_ARITHMETIC の場合、コマンド自体(add, subなど)が返される。
 // 現コマンドが C_RETURN の場合、本メソッドは呼ばないようにする。
 func (p *parser) arg1() string {
 	if p.commandType() == C_ARITHMETIC {
 		return p.currentCommand[0]
-	} else {
-		return p.currentCommand[1]
 	}
+	return p.currentCommand[1]
 }
 
+// arg2 implements Parser
 // 現コマンドの2番目の引数が返される。
-// 現コマンドが C_PUSH, C_POP, C_FUNCTION, C_CALLL の場合のみ、本メソッドを呼ぶようにする。
+// 現コマンドが C_PUSH, C_POP, C_FUNCTION, C_CALL の場合のみ、本メソッドを呼ぶようにする。
 func (p *parser) arg2() int {
-	i, err := strconv.Atoi(p.currentCommand[2])
-	if err != nil {
-		panic(err)
-	}
+	i, _ := strconv.Atoi(p.currentCommand[2]) // hasMoreCommandsで確かめている
 	return i
 }
 
-func (p *parser) Close() error {
-	return p.iFile.Close()
+// err implements Parser
+// 読み込みの途中で見つかったエラーを返す。
+func (p *parser) err() error {
+	return p.error
 }
@@ -0,0 +1,114 @@
+package vmtranslator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Bootstrap ブートストラップ (SP=256 と Sys.init の呼び出し) を書くかどうか。
+type Bootstrap int
+
+const (
+	BootstrapAuto Bootstrap = iota // Sys.vm がある場合だけ書く
+	BootstrapOn
+	BootstrapOff
+)
+
+// Options 変換の設定。
+type Options struct {
+	Bootstrap Bootstrap
+}
+
+// needsBootstrap filesの変換結果にブートストラップを書くかを返す。
+func (o Options) needsBootstrap(files []string) bool {
+	switch o.Bootstrap {
+	case BootstrapOn:
+		return true
+	case BootstrapOff:
+		return false
+	}
+	for _, file := range files {
+		if filepath.Base(file) == "Sys.vm" {
+			return true
+		}
+	}
+	return false
+}
+
+// Translate filesのVMコードを順にcwで変換し、最後にFlushする。
+// ブートストラップはopts.Bootstrapに従ってプログラムの先頭に1度だけ書く。
+// 静的変数はファイル名(拡張子を除く)ごとに分ける。
+func Translate(cw CodeWriter, files []string, opts Options) error {
+	if opts.needsBootstrap(files) {
+		cw.WriteInit()
+	}
+	for _, file := range files {
+		if err := translateFile(file, cw); err != nil {
+			return err
+		}
+	}
+	return cw.Flush()
+}
+
+func translateFile(file string, codeWriter CodeWriter) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	parser := NewParser(f)
+	codeWriter.SetFileName(strings.Split(filepath.Base(file), ".")[0])
+	for parser.hasMoreCommands() {
+		parser.advance()
+
+		switch parser.commandType() {
+		case C_ARITHMETIC:
+			codeWriter.WriteArithmetic(parser.arg1())
+		case C_PUSH:
+			codeWriter.WritePushPop(C_PUSH, parser.arg1(), parser.arg2())
+		case C_POP:
+			codeWriter.WritePushPop(C_POP, parser.arg1(), parser.arg2())
+		case C_LABEL:
+			codeWriter.WriteLabel(parser.arg1())
+		case C_GOTO:
+			codeWriter.WriteGoto(parser.arg1())
+		case C_IF:
+			codeWriter.WriteIf(parser.arg1())
+		case C_FUNCTION:
+			codeWriter.WriteFunction(parser.arg1(), parser.arg2())
+		case C_RETURN:
+			codeWriter.WriteReturn()
+		case C_CALL:
+			codeWriter.WriteCall(parser.arg1(), parser.arg2())
+		}
+	}
+	if err := parser.err(); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return nil
+}
+
+// Sources pathが.vmファイルならそのファイルを、ディレクトリなら中の.vmファイルを名前順に返す。
+// outputは変換結果を書くファイルで、Xxx.vmならXxx.asm、ディレクトリXxxならXxx/Xxx.asmになる。
+func Sources(path string) (files []string, output string, err error) {
+	if strings.HasSuffix(path, ".vm") {
+		return []string{path}, strings.TrimSuffix(path, ".vm") + ".asm", nil
+	}
+	path = filepath.Clean(path)
+	files, err = filepath.Glob(filepath.Join(path, "*.vm"))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(files) == 0 {
+		return nil, "", fmt.Errorf("%s: no .vm files", path)
+	}
+	sort.Strings(files)
+	name := filepath.Base(path)
+	if abs, err := filepath.Abs(path); err == nil {
+		name = filepath.Base(abs) // "." などでもディレクトリ名を使う
+	}
+	return files, filepath.Join(path, name+".asm"), nil
+}
@@ -0,0 +1,109 @@
+package vmtranslator
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// programDirs 7章と8章のテストプログラムのディレクトリ。
+func programDirs(t *testing.T) []string {
+	t.Helper()
+	var dirs []string
+	for _, pattern := range []string{"../07/*/*", "ProgramFlow/*", "FunctionCalls/*"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range matches {
+			if vms, _ := filepath.Glob(filepath.Join(m, "*.vm")); len(vms) > 0 {
+				dirs = append(dirs, m)
+			}
+		}
+	}
+	if len(dirs) != 11 {
+		t.Fatalf("found %d test programs, want 11: %v", len(dirs), dirs)
+	}
+	return dirs
+}
+
+func translate(t *testing.T, files []string, opts Options) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Translate(NewCodeWriter(&buf), files, opts); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// TestGolden 各プログラムの変換結果がコミットしている.asmと一致することを確かめる。
+func TestGolden(t *testing.T) {
+	for _, dir := range programDirs(t) {
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			files, output, err := Sources(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := translate(t, files, Options{})
+			if got != string(want) {
+				gotLines, wantLines := strings.Split(got, "\n"), strings.Split(string(want), "\n")
+				for i := range gotLines {
+					if i >= len(wantLines) || gotLines[i] != wantLines[i] {
+						t.Fatalf("%s differs at line %d: got %q", output, i+1, gotLines[i])
+					}
+				}
+				t.Fatalf("%s differs: got %d lines, want %d", output, len(gotLines), len(wantLines))
+			}
+		})
+	}
+}
+
+func TestSources(t *testing.T) {
+	files, output, err := Sources("FunctionCalls/StaticsTest/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFiles := []string{"FunctionCalls/StaticsTest/Class1.vm", "FunctionCalls/StaticsTest/Class2.vm", "FunctionCalls/StaticsTest/Sys.vm"}
+	if strings.Join(files, " ") != strings.Join(wantFiles, " ") {
+		t.Errorf("files = %v, want %v", files, wantFiles)
+	}
+	if output != "FunctionCalls/StaticsTest/StaticsTest.asm" {
+		t.Errorf("output = %q", output)
+	}
+
+	if _, output, _ := Sources("ProgramFlow/BasicLoop/BasicLoop.vm"); output != "ProgramFlow/BasicLoop/BasicLoop.asm" {
+		t.Errorf("output = %q", output)
+	}
+	if _, _, err := Sources("ProgramFlow"); err == nil {
+		t.Error("Sources of a directory without .vm files succeeded")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"push constant 1\nfoo\n", "line 2: unknown command \"foo\""},
+		{"push constant\n", "line 1: push takes 2 argument(s), got 1"},
+		{"// comment\n\npop constant 1\n", "line 3: cannot pop to constant"},
+		{"push heap 1\n", "line 1: unknown segment \"heap\""},
+		{"push temp 8\n", "line 1: temp index 8 out of range (0-7)"},
+		{"push constant 32768\n", "line 1: invalid number \"32768\""},
+	}
+	for _, tt := range tests {
+		p := NewParser(strings.NewReader(tt.src))
+		for p.hasMoreCommands() {
+			p.advance()
+		}
+		if err := p.err(); err == nil || err.Error() != tt.want {
+			t.Errorf("%q: got error %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}